@@ -33,6 +33,13 @@ type loginForm struct {
 	validate.Validator
 }
 
+type staffLoginForm struct {
+	Username  string
+	Password  string
+	Signature string
+	validate.Validator
+}
+
 type changePasswordForm struct {
 	Password         string
 	NewPassword      string
@@ -109,8 +116,67 @@ type ticketResponseForm struct {
 	validate.Validator
 }
 
+type banForm struct {
+	Username      string
+	Scope         model.BanScope
+	Reason        string
+	ExpiresInDays int
+	FreezeFunds   bool
+	validate.Validator
+}
+
+type forfeitForm struct {
+	Vendor    string
+	AmountXMR float64
+	Recipient string
+	Reason    string
+	validate.Validator
+}
+
 type deleteForm struct {
 	Operation string
 	ID        uuid.UUID
+	Reason    string
+	validate.Validator
+}
+
+type feeTierForm struct {
+	MinSales      int
+	CommissionBps uint
+}
+
+type feeScheduleForm struct {
+	CommissionBps uint
+	WithdrawalFee int
+	WithdrawalMin int
+	PledgeXMR     float64
+	Tiers         []feeTierForm
+	Reason        string
+	validate.Validator
+}
+
+type vendorCommissionForm struct {
+	Username      string
+	CommissionBps uint
+	Reason        string
+	validate.Validator
+}
+
+// Empty TxHash queues the withdrawal to be transferred again
+type resolveWithdrawalForm struct {
+	ID     uuid.UUID
+	TxHash string
+	Reason string
+	validate.Validator
+}
+
+// ID is the category, or the product when moving a listing.
+// ParentID is the new parent or the category of the listing, uuid.Nil for none.
+type categoryForm struct {
+	Operation string
+	ID        uuid.UUID
+	ParentID  uuid.UUID
+	Name      string
+	Reason    string
 	validate.Validator
 }
@@ -4,9 +4,23 @@ import (
 	"LuomuTori/internal/log"
 	"LuomuTori/internal/model"
 	"LuomuTori/internal/model/view"
+	"LuomuTori/internal/service/audit"
+	"LuomuTori/internal/service/ban"
+	"LuomuTori/internal/service/category"
 	"LuomuTori/internal/service/dispute"
+	"LuomuTori/internal/service/fee"
+	"LuomuTori/internal/service/payment"
+	"LuomuTori/internal/service/pledge"
+	"LuomuTori/internal/service/staff"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	"math"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
 const (
@@ -19,27 +33,268 @@ func (app *application) servePage(page string) http.HandlerFunc {
 	}
 }
 
-func (app *application) admin(w http.ResponseWriter, r *http.Request) {
+// Role needed for each operation of handleOperation
+var operationRoles = map[string]model.StaffRole{
+	"deleteBan":              model.RoleModerator,
+	"deleteListing":          model.RoleModerator,
+	"deleteReview":           model.RoleModerator,
+	"deleteVendorCommission": model.RoleFinance,
+}
 
-	disputes, err := model.M.Dispute.GetAll(app.db)
+func (app *application) login(w http.ResponseWriter, r *http.Request) {
+	challenge, err := staff.NewChallenge()
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	tickets, err := model.M.Ticket.GetAll(app.db)
+	app.sessionManager.Put(r.Context(), "staffChallenge", challenge)
+
+	data := app.newTemplateData(r, map[string]any{
+		"challenge": challenge,
+	})
+	app.render(w, r, http.StatusOK, "staff-login.html", data)
+}
+
+func (app *application) handleLogin(w http.ResponseWriter, r *http.Request) {
+	form := staffLoginForm{}
+	if err := app.decodeForm(&form, r); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Each challenge can be signed for one login attempt
+	ctx := r.Context()
+	challenge := app.sessionManager.PopString(ctx, "staffChallenge")
+
+	s, err := staff.Authenticate(app.db, form.Username, form.Password, form.Signature, challenge)
 	if err != nil {
+		if errors.Is(err, staff.ErrInvalidCredentials) || errors.Is(err, staff.ErrInvalidSignature) {
+			log.Info.Printf("failed staff login for %s: %s\n", form.Username, err.Error())
+			app.addErrorNotes(ctx, "Invalid credentials or signature")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
 
+	if err := app.sessionManager.RenewToken(ctx); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(ctx, "staffID", s.ID)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) handleLogout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	app.sessionManager.Pop(ctx, "staffID")
+	app.sessionManager.RenewToken(ctx)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (app *application) admin(w http.ResponseWriter, r *http.Request) {
+	s := app.loggedInStaff(r)
+
+	disputes := make([]model.Dispute, 0)
+	if s.HasRole(model.RoleArbiter) {
+		var err error
+		disputes, err = model.M.Dispute.GetAll(app.db)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	tickets := make([]model.Ticket, 0)
+	bans := make([]model.Ban, 0)
+	if s.HasRole(model.RoleModerator) {
+		var err error
+		tickets, err = model.M.Ticket.GetAll(app.db)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		bans, err = model.M.Ban.GetAllActive(app.db)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
 	data := app.newTemplateData(r, map[string]any{
 		"disputes": disputes,
 		"tickets":  tickets,
+		"bans":     bans,
+		"scopes":   model.BanScopes,
 	})
 	app.render(w, r, http.StatusOK, "admin.html", data)
 }
 
+func (app *application) handleBan(w http.ResponseWriter, r *http.Request) {
+	form := banForm{}
+	if err := app.decodeForm(&form, r); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	user, err := model.M.User.GetWithName(app.db, form.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.addErrorNotes(r.Context(), "No such user")
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if form.ExpiresInDays != 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, form.ExpiresInDays), Valid: true}
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := model.M.Ban.GetAllForUser(tx, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	b, err := ban.Create(tx, user.ID, form.Scope, form.Reason, expiresAt, form.FreezeFunds)
+	if err != nil {
+		if errors.Is(err, ban.ErrInvalidScope) || errors.Is(err, ban.ErrInvalidExpiry) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	entry := audit.Entry{
+		StaffID: app.loggedInStaff(r).ID,
+		Action:  model.AuditBanUser,
+		Target:  user.ID.String(),
+		Before:  before,
+		After:   b,
+		Reason:  form.Reason,
+	}
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Customers are refunded by declining, which can't be undone with the ban
+	declined, err := ban.DeclineOpenOrders(app.db, user.ID)
+	if err != nil {
+		log.Error.Printf("failed to decline the orders of banned vendor %s: %s\n", user.ID, err.Error())
+		app.addErrorNotes(r.Context(), "Failed to decline all open orders of the user")
+	}
+	if declined > 0 {
+		app.addNotes(r.Context(), fmt.Sprintf("Declined %d open orders", declined))
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) handleForfeit(w http.ResponseWriter, r *http.Request) {
+	form := forfeitForm{}
+	if err := app.decodeForm(&form, r); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	vendor, err := model.M.User.GetWithName(app.db, form.Vendor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.addErrorNotes(r.Context(), "No such vendor")
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	// Without a recipient the funds go to the fees
+	recipientID := uuid.NullUUID{}
+	if form.Recipient != "" {
+		recipient, err := model.M.User.GetWithName(app.db, form.Recipient)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				app.addErrorNotes(r.Context(), "No such recipient")
+				app.redirectBack(w, r)
+				return
+			}
+			app.serverError(w, err)
+			return
+		}
+		recipientID = uuid.NullUUID{UUID: recipient.ID, Valid: true}
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := model.M.VendorPledge.GetForUser(tx, vendor.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.addErrorNotes(r.Context(), "User is not a vendor")
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	forfeit, err := pledge.Forfeit(tx, vendor.ID, uint64(form.AmountXMR*payment.XMRf), recipientID, form.Reason)
+	if err != nil {
+		if errors.Is(err, pledge.ErrInvalidAmount) || errors.Is(err, pledge.ErrForfeitTooLarge) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	entry := audit.Entry{
+		StaffID: app.loggedInStaff(r).ID,
+		Action:  model.AuditForfeitPledge,
+		Target:  vendor.ID.String(),
+		Before:  before,
+		After:   forfeit,
+		Reason:  form.Reason,
+	}
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.addNotes(r.Context(), fmt.Sprintf("Forfeited %s XMR of the pledge of %s", payment.XMR2Decimal(forfeit.Amount), vendor.Username))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
 func (app *application) handleOperation(w http.ResponseWriter, r *http.Request) {
 	form := deleteForm{}
 	if err := app.decodeForm(&form, r); err != nil {
@@ -47,32 +302,207 @@ func (app *application) handleOperation(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	switch form.Operation {
-	case "banUser":
-		if _, err := model.M.Ban.Create(app.db, form.ID); err != nil {
-			app.serverError(w, err)
+	role, ok := operationRoles[form.Operation]
+	if !ok {
+		log.Info.Printf("Unknown operation: %s\n", form.Operation)
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	s := app.loggedInStaff(r)
+	if !s.HasRole(role) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	entry, err := runOperation(tx, form.Operation, form.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.addErrorNotes(r.Context(), "Nothing found with the ID")
+			app.redirectBack(w, r)
 			return
 		}
+		app.serverError(w, err)
+		return
+	}
+
+	entry.StaffID = s.ID
+	entry.Reason = form.Reason
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Runs the operation of handleOperation and describes it for the audit log
+func runOperation(tx *sql.Tx, operation string, id uuid.UUID) (audit.Entry, error) {
+	switch operation {
 	case "deleteBan":
-		if err := model.M.Ban.Delete(app.db, form.ID); err != nil {
-			app.serverError(w, err)
-			return
+		ban, err := model.M.Ban.Get(tx, id)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		if err := model.M.Ban.Delete(tx, id); err != nil {
+			return audit.Entry{}, err
 		}
+		return audit.Entry{Action: model.AuditDeleteBan, Target: id.String(), Before: ban}, nil
 	case "deleteListing":
-		if err := model.M.Product.Delete(app.db, form.ID); err != nil {
-			app.serverError(w, err)
-			return
+		product, err := model.M.Product.Get(tx, id)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		if err := model.M.Product.Delete(tx, id); err != nil {
+			return audit.Entry{}, err
 		}
+		return audit.Entry{Action: model.AuditDeleteListing, Target: id.String(), Before: product}, nil
 	case "deleteReview":
-		if err := model.M.Review.Delete(app.db, form.ID); err != nil {
-			app.serverError(w, err)
+		review, err := model.M.Review.Get(tx, id)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		if err := model.M.Review.Delete(tx, id); err != nil {
+			return audit.Entry{}, err
+		}
+		return audit.Entry{Action: model.AuditDeleteReview, Target: id.String(), Before: review}, nil
+	case "deleteVendorCommission":
+		commission, err := model.M.VendorCommission.Get(tx, id)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		if err := fee.RemoveVendorCommission(tx, id); err != nil {
+			return audit.Entry{}, err
+		}
+		return audit.Entry{Action: model.AuditDeleteVendorCommission, Target: id.String(), Before: commission}, nil
+	}
+
+	return audit.Entry{}, fmt.Errorf("unknown operation %s", operation)
+}
+
+func (app *application) categories(w http.ResponseWriter, r *http.Request) {
+	categories, err := model.M.Category.GetAll(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r, map[string]any{
+		"categories": category.Tree(categories),
+	})
+	app.render(w, r, http.StatusOK, "categories.html", data)
+}
+
+func (app *application) handleCategory(w http.ResponseWriter, r *http.Request) {
+	form := categoryForm{}
+	if err := app.decodeForm(&form, r); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	entry, err := runCategoryOperation(tx, form)
+	if err != nil {
+		if errors.Is(err, category.ErrInvalidName) ||
+			errors.Is(err, category.ErrDuplicateName) ||
+			errors.Is(err, category.ErrNoSuchCategory) ||
+			errors.Is(err, category.ErrCycle) ||
+			errors.Is(err, category.ErrHasSubcategories) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
 			return
 		}
-	default:
-		log.Error.Printf("Unknown operation: %s\n", form.Operation)
+		if errors.Is(err, sql.ErrNoRows) {
+			app.addErrorNotes(r.Context(), "Nothing found with the ID")
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	entry.StaffID = app.loggedInStaff(r).ID
+	entry.Reason = form.Reason
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/categories", http.StatusSeeOther)
+}
+
+// Runs the operation of handleCategory and describes it for the audit log
+func runCategoryOperation(tx *sql.Tx, form categoryForm) (audit.Entry, error) {
+	parentID := uuid.NullUUID{UUID: form.ParentID, Valid: form.ParentID != uuid.Nil}
+
+	switch form.Operation {
+	case "create":
+		c, err := category.Create(tx, form.Name, parentID)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		return audit.Entry{Action: model.AuditCreateCategory, Target: c.ID.String(), After: c}, nil
+	case "rename":
+		before, err := model.M.Category.Get(tx, form.ID)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		c, err := category.Rename(tx, form.ID, form.Name)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		return audit.Entry{Action: model.AuditRenameCategory, Target: c.ID.String(), Before: before, After: c}, nil
+	case "move":
+		before, err := model.M.Category.Get(tx, form.ID)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		c, err := category.Move(tx, form.ID, parentID)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		return audit.Entry{Action: model.AuditMoveCategory, Target: c.ID.String(), Before: before, After: c}, nil
+	case "delete":
+		c, err := category.Delete(tx, form.ID)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		return audit.Entry{Action: model.AuditDeleteCategory, Target: c.ID.String(), Before: c}, nil
+	case "moveListing":
+		before, err := model.M.Product.Get(tx, form.ID)
+		if err != nil {
+			return audit.Entry{}, err
+		}
+		if err := category.MoveListing(tx, form.ID, parentID); err != nil {
+			return audit.Entry{}, err
+		}
+		after := *before
+		after.CategoryID = parentID
+		return audit.Entry{Action: model.AuditMoveListing, Target: form.ID.String(), Before: before, After: after}, nil
+	}
+
+	return audit.Entry{}, fmt.Errorf("unknown category operation %s", form.Operation)
 }
 
 func (app *application) dispute(w http.ResponseWriter, r *http.Request) {
@@ -101,10 +531,17 @@ func (app *application) dispute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	timeline, err := view.V.Order.Timeline(app.db, dispute.OrderID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	data := app.newTemplateData(r, map[string]any{
-		"dispute": dispute,
-		"counter": counter,
-		"order":   order,
+		"dispute":  dispute,
+		"counter":  counter,
+		"order":    order,
+		"timeline": timeline,
 	})
 	app.render(w, r, http.StatusOK, "handle-dispute.html", data)
 }
@@ -116,7 +553,43 @@ func (app *application) handleDispute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := dispute.CreateDisputeDecision(app.db, form.DisputeID, form.Outcome, form.Reason); err != nil {
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := model.M.Dispute.Get(tx, form.DisputeID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	decision, err := dispute.CreateDisputeDecision(tx, form.DisputeID, form.Outcome, form.Reason, model.AdminActor)
+	if err != nil {
+		if errors.Is(err, model.ErrIllegalTransition) {
+			app.addErrorNotes(r.Context(), "Dispute has already been settled")
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	entry := audit.Entry{
+		StaffID: app.loggedInStaff(r).ID,
+		Action:  model.AuditDisputeDecision,
+		Target:  form.DisputeID.String(),
+		Before:  before,
+		After:   decision,
+		Reason:  form.Reason,
+	}
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		app.serverError(w, err)
 		return
 	}
@@ -160,16 +633,40 @@ func (app *application) handleTicket(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	if _, err := model.M.TicketResponse.Create(tx, form.Message, form.TicketID, "admin"); err != nil {
+	before, err := model.M.Ticket.Get(tx, form.TicketID)
+	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	response, err := model.M.TicketResponse.Create(tx, form.Message, form.TicketID, "admin")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	entry := audit.Entry{
+		StaffID: app.loggedInStaff(r).ID,
+		Action:  model.AuditTicketResponse,
+		Target:  form.TicketID.String(),
+		Before:  before,
+		After:   map[string]any{"ticket": before, "response": response},
+		// The response explains the action to the user as well
+		Reason: form.Message,
+	}
+
 	if form.CloseTicket {
-		if _, err := model.M.Ticket.Close(tx, form.TicketID); err != nil {
+		after, err := model.M.Ticket.Close(tx, form.TicketID)
+		if err != nil {
 			app.serverError(w, err)
 			return
 		}
+		entry.Action = model.AuditCloseTicket
+		entry.After = map[string]any{"ticket": after, "response": response}
+	}
+
+	if !app.recordAudit(w, r, tx, entry) {
+		return
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -179,3 +676,252 @@ func (app *application) handleTicket(w http.ResponseWriter, r *http.Request) {
 
 	app.redirectBack(w, r)
 }
+
+func (app *application) fees(w http.ResponseWriter, r *http.Request) {
+	current, err := fee.Current(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	history, err := model.M.FeeSchedule.GetAll(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	commissions, err := model.M.VendorCommission.GetAll(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Current tiers and a couple of empty rows for new ones
+	tiers := make([]feeTierForm, 0, len(current.Tiers)+2)
+	for _, t := range current.Tiers {
+		tiers = append(tiers, feeTierForm{MinSales: t.MinSales, CommissionBps: t.CommissionBps})
+	}
+	tiers = append(tiers, feeTierForm{}, feeTierForm{})
+
+	unknown, err := model.M.Withdrawal.GetAllWithStatus(app.db, model.WithdrawalUnknown)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r, map[string]any{
+		"current":     current,
+		"tiers":       tiers,
+		"history":     history,
+		"commissions": commissions,
+		"withdrawals": unknown,
+	})
+	app.render(w, r, http.StatusOK, "fees.html", data)
+}
+
+func (app *application) handleFees(w http.ResponseWriter, r *http.Request) {
+	form := feeScheduleForm{}
+	if err := app.decodeForm(&form, r); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tiers := make([]fee.Tier, 0, len(form.Tiers))
+	for _, t := range form.Tiers {
+		// Empty rows of the form
+		if t.MinSales <= 0 {
+			continue
+		}
+		tiers = append(tiers, fee.Tier{MinSales: t.MinSales, CommissionBps: t.CommissionBps})
+	}
+
+	// Negative, NaN and too large amounts don't convert to an uint64
+	if !(form.PledgeXMR > 0) || form.PledgeXMR*payment.XMRf >= math.MaxUint64 {
+		app.addErrorNotes(r.Context(), fee.ErrInvalidPledge.Error())
+		app.redirectBack(w, r)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := fee.Current(tx)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	pledgeAmount := uint64(form.PledgeXMR * payment.XMRf)
+	schedule, err := fee.Publish(tx, form.CommissionBps, form.WithdrawalFee, form.WithdrawalMin, pledgeAmount, tiers)
+	if err != nil {
+		if errors.Is(err, fee.ErrInvalidCommission) || errors.Is(err, fee.ErrInvalidWithdrawal) || errors.Is(err, fee.ErrDuplicateTier) || errors.Is(err, fee.ErrInvalidPledge) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	entry := audit.Entry{
+		StaffID: app.loggedInStaff(r).ID,
+		Action:  model.AuditPublishFees,
+		Target:  schedule.ID.String(),
+		Before:  before,
+		After:   schedule,
+		Reason:  form.Reason,
+	}
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	log.Info.Printf("Published fee schedule version %d\n", schedule.Version)
+	http.Redirect(w, r, "/fees", http.StatusSeeOther)
+}
+
+func (app *application) handleVendorCommission(w http.ResponseWriter, r *http.Request) {
+	form := vendorCommissionForm{}
+	if err := app.decodeForm(&form, r); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	vendor, err := model.M.User.GetWithName(app.db, form.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.addErrorNotes(r.Context(), "No such user")
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := model.M.VendorCommission.Get(tx, vendor.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.serverError(w, err)
+		return
+	}
+
+	if err := fee.SetVendorCommission(tx, vendor.ID, form.CommissionBps); err != nil {
+		if errors.Is(err, fee.ErrInvalidCommission) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	after, err := model.M.VendorCommission.Get(tx, vendor.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	entry := audit.Entry{
+		StaffID: app.loggedInStaff(r).ID,
+		Action:  model.AuditSetVendorCommission,
+		Target:  vendor.ID.String(),
+		Before:  before,
+		After:   after,
+		Reason:  form.Reason,
+	}
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/fees", http.StatusSeeOther)
+}
+
+func (app *application) handleResolveWithdrawal(w http.ResponseWriter, r *http.Request) {
+	form := resolveWithdrawalForm{}
+	if err := app.decodeForm(&form, r); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	tx, err := app.db.Begin()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := model.M.Withdrawal.Get(tx, form.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	after, err := payment.ResolveWithdrawal(tx, app.walletBackend, form.ID, strings.TrimSpace(form.TxHash))
+	if err != nil {
+		if errors.Is(err, payment.ErrWithdrawalNotUnknown) || errors.Is(err, payment.ErrInvalidTxHash) || errors.Is(err, payment.ErrTxFailed) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	entry := audit.Entry{
+		StaffID: app.loggedInStaff(r).ID,
+		Action:  model.AuditResolveWithdrawal,
+		Target:  form.ID.String(),
+		Before:  before,
+		After:   after,
+		Reason:  form.Reason,
+	}
+	if !app.recordAudit(w, r, tx, entry) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	log.Info.Printf("Withdrawal %s resolved as %s\n", after.ID, after.Status)
+	http.Redirect(w, r, "/fees", http.StatusSeeOther)
+}
+
+func (app *application) auditLog(w http.ResponseWriter, r *http.Request) {
+	events, err := model.M.Audit.GetAll(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	problems := audit.Verify(events)
+
+	// Newest first on the page
+	slices.Reverse(events)
+
+	data := app.newTemplateData(r, map[string]any{
+		"events":   events,
+		"problems": problems,
+	})
+	app.render(w, r, http.StatusOK, "audit.html", data)
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"LuomuTori/internal/log"
 	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/audit"
 	"LuomuTori/internal/service/captcha"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"math"
@@ -35,23 +38,33 @@ func (app *application) redirectBack(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// NOTE: Check that each handle where this is called is wrapped in requireAuth middleware
-func (app *application) loggedInUser(req *http.Request) *model.User {
-	ctx := req.Context()
-	key := "userID"
-	if app.sessionManager.Exists(ctx, key) {
-		uid, ok := app.sessionManager.Get(ctx, key).(uuid.UUID)
-		if !ok {
-			return nil
-		}
-		user, err := model.M.User.Get(app.db, uid)
-		if err != nil {
-			return nil
-		}
-		return user
+// NOTE: Check that each handle where this is called is wrapped in requireStaff middleware
+func (app *application) loggedInStaff(req *http.Request) *model.Staff {
+	id, ok := app.sessionManager.Get(req.Context(), "staffID").(uuid.UUID)
+	if !ok {
+		return nil
 	}
 
-	return nil
+	staff, err := model.M.Staff.Get(app.db, id)
+	if err != nil || staff.IsDisabled() {
+		return nil
+	}
+
+	return staff
+}
+
+// Writes the audit event or responds with an error. Returns whether the handler may continue.
+func (app *application) recordAudit(w http.ResponseWriter, r *http.Request, tx *sql.Tx, entry audit.Entry) bool {
+	if _, err := audit.Record(tx, entry); err != nil {
+		if errors.Is(err, audit.ErrNoReason) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return false
+		}
+		app.serverError(w, err)
+		return false
+	}
+	return true
 }
 
 func (app *application) renderInvalidForm(w http.ResponseWriter, r *http.Request, page string, form any) {
@@ -89,13 +102,29 @@ func (app *application) validateCaptcha(ctx context.Context, answer CaptchaAnswe
 	return math.Pow(float64(solution.X-answer.X), 2)+math.Pow(float64(solution.Y-answer.Y), 2) < math.Pow(float64(solution.Radius), 2)
 }
 
-func (app *application) addNotes(ctx context.Context, notes ...string) {
+func (app *application) addNotes(ctx context.Context, messages ...string) {
 	const key = "notes"
-	tmp, ok := app.sessionManager.Get(ctx, key).([]string)
+	tmp, ok := app.sessionManager.Get(ctx, key).([]Note)
 	if !ok {
-		tmp = notes
-	} else {
-		tmp = append(tmp, notes...)
+		tmp = []Note{}
+	}
+
+	for _, msg := range messages {
+		tmp = append(tmp, Note{msg, false})
+	}
+
+	app.sessionManager.Put(ctx, key, tmp)
+}
+
+func (app *application) addErrorNotes(ctx context.Context, messages ...string) {
+	const key = "notes"
+	tmp, ok := app.sessionManager.Get(ctx, key).([]Note)
+	if !ok {
+		tmp = []Note{}
+	}
+
+	for _, msg := range messages {
+		tmp = append(tmp, Note{msg, true})
 	}
 
 	app.sessionManager.Put(ctx, key, tmp)
@@ -31,6 +31,7 @@ type application struct {
 	templateCache  map[string]*template.Template
 	schemaDecoder  *schema.Decoder
 	sessionManager *scs.SessionManager
+	walletBackend  payment.WalletBackend
 }
 
 type service struct {
@@ -44,6 +45,7 @@ func main() {
 
 	gob.Register(captcha.Solution{})
 	gob.Register(uuid.UUID{})
+	gob.Register([]Note{})
 
 	if err := translate.LoadTranslations(); err != nil {
 		log.Error.Fatalf("Failed to load translations: %s\n", err.Error())
@@ -64,12 +66,21 @@ func main() {
 
 	sessionManager := scs.New()
 	sessionManager.Store = postgresstore.New(db)
+	// Sessions of the store are never valid here
+	sessionManager.Cookie.Name = "admin_session"
+
+	// Withdrawals are checked against the wallet when staff resolves them
+	walletBackend, err := payment.NewWalletBackend(config.WalletBackend, config.MoneropayURL, config.InternalAddr, config.WalletRPCURL)
+	if err != nil {
+		log.Error.Fatalf("Invalid wallet backend: %s\n", err.Error())
+	}
 
 	app := application{
 		db:             db,
 		templateCache:  tc,
 		schemaDecoder:  schema.NewDecoder(),
 		sessionManager: sessionManager,
+		walletBackend:  walletBackend,
 	}
 
 	srv := http.Server{
@@ -78,8 +89,16 @@ func main() {
 		Handler:  app.route(),
 	}
 
+	rateProviders, err := payment.NewRateProviders(config.RateProviders, config.RateFile, config.StaticRate)
+	if err != nil {
+		log.Error.Fatalf("Invalid rate providers: %s\n", err.Error())
+	}
+	payment.SetRateProviders(rateProviders...)
+	payment.MaxRateAge = config.RateMaxAge
+
+	// Not fatal, ordering is refused until a fresh rate is available
 	if err := payment.UpdateXMRPrice(); err != nil {
-		log.Error.Fatalf("Failed to update XMR price: %s\n", err.Error())
+		log.Error.Printf("Failed to update XMR price: %s\n", err.Error())
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -88,10 +107,10 @@ func main() {
 	services := []service{
 		{
 			name:     "XMR price",
-			interval: time.Hour,
+			interval: 15 * time.Minute,
 			job: func() {
 				if err := payment.UpdateXMRPrice(); err != nil {
-					log.Error.Fatalf("Failed to update XMR price: %s\n", err.Error())
+					log.Error.Printf("Failed to update XMR price: %s\n", err.Error())
 				}
 			},
 		},
@@ -3,7 +3,7 @@ package main
 import (
 	"LuomuTori/internal/log"
 	"LuomuTori/internal/model"
-	"github.com/google/uuid"
+	"github.com/justinas/alice"
 	"net/http"
 )
 
@@ -28,22 +28,25 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) requireAuth(next http.Handler) http.Handler {
+func (app *application) requireStaff(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.sessionManager.Exists(r.Context(), "userID") {
+		if staff := app.loggedInStaff(r); staff != nil {
 			next.ServeHTTP(w, r)
 		} else {
-			app.clientError(w, http.StatusUnauthorized)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
 		}
 	})
 }
 
-func (app *application) requireVendor(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if uid, ok := app.sessionManager.Get(r.Context(), "userID").(uuid.UUID); ok && model.M.User.IsVendor(app.db, uid) {
-			next.ServeHTTP(w, r)
-		} else {
-			app.clientError(w, http.StatusUnauthorized)
-		}
-	})
+// Wrap inside requireStaff
+func (app *application) requireRole(role model.StaffRole) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if staff := app.loggedInStaff(r); staff != nil && staff.HasRole(role) {
+				next.ServeHTTP(w, r)
+			} else {
+				app.clientError(w, http.StatusForbidden)
+			}
+		})
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"LuomuTori/internal/config"
+	"LuomuTori/internal/model"
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 	"net/http"
@@ -16,13 +17,33 @@ func (app *application) route() http.Handler {
 	cssServer := http.FileServer(http.Dir(config.CssDir))
 	r.Handler(http.MethodGet, "/ui/css/*filepath", http.StripPrefix("/ui/css/", cssServer))
 
-	r.HandlerFunc(http.MethodGet, "/", app.admin)
-	r.HandlerFunc(http.MethodGet, "/dispute", app.dispute)
-	r.HandlerFunc(http.MethodGet, "/ticket", app.ticket)
+	r.HandlerFunc(http.MethodGet, "/login", app.login)
+	r.HandlerFunc(http.MethodPost, "/login", app.handleLogin)
 
-	r.HandlerFunc(http.MethodPost, "/delete", app.handleOperation)
-	r.HandlerFunc(http.MethodPost, "/dispute", app.handleDispute)
-	r.HandlerFunc(http.MethodPost, "/ticket", app.handleTicket)
+	requireStaff := alice.New(app.requireStaff)
+	requireModerator := requireStaff.Append(app.requireRole(model.RoleModerator))
+	requireArbiter := requireStaff.Append(app.requireRole(model.RoleArbiter))
+	requireFinance := requireStaff.Append(app.requireRole(model.RoleFinance))
+	requireSuperadmin := requireStaff.Append(app.requireRole(model.RoleSuperadmin))
+
+	r.Handler(http.MethodGet, "/", requireStaff.ThenFunc(app.admin))
+	r.Handler(http.MethodGet, "/dispute", requireArbiter.ThenFunc(app.dispute))
+	r.Handler(http.MethodGet, "/ticket", requireModerator.ThenFunc(app.ticket))
+	r.Handler(http.MethodGet, "/fees", requireFinance.ThenFunc(app.fees))
+	r.Handler(http.MethodGet, "/categories", requireModerator.ThenFunc(app.categories))
+	r.Handler(http.MethodGet, "/audit", requireSuperadmin.ThenFunc(app.auditLog))
+
+	r.Handler(http.MethodPost, "/logout", requireStaff.ThenFunc(app.handleLogout))
+	r.Handler(http.MethodPost, "/ban", requireModerator.ThenFunc(app.handleBan))
+	// Role depends on the operation
+	r.Handler(http.MethodPost, "/delete", requireStaff.ThenFunc(app.handleOperation))
+	r.Handler(http.MethodPost, "/dispute", requireArbiter.ThenFunc(app.handleDispute))
+	r.Handler(http.MethodPost, "/pledge/forfeit", requireArbiter.ThenFunc(app.handleForfeit))
+	r.Handler(http.MethodPost, "/ticket", requireModerator.ThenFunc(app.handleTicket))
+	r.Handler(http.MethodPost, "/fees", requireFinance.ThenFunc(app.handleFees))
+	r.Handler(http.MethodPost, "/categories", requireModerator.ThenFunc(app.handleCategory))
+	r.Handler(http.MethodPost, "/fees/vendor", requireFinance.ThenFunc(app.handleVendorCommission))
+	r.Handler(http.MethodPost, "/withdrawals/resolve", requireFinance.ThenFunc(app.handleResolveWithdrawal))
 
 	secure := alice.New(setSecureHeaders, app.logRequest, app.sessionManager.LoadAndSave)
 	return secure.Then(r)
@@ -3,10 +3,12 @@ package main
 import (
 	"LuomuTori/internal/model"
 	"LuomuTori/internal/service/payment"
+	"LuomuTori/internal/service/upload"
 	"LuomuTori/internal/translate"
 	"bytes"
 	"fmt"
 	"html/template"
+	"math"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -53,6 +55,11 @@ func Iterate(start, end int) []int {
 	return items
 }
 
+// Share in [0, 1] as a whole percentage
+func Percent(share float64) int {
+	return int(math.Round(share * 100))
+}
+
 func FmtTime(t time.Time) string {
 	return t.Format("15:04:05 02-01-2006")
 }
@@ -79,11 +86,19 @@ func NewTemplateCache() (map[string]*template.Template, error) {
 			"XMR2Fiat": func(xmr uint64) int {
 				return int(payment.XMR2Fiat(xmr))
 			},
-			"T":       translate.T,
-			"Head":    Head,
-			"Iterate": Iterate,
-			"FmtTime": FmtTime,
-			"FmtDate": FmtDate,
+			"XMR2FiatIn":   payment.XMR2FiatIn,
+			"FmtFiat":      payment.FmtFiat,
+			"DisplayPrice": payment.DisplayPrice,
+			"Currencies": func() []model.Currency {
+				return model.Currencies
+			},
+			"T":         translate.T,
+			"Head":      Head,
+			"Iterate":   Iterate,
+			"FmtTime":   FmtTime,
+			"FmtDate":   FmtDate,
+			"Percent":   Percent,
+			"Thumbnail": upload.ThumbnailPath,
 		})
 
 		ts, err := ts.ParseFiles("./ui/html/base.html")
@@ -132,12 +147,19 @@ func (app *application) render(w http.ResponseWriter, req *http.Request, status
 	buf.WriteTo(w)
 }
 
+type Note struct {
+	Message string
+	IsError bool
+}
+
 type templateData struct {
-	Form  any
-	Data  map[string]any
-	User  *model.User
-	Lang  string
-	Notes []string
+	Form     any
+	Data     map[string]any
+	User     *model.User
+	Staff    *model.Staff
+	Lang     string
+	Currency model.Currency
+	Notes    []Note
 }
 
 func (app *application) newTemplateData(req *http.Request, data map[string]any) *templateData {
@@ -145,16 +167,9 @@ func (app *application) newTemplateData(req *http.Request, data map[string]any)
 		data = make(map[string]any)
 	}
 
-	user := app.loggedInUser(req)
-	if user != nil {
-		wallet, _ := model.M.Wallet.GetForUser(app.db, user.ID)
-		if wallet != nil {
-			data["wallet"] = wallet
-		}
-		data["isVendor"] = model.M.User.IsVendor(app.db, user.ID)
-	} else {
-		data["isVendor"] = false
-	}
+	// Staff are not users of the store
+	data["isVendor"] = false
+	staff := app.loggedInStaff(req)
 
 	lang := func() string {
 		res := app.sessionManager.GetString(req.Context(), "Lang")
@@ -167,12 +182,13 @@ func (app *application) newTemplateData(req *http.Request, data map[string]any)
 	}()
 
 	// Notes are only viewed once
-	notes, _ := app.sessionManager.Pop(req.Context(), "notes").([]string)
+	notes, _ := app.sessionManager.Pop(req.Context(), "notes").([]Note)
 
 	return &templateData{
-		Data:  data,
-		User:  user,
-		Lang:  lang,
-		Notes: notes,
+		Data:     data,
+		Staff:    staff,
+		Lang:     lang,
+		Currency: model.CurrencyEUR,
+		Notes:    notes,
 	}
 }
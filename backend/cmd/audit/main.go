@@ -0,0 +1,75 @@
+package main
+
+// Command line tool to verify the hash chain of the audit log.
+// Keep the printed head hash somewhere else and pass it with -head on the next run,
+// that way also events removed from the end of the log are detected.
+
+import (
+	"LuomuTori/internal/config"
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/audit"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"log"
+	"os"
+)
+
+func main() {
+	var head string
+	flag.StringVar(&head, "head", "", "hex encoded hash of an event printed by an earlier run, which must still be in the log")
+	config.Parse()
+
+	db, err := openDB(config.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	events, err := model.M.Audit.GetAll(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ok := true
+	for _, p := range audit.Verify(events) {
+		log.Println(p)
+		ok = false
+	}
+
+	if head != "" {
+		hash, err := hex.DecodeString(head)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !audit.Contains(events, hash) {
+			log.Printf("event with hash %s has been removed\n", head)
+			ok = false
+		}
+	}
+
+	if len(events) > 0 {
+		last := events[len(events)-1]
+		log.Printf("%d events, head %d %s\n", len(events), last.ID, hex.EncodeToString(last.Hash))
+	} else {
+		log.Println("audit log is empty")
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
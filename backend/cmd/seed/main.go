@@ -6,6 +6,8 @@ import (
 	"LuomuTori/internal/config"
 	"LuomuTori/internal/model"
 	"LuomuTori/internal/service/auth"
+	"LuomuTori/internal/service/ledger"
+	"LuomuTori/internal/service/payment"
 	"LuomuTori/internal/service/pledge"
 	"LuomuTori/internal/service/product"
 	"database/sql"
@@ -238,6 +240,18 @@ func imageFilenames(dir string) []string {
 
 func main() {
 	config.Parse()
+	random, err := payment.SetCallbackSecret(config.CallbackSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if random {
+		// Callbacks of the seeded invoices are rejected by the store, polling still finds their deposits
+		log.Println("No callback secret set, using a random one")
+	}
+	wallet, err := payment.NewWalletBackend(config.WalletBackend, config.MoneropayURL, config.InternalAddr, config.WalletRPCURL)
+	if err != nil {
+		log.Fatal(err)
+	}
 	db, err := openDB(config.DSN)
 	if err != nil {
 		log.Fatal(err)
@@ -247,7 +261,7 @@ func main() {
 	var uids = []uuid.UUID{}
 	log.Println("Creating some users")
 	for _, vendor := range vendors {
-		u, err := auth.Register(db, vendor.name, vendor.name+"123", "")
+		u, err := auth.Register(db, wallet, vendor.name, vendor.name+"123", "")
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -259,7 +273,7 @@ func main() {
 			log.Fatal(err)
 		}
 
-		if _, err := model.M.Wallet.AddBalance(db, wallet.ID, 10000000000000); err != nil {
+		if err := ledger.Transfer(db, model.LedgerDeposit, wallet.ID, ledger.Deposits, ledger.To(ledger.User(u.ID), 10000000000000)); err != nil {
 			log.Fatal(err)
 		}
 
@@ -274,9 +288,13 @@ func main() {
 			db,
 			listing.title,
 			listing.description,
-			listing.image,
+			[]string{listing.image},
 			listing.pricing,
 			listing.deliveryMethods,
+			model.CurrencyEUR,
+			product.Stock{},
+			uuid.NullUUID{},
+			"",
 			selectRandom(uids))
 		if err != nil {
 			log.Fatal(err)
@@ -305,11 +323,15 @@ func main() {
 			customerID = selectRandom(uids)
 		}
 
-		order, err := model.M.Order.Create(db, price.ID, dm.ID, customerID, model.StatusCompleted, selectRandom(deliveryDetails))
+		order, err := model.M.Order.Create(db, product.VendorID, dm.ID, customerID, model.StatusCompleted, selectRandom(deliveryDetails))
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		if _, err := model.M.OrderItem.Create(db, order.ID, price.ID, 1, price.Price); err != nil {
+			log.Fatal(err)
+		}
+
 		if _, err := model.M.DeliveryInfo.Create(db, "Lähetystunnus: 0x12f72ad33069420", order.ID); err != nil {
 			log.Fatal(err)
 		}
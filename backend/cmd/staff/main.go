@@ -0,0 +1,65 @@
+package main
+
+// Command line tool to create staff accounts for the admin console
+
+import (
+	"LuomuTori/internal/config"
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/staff"
+	"database/sql"
+	"flag"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	var username, password, pgpKeyFile, roles string
+	flag.StringVar(&username, "username", "", "username of the staff member")
+	flag.StringVar(&password, "password", "", "password of the staff member")
+	flag.StringVar(&pgpKeyFile, "pgp-key", "", "file containing the armored PGP public key of the staff member")
+	flag.StringVar(&roles, "roles", "", "comma separated roles: moderator, arbiter, finance, superadmin")
+	config.Parse()
+
+	if username == "" || password == "" || pgpKeyFile == "" || roles == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pgpKey, err := os.ReadFile(pgpKeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	staffRoles := make([]model.StaffRole, 0)
+	for _, role := range strings.Split(roles, ",") {
+		staffRoles = append(staffRoles, model.StaffRole(strings.TrimSpace(role)))
+	}
+
+	db, err := openDB(config.DSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	s, err := staff.Create(db, username, password, string(pgpKey), staffRoles)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Created staff member %s (%s)\n", s.Username, s.ID)
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
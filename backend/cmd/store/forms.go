@@ -1,6 +1,7 @@
 package main
 
 import (
+	"LuomuTori/internal/model"
 	"LuomuTori/internal/service/product"
 	"LuomuTori/internal/validate"
 	"github.com/google/uuid"
@@ -49,13 +50,63 @@ type createListingForm struct {
 	Description     string
 	DeliveryMethods []product.DeliveryMethod
 	Pricings        []product.Pricing
+	Currency        model.Currency
+	TrackStock      bool
+	Stock           int
+	LowStock        int
+	// Nil for uncategorized
+	CategoryID uuid.UUID
+	// Comma separated
+	Tags string
 	validate.Validator
 }
 
-type orderForm struct {
-	PriceID          uuid.UUID
+type editListingForm struct {
+	ProductID       uuid.UUID
+	Title           string
+	Description     string
+	DeliveryMethods []product.DeliveryMethod
+	Pricings        []product.Pricing
+	validate.Validator
+}
+
+// Rows in the pricing and delivery tables of the edit form, like in the create form
+const (
+	editPricingRows  = 6
+	editDeliveryRows = 4
+)
+
+// Pads the tables with empty rows so more pricings and delivery methods can be added
+func (f *editListingForm) withEmptyRows() *editListingForm {
+	for len(f.Pricings) < editPricingRows {
+		f.Pricings = append(f.Pricings, product.Pricing{})
+	}
+	for len(f.DeliveryMethods) < editDeliveryRows {
+		f.DeliveryMethods = append(f.DeliveryMethods, product.DeliveryMethod{})
+	}
+	return f
+}
+
+type cartForm struct {
+	PriceID uuid.UUID
+	Count   int
+	validate.Validator
+}
+
+type cartRemoveForm struct {
+	PriceID uuid.UUID
+	validate.Validator
+}
+
+type quoteForm struct {
+	VendorID         uuid.UUID
 	DeliveryMethodID uuid.UUID
-	Details          string
+	validate.Validator
+}
+
+type orderForm struct {
+	QuoteID uuid.UUID
+	Details string
 	validate.Validator
 }
 
@@ -83,6 +134,11 @@ type withdrawForm struct {
 	validate.Validator
 }
 
+type pledgeTopUpForm struct {
+	AmountXMR float64
+	validate.Validator
+}
+
 type declineForm struct {
 	OrderID uuid.UUID
 	Reason  string
@@ -100,6 +156,28 @@ type productDeleteForm struct {
 	validate.Validator
 }
 
+// Read from the query string, so every field of the search form must be here
+type productSearchForm struct {
+	Q         string
+	Category  string
+	Tag       string
+	Vendor    string
+	Delivery  string
+	MinPrice  int
+	MaxPrice  int
+	MinRating int
+	Sort      model.ProductSort
+	Page      int
+}
+
+type productStockForm struct {
+	ProductID  uuid.UUID
+	TrackStock bool
+	Stock      int
+	LowStock   int
+	validate.Validator
+}
+
 type ticketForm struct {
 	Subject string
 	Message string
@@ -7,25 +7,26 @@ import (
 	"LuomuTori/internal/model/view"
 	"LuomuTori/internal/service/auth"
 	"LuomuTori/internal/service/captcha"
+	"LuomuTori/internal/service/category"
 	"LuomuTori/internal/service/dispute"
+	"LuomuTori/internal/service/fee"
+	"LuomuTori/internal/service/ledger"
 	"LuomuTori/internal/service/order"
 	"LuomuTori/internal/service/payment"
 	"LuomuTori/internal/service/pgp"
 	"LuomuTori/internal/service/pledge"
 	"LuomuTori/internal/service/product"
+	"LuomuTori/internal/service/upload"
 	"LuomuTori/internal/translate"
 	"LuomuTori/internal/validate"
-	"encoding/json"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"image/png"
-	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
-
-	moneropay "gitlab.com/moneropay/moneropay/v2/pkg/model"
+	"strings"
 )
 
 const (
@@ -89,7 +90,7 @@ func (app *application) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := auth.Register(app.db, form.Username, form.Password, form.PgpKey)
+	_, err := auth.Register(app.db, app.walletBackend, form.Username, form.Password, form.PgpKey)
 	if err != nil {
 		if errors.Is(err, auth.ErrUsernameAlreadyRegistered) {
 			form.SetError(fmt.Sprintf("user %s has been already registered", form.Username))
@@ -137,6 +138,7 @@ func (app *application) handleLogin(w http.ResponseWriter, r *http.Request) {
 		} else if errors.Is(err, auth.ErrAccountIsBanned) {
 			app.addErrorNotes(r.Context(), "Your account is banned")
 			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
 		}
 		app.serverError(w, err)
 		return
@@ -144,8 +146,10 @@ func (app *application) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	if user.PgpKey == nil {
 		ctx := r.Context()
-		app.sessionManager.RenewToken(ctx)
-		app.sessionManager.Put(ctx, "userID", user.ID)
+		if err := app.startSession(ctx, user.ID); err != nil {
+			app.serverError(w, err)
+			return
+		}
 		if _, err := model.M.User.UpdatePrevLogin(app.db, user.ID); err != nil {
 			log.Error.Printf("failed to update previous login time: %s\n", err.Error())
 		}
@@ -195,8 +199,10 @@ func (app *application) handle2FA(w http.ResponseWriter, r *http.Request) {
 			app.serverError(w, fmt.Errorf("2FA Failed"))
 			return
 		}
-		app.sessionManager.Put(ctx, "userID", uid)
-		app.sessionManager.RenewToken(ctx)
+		if err := app.startSession(ctx, uid); err != nil {
+			app.serverError(w, err)
+			return
+		}
 		if _, err := model.M.User.UpdatePrevLogin(app.db, uid); err != nil {
 			log.Error.Printf("failed to update previous login time: %s\n", err.Error())
 		}
@@ -208,6 +214,9 @@ func (app *application) handle2FA(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) handleLogout(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	if err := model.M.UserSession.Delete(app.db, app.sessionManager.Token(ctx)); err != nil {
+		log.Error.Printf("failed to forget session: %s\n", err.Error())
+	}
 	app.sessionManager.Pop(ctx, "userID")
 	app.sessionManager.RenewToken(ctx)
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -293,6 +302,27 @@ func (app *application) handleEnable2FA(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
 }
 
+func (app *application) createListing(w http.ResponseWriter, r *http.Request) {
+	data, err := app.createListingData(r)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.render(w, r, http.StatusOK, "create-listing.html", data)
+}
+
+func (app *application) createListingData(r *http.Request) (*templateData, error) {
+	categories, err := model.M.Category.GetAll(app.db)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.newTemplateData(r, map[string]any{
+		"categories": category.Tree(categories),
+		"maxImages":  product.MaxImages,
+	}), nil
+}
+
 func (app *application) handleCreateListing(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseMultipartForm(maxMemory); err != nil {
 		log.Info.Printf("unable to parse form %s\n", err.Error())
@@ -307,85 +337,510 @@ func (app *application) handleCreateListing(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	form.CheckField(validate.AtleastNRunes(form.Title, 3), "Title", "Invalid title")
-	form.CheckField(validate.AtleastNRunes(form.Description, 3), "Description", "Invalid description")
+	checkListing(&form.Validator, form.Title, form.Description, form.Pricings, form.DeliveryMethods)
+	form.CheckField(model.ValidCurrency(form.Currency), "Currency", "Invalid currency")
+	form.CheckField(form.Stock >= 0 && form.LowStock >= 0, "Stock", "Stock can't be negative")
+	if _, err := product.ParseTags(form.Tags); err != nil {
+		form.CheckField(false, "Tags", err.Error())
+	}
 
-	for _, pricing := range form.Pricings {
-		bad := (pricing.Quantity == 0 && pricing.Price > 0) || pricing.Price < 0 || pricing.Quantity < 0
-		form.CheckField(!bad, "Pricing", "Invalid pricing")
-		if bad {
-			break
+	if !form.Valid() {
+		data, err := app.createListingData(r)
+		if err != nil {
+			app.serverError(w, err)
+			return
 		}
+		data.Form = form
+		app.render(w, r, http.StatusBadRequest, "create-listing.html", data)
+		return
 	}
 
-	for _, deliveryMethod := range form.DeliveryMethods {
-		bad := (deliveryMethod.Description == "" && deliveryMethod.Price > 0) || deliveryMethod.Price < 0
-		form.CheckField(!bad, "deliveryMethod", "Invalid deliverymethod")
-		if bad {
-			break
+	imageFilenames, err := saveProductImages(r)
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			log.Info.Printf("unable to read image file %s\n", err.Error())
+			app.clientError(w, http.StatusBadRequest)
+			return
+		} else if errors.Is(err, upload.ErrInvalidImage) || errors.Is(err, product.ErrTooManyImages) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
 		}
+		app.serverError(w, err)
+		return
 	}
 
-	if !form.Valid() {
-		data := app.newTemplateData(r, nil)
-		data.Form = form
-		app.render(w, r, http.StatusBadRequest, "create-listing.html", data)
+	user := app.loggedInUser(r)
+
+	listing, err := product.Create(
+		app.db,
+		form.Title,
+		form.Description,
+		imageFilenames,
+		form.Pricings,
+		form.DeliveryMethods,
+		form.Currency,
+		product.Stock{Tracked: form.TrackStock, Amount: form.Stock, LowStock: form.LowStock},
+		uuid.NullUUID{UUID: form.CategoryID, Valid: form.CategoryID != uuid.Nil},
+		form.Tags,
+		user.ID)
+	if err != nil {
+		if errors.Is(err, product.ErrNoSuchCategory) || errors.Is(err, product.ErrNoPricing) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
 		return
 	}
 
-	file, handler, err := r.FormFile("image")
+	app.addNotes(r.Context(), "Listing created!")
+	http.Redirect(w, r, fmt.Sprintf("/product?id=%s", listing.ID), http.StatusSeeOther)
+}
+
+func (app *application) editListing(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
 	if err != nil {
-		log.Info.Printf("unable to read image file %s\n", err.Error())
+		log.Info.Printf("Failed to parse id from url: %s\n", err.Error())
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	dst, err := os.Create(filepath.Join("uploads/product-images", handler.Filename))
+	listing, err := view.V.Product.Get(app.db, id)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.notFound(w)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, file)
-	if err != nil {
+	if listing.Product.VendorID != app.loggedInUser(r).ID || listing.Product.IsDeleted() {
+		app.notFound(w)
+		return
+	}
+
+	form := &editListingForm{
+		ProductID:       listing.Product.ID,
+		Title:           listing.Product.Title,
+		Description:     listing.Product.Description,
+		Pricings:        make([]product.Pricing, 0, editPricingRows),
+		DeliveryMethods: make([]product.DeliveryMethod, 0, editDeliveryRows),
+	}
+	for _, price := range listing.Prices {
+		form.Pricings = append(form.Pricings, product.Pricing{Quantity: price.Quantity, Price: price.Price})
+	}
+	for _, dm := range listing.DeliveryMethods {
+		form.DeliveryMethods = append(form.DeliveryMethods, product.DeliveryMethod{Description: dm.Description, Price: dm.Price})
+	}
+
+	data := app.newTemplateData(r, map[string]any{"product": listing, "maxImages": product.MaxImages})
+	data.Form = form.withEmptyRows()
+	app.render(w, r, http.StatusOK, "edit-listing.html", data)
+}
+
+func (app *application) handleEditListing(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		log.Info.Printf("unable to parse form %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := new(editListingForm)
+	if err := app.schemaDecoder.Decode(form, r.PostForm); err != nil {
+		log.Info.Printf("form decode failed %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	checkListing(&form.Validator, form.Title, form.Description, form.Pricings, form.DeliveryMethods)
+
+	if !form.Valid() {
+		listing, err := view.V.Product.Get(app.db, form.ProductID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		data := app.newTemplateData(r, map[string]any{"product": listing, "maxImages": product.MaxImages})
+		data.Form = form.withEmptyRows()
+		app.render(w, r, http.StatusBadRequest, "edit-listing.html", data)
+		return
+	}
+
+	// New images are optional, the current ones are kept without them
+	imageFilenames, err := saveProductImages(r)
+	if err != nil && !errors.Is(err, http.ErrMissingFile) {
+		if errors.Is(err, upload.ErrInvalidImage) || errors.Is(err, product.ErrTooManyImages) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
 
 	user := app.loggedInUser(r)
 
-	product, err := product.Create(
+	version, err := product.Edit(
 		app.db,
+		form.ProductID,
 		form.Title,
 		form.Description,
-		handler.Filename,
+		imageFilenames,
 		form.Pricings,
 		form.DeliveryMethods,
 		user.ID)
 	if err != nil {
+		if errors.Is(err, product.ErrNoSuchProduct) {
+			app.notFound(w)
+			return
+		} else if errors.Is(err, product.ErrNotVendor) {
+			log.Info.Printf("vendors can only edit their products")
+			app.clientError(w, http.StatusBadRequest)
+			return
+		} else if errors.Is(err, product.ErrNoPricing) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
 
-	app.addNotes(r.Context(), "Listing created!")
-	http.Redirect(w, r, fmt.Sprintf("/product?id=%s", product.ID), http.StatusSeeOther)
-}
+	app.addNotes(r.Context(), fmt.Sprintf("Listing updated to version %d!", version.Version))
+	http.Redirect(w, r, fmt.Sprintf("/product?id=%s", form.ProductID), http.StatusSeeOther)
+}
+
+// Checks the versioned part of a listing form
+func checkListing(v *validate.Validator, title, description string, pricings []product.Pricing, deliveryMethods []product.DeliveryMethod) {
+	v.CheckField(validate.AtleastNRunes(title, 3), "Title", "Invalid title")
+	v.CheckField(validate.AtleastNRunes(description, 3), "Description", "Invalid description")
+
+	for _, pricing := range pricings {
+		bad := (pricing.Quantity == 0 && pricing.Price > 0) || pricing.Price < 0 || pricing.Quantity < 0
+		v.CheckField(!bad, "Pricing", "Invalid pricing")
+		if bad {
+			break
+		}
+	}
+
+	for _, deliveryMethod := range deliveryMethods {
+		bad := (deliveryMethod.Description == "" && deliveryMethod.Price > 0) || deliveryMethod.Price < 0
+		v.CheckField(!bad, "deliveryMethod", "Invalid deliverymethod")
+		if bad {
+			break
+		}
+	}
+}
+
+// Saves the uploaded product images and their thumbnails and returns the filenames in upload order.
+// Returns http.ErrMissingFile if the form has no images.
+func saveProductImages(r *http.Request) ([]string, error) {
+	var headers []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		headers = r.MultipartForm.File["image"]
+	}
+	if len(headers) == 0 {
+		return nil, http.ErrMissingFile
+	}
+	if len(headers) > product.MaxImages {
+		return nil, product.ErrTooManyImages
+	}
+
+	filenames := make([]string, 0, len(headers))
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		filename, err := upload.SaveProductImage(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		filenames = append(filenames, filename)
+	}
+
+	return filenames, nil
+}
+
+func (app *application) products(w http.ResponseWriter, r *http.Request) {
+	form := &productSearchForm{}
+	if err := app.schemaDecoder.Decode(form, r.URL.Query()); err != nil {
+		log.Info.Printf("Failed to decode product search: %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	search := product.Search{
+		Text:           strings.TrimSpace(form.Q),
+		Tag:            form.Tag,
+		DeliveryMethod: strings.TrimSpace(form.Delivery),
+		MinPrice:       form.MinPrice,
+		MaxPrice:       form.MaxPrice,
+		MinRating:      form.MinRating,
+		Sort:           form.Sort,
+		Page:           max(form.Page, 1),
+	}
+	if form.Category != "" {
+		categoryID, err := uuid.Parse(form.Category)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		search.CategoryID = uuid.NullUUID{UUID: categoryID, Valid: true}
+	}
+	if form.Vendor != "" {
+		vendorID, err := uuid.Parse(form.Vendor)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		search.VendorID = uuid.NullUUID{UUID: vendorID, Valid: true}
+	}
+
+	data := app.newTemplateData(r, nil)
+
+	query := product.NewQuery(search, data.Lang, data.Currency)
+	products, total, err := view.V.Product.Search(app.db, query)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	vendors, err := model.M.Product.GetVendors(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	categories, err := model.M.Category.GetAll(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	breadcrumbs := make([]model.Category, 0)
+	if search.CategoryID.Valid {
+		breadcrumbs, err = model.M.Category.GetPath(app.db, search.CategoryID.UUID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if len(breadcrumbs) == 0 {
+			app.notFound(w)
+			return
+		}
+	}
+
+	numPages := product.NumPages(total)
+	data.Form = form
+	data.Data["products"] = products
+	data.Data["vendors"] = vendors
+	data.Data["breadcrumbs"] = breadcrumbs
+	data.Data["subcategories"] = category.Children(categories, search.CategoryID)
+	data.Data["sorts"] = model.ProductSorts
+	data.Data["sort"] = query.Sort
+	data.Data["total"] = total
+	data.Data["page"] = search.Page
+	data.Data["numPages"] = numPages
+	if search.Page > 1 {
+		data.Data["prevPage"] = pageURL(r, search.Page-1)
+	}
+	if search.Page < numPages {
+		data.Data["nextPage"] = pageURL(r, search.Page+1)
+	}
+	app.render(w, r, http.StatusOK, "products.html", data)
+}
+
+func (app *application) product(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.URL.Query().Get("id"))
+	if err != nil {
+		log.Info.Printf("Failed to parse id from url: %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	product, err := view.V.Product.Get(app.db, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Listings of banned vendors are hidden from everyone else
+	vendorID := product.Product.VendorID
+	if vendorID != app.loggedInUser(r).ID {
+		banned, err := model.M.Ban.IsBanned(app.db, vendorID, model.BanSelling)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if banned {
+			app.notFound(w)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r, map[string]any{
+		"product": product,
+	})
+
+	app.render(w, r, http.StatusOK, "product.html", data)
+}
+
+func (app *application) viewCart(w http.ResponseWriter, r *http.Request) {
+	groups, err := view.V.Cart.Get(app.db, app.cart(r.Context()))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r, map[string]any{
+		"cart": groups,
+	})
+	app.render(w, r, http.StatusOK, "cart.html", data)
+}
+
+func (app *application) handleCartAdd(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Info.Printf("unable to parse form %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := new(cartForm)
+	if err := app.schemaDecoder.Decode(form, r.PostForm); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if form.Count <= 0 || form.Count > order.MaxItemCount {
+		app.addErrorNotes(r.Context(), fmt.Sprintf("Count must be between 1 and %d!", order.MaxItemCount))
+		app.redirectBack(w, r)
+		return
+	}
+
+	if _, err := model.M.Price.GetCurrent(app.db, form.PriceID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	app.addToCart(r.Context(), form.PriceID, form.Count)
+	app.addNotes(r.Context(), "Added to cart!")
+	app.redirectBack(w, r)
+}
+
+func (app *application) handleCartRemove(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Info.Printf("unable to parse form %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := new(cartRemoveForm)
+	if err := app.schemaDecoder.Decode(form, r.PostForm); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.removeFromCart(r.Context(), form.PriceID)
+	http.Redirect(w, r, "/cart", http.StatusSeeOther)
+}
+
+func (app *application) handleQuote(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Info.Printf("unable to parse form %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := new(quoteForm)
+	if err := app.schemaDecoder.Decode(form, r.PostForm); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	groups, err := view.V.Cart.Get(app.db, app.cart(r.Context()))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Only the items of the chosen vendor are ordered
+	items := make([]model.CartItem, 0)
+	for _, group := range groups {
+		if group.Vendor.ID != form.VendorID {
+			continue
+		}
+		for _, line := range group.Lines {
+			items = append(items, model.CartItem{PriceID: line.Price.ID, Count: line.Count})
+		}
+	}
+
+	customer := app.loggedInUser(r)
 
-func (app *application) products(w http.ResponseWriter, r *http.Request) {
-	products, err := view.V.Product.GetAll(app.db)
+	quote, err := order.Quote(app.db, items, form.DeliveryMethodID, customer.ID)
 	if err != nil {
-		app.serverError(w, err)
-		return
+		if errors.Is(err, order.ErrCustomerIsVendor) {
+			app.addErrorNotes(r.Context(), "You can't order your own product!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrEmptyCart) {
+			app.addErrorNotes(r.Context(), "Cart is empty!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrOutOfStock) {
+			app.addErrorNotes(r.Context(), "Vendor doesn't have enough of the product in stock!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrMixedCurrencies) {
+			app.addErrorNotes(r.Context(), "Products of the vendor are priced in different currencies, order them separately!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrBuyingBanned) {
+			app.addErrorNotes(r.Context(), "Your account is banned from buying!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrVendorBanned) {
+			app.addErrorNotes(r.Context(), "Vendor is not selling at the moment!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrVendorNotSelling) {
+			app.addErrorNotes(r.Context(), "Vendor is not selling at the moment!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrOrderLimit) {
+			app.addErrorNotes(r.Context(), "Order is larger than the vendor can take, order fewer items!")
+			app.redirectBack(w, r)
+			return
+		} else if errors.Is(err, order.ErrListingChanged) {
+			app.addErrorNotes(r.Context(), "Listing has been edited, check the cart and order again!")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, order.ErrInvalidDeliveryMethod) || errors.Is(err, order.ErrInvalidItems) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		} else if errors.Is(err, payment.ErrStaleRate) {
+			app.addErrorNotes(r.Context(), "Exchange rate is out of date, ordering is paused. Please try again later!")
+			app.redirectBack(w, r)
+			return
+		} else {
+			app.serverError(w, err)
+			return
+		}
 	}
 
-	data := app.newTemplateData(r, map[string]any{
-		"products": products,
-	})
-	app.render(w, r, http.StatusOK, "products.html", data)
+	http.Redirect(w, r, fmt.Sprintf("/orders/quote?id=%s", quote.ID), http.StatusSeeOther)
 }
 
-func (app *application) product(w http.ResponseWriter, r *http.Request) {
+func (app *application) quote(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(r.URL.Query().Get("id"))
 	if err != nil {
 		log.Info.Printf("Failed to parse id from url: %s\n", err.Error())
@@ -393,17 +848,33 @@ func (app *application) product(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := view.V.Product.Get(app.db, id)
+	quote, err := view.V.Quote.Get(app.db, id)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
 
+	user := app.loggedInUser(r)
+	if quote.Quote.CustomerID != user.ID {
+		log.Info.Println("logged in user must be the customer of the quote")
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	// Used quotes lead to their order
+	if quote.Quote.IsUsed() {
+		http.Redirect(w, r, fmt.Sprintf("/order?id=%s", quote.Quote.OrderID.UUID), http.StatusSeeOther)
+		return
+	}
+
 	data := app.newTemplateData(r, map[string]any{
-		"product": product,
+		"quote": quote,
 	})
-
-	app.render(w, r, http.StatusOK, "product.html", data)
+	app.render(w, r, http.StatusOK, "quote.html", data)
 }
 
 func (app *application) handleOrder(w http.ResponseWriter, r *http.Request) {
@@ -421,7 +892,7 @@ func (app *application) handleOrder(w http.ResponseWriter, r *http.Request) {
 
 	customer := app.loggedInUser(r)
 
-	newOrder, err := order.Create(app.db, form.PriceID, form.DeliveryMethodID, customer.ID, form.Details)
+	newOrder, err := order.Create(app.db, form.QuoteID, customer.ID, form.Details)
 	if err != nil {
 		if errors.Is(err, order.ErrNotEnoughBalance) {
 			app.addErrorNotes(r.Context(), "Not enough balance!")
@@ -431,53 +902,87 @@ func (app *application) handleOrder(w http.ResponseWriter, r *http.Request) {
 			app.addErrorNotes(r.Context(), "You can't order your own product!")
 			app.redirectBack(w, r)
 			return
+		} else if errors.Is(err, order.ErrOutOfStock) {
+			app.addErrorNotes(r.Context(), "Vendor doesn't have enough of the product in stock!")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, order.ErrQuoteExpired) {
+			app.addErrorNotes(r.Context(), "Quote has expired, please order again!")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, order.ErrBuyingBanned) {
+			app.addErrorNotes(r.Context(), "Your account is banned from buying!")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, order.ErrVendorBanned) || errors.Is(err, order.ErrVendorNotSelling) {
+			app.addErrorNotes(r.Context(), "Vendor is not selling at the moment!")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, order.ErrOrderLimit) {
+			app.addErrorNotes(r.Context(), "Order is larger than the vendor can take, order fewer items!")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, order.ErrListingChanged) {
+			app.addErrorNotes(r.Context(), "Listing has been edited, check the cart and order again!")
+			http.Redirect(w, r, "/cart", http.StatusSeeOther)
+			return
+		} else if errors.Is(err, order.ErrInvalidQuote) {
+			app.clientError(w, http.StatusBadRequest)
+			return
 		} else {
 			app.serverError(w, err)
 			return
 		}
 	}
 
-	app.addNotes(r.Context(), "Order created!")
-	http.Redirect(w, r, fmt.Sprintf("/order?id=%s", newOrder.ID), http.StatusSeeOther)
-}
-
-func (app *application) depositCallback(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	items, err := model.M.OrderItem.GetAllForOrder(app.db, newOrder.ID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	var data moneropay.CallbackResponse
-	err = json.Unmarshal(body, &data)
-	if err != nil {
-		app.serverError(w, err)
-		return
+	ordered := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		ordered = append(ordered, item.PriceID)
 	}
+	app.removeFromCart(r.Context(), ordered...)
 
-	log.Info.Printf("deposit callback: Amount.total: %s, amount.unlocked: %s\n",
-		payment.XMR2Decimal(data.Amount.Covered.Total), payment.XMR2Decimal(data.Amount.Covered.Unlocked))
-
-	w.WriteHeader(http.StatusOK)
+	app.addNotes(r.Context(), "Order created!")
+	http.Redirect(w, r, fmt.Sprintf("/order?id=%s", newOrder.ID), http.StatusSeeOther)
 }
 
-func (app *application) invoice(w http.ResponseWriter, r *http.Request) {
-	id, err := uuid.Parse(r.URL.Query().Get("id"))
+// Callbacks are acted on only with a valid token and after the wallet confirms the deposit
+func (app *application) depositCallback(w http.ResponseWriter, r *http.Request) {
+	userID, invoiceID, err := payment.VerifyDepositCallback(r.URL.Query())
 	if err != nil {
-		log.Info.Printf("Failed to parse id from url: %s\n", err.Error())
-		app.clientError(w, http.StatusBadRequest)
+		app.rejectCallback(w, err)
 		return
 	}
 
-	invoice, err := model.M.Invoice.Get(app.db, id)
+	t, err := payment.DecodeMoneropayCallback(r.Body)
 	if err != nil {
+		app.rejectCallback(w, err)
+		return
+	}
+
+	log.Info.Printf("deposit callback: tx %s of %s XMR, %d confirmations\n", t.TxHash, payment.XMR2Decimal(t.Amount), t.Confirmations)
+
+	if err := payment.HandleCallbackDeposit(app.db, app.walletBackend, userID, invoiceID, t); err != nil {
+		if errors.Is(err, payment.ErrInvalidDeposit) || errors.Is(err, payment.ErrUnconfirmedDeposit) || errors.Is(err, payment.ErrStaleInvoice) || errors.Is(err, sql.ErrNoRows) {
+			app.rejectCallback(w, err)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
 
-	info, err := view.V.Invoice.Get(app.db, invoice.ID)
-	data := app.newTemplateData(r, map[string]any{"invoice": info})
-	app.render(w, r, http.StatusOK, "invoice.html", data)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) rejectCallback(w http.ResponseWriter, err error) {
+	n := app.rejectedCallbacks.Add(1)
+	log.Error.Printf("Rejected deposit callback (%d since start): %s\n", n, err.Error())
+	app.clientError(w, http.StatusBadRequest)
 }
 
 func (app *application) order(w http.ResponseWriter, r *http.Request) {
@@ -496,12 +1001,18 @@ func (app *application) order(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	timeline, err := view.V.Order.Timeline(app.db, id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	view, err := view.V.Order.Get(app.db, id)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
-	data := app.newTemplateData(r, map[string]any{"order": view})
+	data := app.newTemplateData(r, map[string]any{"order": view, "timeline": timeline})
 	app.render(w, r, http.StatusOK, "order.html", data)
 }
 
@@ -529,6 +1040,85 @@ func (app *application) ordersIncoming(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, http.StatusOK, "orders-incoming.html", data)
 }
 
+func (app *application) wallet(w http.ResponseWriter, r *http.Request) {
+	user := app.loggedInUser(r)
+
+	statement, err := ledger.Statement(app.db, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	schedule, err := fee.Current(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	withdrawals, err := model.M.Withdrawal.GetAllForUser(app.db, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	wallet, err := model.M.Wallet.GetForUser(app.db, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	deposits, err := model.M.Deposit.GetPendingForWallet(app.db, wallet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r, map[string]any{
+		"statement":     statement,
+		"fees":          schedule,
+		"withdrawals":   withdrawals,
+		"deposits":      deposits,
+		"confirmations": payment.DepositConfirmations,
+	})
+	app.render(w, r, http.StatusOK, "wallet.html", data)
+}
+
+func (app *application) settings(w http.ResponseWriter, r *http.Request) {
+	schedule, err := fee.Current(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := map[string]any{"fees": schedule}
+
+	user := app.loggedInUser(r)
+	p, err := model.M.VendorPledge.GetForUser(app.db, user.ID)
+	if err == nil && p.Status != model.PledgeRetired {
+		base, err := pledge.LevelBase(app.db, p)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		level, err := pledge.LevelOf(base, p.Amount)
+		if err != nil && !errors.Is(err, pledge.ErrNotSelling) {
+			app.serverError(w, err)
+			return
+		}
+		data["pledge"] = p
+		data["level"] = level
+		if next, ok := pledge.NextLevel(base, p.Amount); ok {
+			data["nextLevel"] = next
+		}
+		data["cooldownDays"] = int(config.PledgeCooldown.Hours() / 24)
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "settings.html", app.newTemplateData(r, data))
+}
+
 func (app *application) handleWithdrawal(w http.ResponseWriter, r *http.Request) {
 	form := new(withdrawForm)
 	err := app.decodeForm(r, form)
@@ -537,21 +1127,36 @@ func (app *application) handleWithdrawal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	schedule, err := fee.Current(app.db)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	minWithdrawal := fmt.Sprintf("Minimum withdrawal amount is %d€", schedule.WithdrawalMin)
+
 	form.CheckField(validate.ValidXMRAddress(form.Address), "Address", "Not a valid XMR-address")
-	form.CheckField(form.AmountFiat >= 10, "AmountFiat", "Minimum withdrawal amount is 10€")
+	form.CheckField(form.AmountFiat >= float64(schedule.WithdrawalMin), "AmountFiat", minWithdrawal)
 	if !form.Valid() {
-		app.addErrorNotes(r.Context(), "Minimum withdrawal amount is 10€!")
+		app.addErrorNotes(r.Context(), minWithdrawal+"!")
 		app.renderInvalidForm(w, r, "wallet.html", form)
 		return
 	}
 
 	user := app.loggedInUser(r)
 	amount, err := payment.WithdrawFunds(app.db, user.ID, form.Address, payment.Fiat2XMR(form.AmountFiat))
-	if errors.Is(err, payment.ErrNotEnoughBalanceToWithdraw) {
-		form.SetError("Minimum withdrawal amount is 10€")
+	if errors.Is(err, payment.ErrFundsFrozen) {
+		app.addErrorNotes(r.Context(), "Your funds are frozen!")
+		http.Redirect(w, r, "/user/wallet", http.StatusSeeOther)
+		return
+	} else if errors.Is(err, payment.ErrNotEnoughBalanceToWithdraw) {
+		form.SetError(minWithdrawal)
 		app.addErrorNotes(r.Context(), "Not enough balance!")
 		app.renderInvalidForm(w, r, "wallet.html", form)
 		return
+	} else if errors.Is(err, payment.ErrStaleRate) {
+		app.addErrorNotes(r.Context(), "Exchange rate is out of date, withdrawals are paused. Please try again later!")
+		http.Redirect(w, r, "/user/wallet", http.StatusSeeOther)
+		return
 	} else if err != nil {
 		app.serverError(w, err)
 		return
@@ -579,7 +1184,12 @@ func (app *application) handleRefund(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := order.Refund(app.db, form.OrderID); err != nil {
+	if err := order.Refund(app.db, form.OrderID, model.VendorActor(user.ID)); err != nil {
+		if errors.Is(err, model.ErrIllegalTransition) {
+			app.addErrorNotes(r.Context(), "Order can no longer be refunded!")
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
@@ -650,8 +1260,13 @@ func (app *application) handleReview(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = order.Complete(app.db, form.OrderID)
+	err = order.Complete(app.db, form.OrderID, model.CustomerActor(user.ID))
 	if err != nil {
+		if errors.Is(err, model.ErrIllegalTransition) {
+			app.addErrorNotes(r.Context(), "Order can no longer be reviewed!")
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
@@ -722,7 +1337,12 @@ func (app *application) handleDispute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := dispute.CreateDispute(app.db, form.OrderID, form.Claim); err != nil {
+	if _, err := dispute.CreateDispute(app.db, form.OrderID, form.Claim, model.CustomerActor(user.ID)); err != nil {
+		if errors.Is(err, model.ErrIllegalTransition) {
+			app.addErrorNotes(r.Context(), "Order can no longer be disputed!")
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
@@ -795,7 +1415,12 @@ func (app *application) handleCounterDispute(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if _, err := dispute.CreateCounterDispute(app.db, form.OrderID, form.Claim); err != nil {
+	if _, err := dispute.CreateCounterDispute(app.db, form.OrderID, form.Claim, model.VendorActor(user.ID)); err != nil {
+		if errors.Is(err, model.ErrIllegalTransition) {
+			app.addErrorNotes(r.Context(), "Dispute can no longer be countered!")
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
@@ -810,12 +1435,13 @@ func (app *application) handleVendorPledge(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	file, handler, err := r.FormFile("logo")
+	file, _, err := r.FormFile("logo")
 	if err != nil {
 		log.Info.Printf("unable to read image file %s\n", err.Error())
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
+	defer file.Close()
 
 	user := app.loggedInUser(r)
 
@@ -826,17 +1452,13 @@ func (app *application) handleVendorPledge(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	logoFilename := user.Username + filepath.Ext(handler.Filename)
-
-	dst, err := os.Create(filepath.Join("uploads/vendor-logos", logoFilename))
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, file)
+	logoFilename, err := upload.SaveImage(file, upload.VendorLogos)
 	if err != nil {
+		if errors.Is(err, upload.ErrInvalidImage) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
@@ -857,6 +1479,44 @@ func (app *application) handleVendorPledge(w http.ResponseWriter, r *http.Reques
 	app.redirectBack(w, r)
 }
 
+func (app *application) handlePledgeTopUp(w http.ResponseWriter, r *http.Request) {
+	form := new(pledgeTopUpForm)
+	if err := app.decodeForm(r, form); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.loggedInUser(r)
+	if _, err := pledge.TopUp(app.db, user.ID, uint64(form.AmountXMR*payment.XMRf)); err != nil {
+		if errors.Is(err, pledge.ErrNotEnoughBalance) || errors.Is(err, pledge.ErrInvalidAmount) || errors.Is(err, pledge.ErrNotActive) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	app.addNotes(r.Context(), "Pledge topped up!")
+	app.redirectBack(w, r)
+}
+
+func (app *application) handleRetire(w http.ResponseWriter, r *http.Request) {
+	user := app.loggedInUser(r)
+	if err := pledge.RequestRetirement(app.db, user.ID); err != nil {
+		if errors.Is(err, pledge.ErrNotActive) {
+			app.addErrorNotes(r.Context(), err.Error())
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	app.addNotes(r.Context(), "Retirement requested, your pledge will be returned after the cooldown once your orders are finished.")
+	app.redirectBack(w, r)
+}
+
 func (app *application) decline(w http.ResponseWriter, r *http.Request) {
 	orderID, err := uuid.Parse(r.URL.Query().Get("id"))
 	if err != nil {
@@ -913,7 +1573,12 @@ func (app *application) handleDecline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := order.Decline(app.db, form.OrderID, form.Reason); err != nil {
+	if err := order.Decline(app.db, form.OrderID, form.Reason, model.VendorActor(user.ID)); err != nil {
+		if errors.Is(err, model.ErrIllegalTransition) {
+			app.addErrorNotes(r.Context(), "Order can no longer be declined!")
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
@@ -977,7 +1642,12 @@ func (app *application) handleDeliver(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := order.Deliver(app.db, form.OrderID, form.Info); err != nil {
+	if _, err := order.Deliver(app.db, form.OrderID, form.Info, model.VendorActor(user.ID)); err != nil {
+		if errors.Is(err, model.ErrIllegalTransition) {
+			app.addErrorNotes(r.Context(), "Order can no longer be delivered!")
+			app.redirectBack(w, r)
+			return
+		}
 		app.serverError(w, err)
 		return
 	}
@@ -1022,6 +1692,68 @@ func (app *application) handleProductDelete(w http.ResponseWriter, r *http.Reque
 	http.Redirect(w, r, "/products", http.StatusSeeOther)
 }
 
+func (app *application) handleProductStock(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Info.Printf("unable to parse form %s\n", err.Error())
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := new(productStockForm)
+	if err := app.schemaDecoder.Decode(form, r.PostForm); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	p, err := model.M.Product.Get(app.db, form.ProductID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	user := app.loggedInUser(r)
+	if user.ID != p.VendorID {
+		log.Info.Printf("vendors can only change the stock of their products")
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	stock := product.Stock{Tracked: form.TrackStock, Amount: form.Stock, LowStock: form.LowStock}
+	if err := product.SetStock(app.db, p.ID, stock); err != nil {
+		if errors.Is(err, product.ErrInvalidStock) {
+			app.addErrorNotes(r.Context(), "Stock can't be negative!")
+			app.redirectBack(w, r)
+			return
+		}
+		app.serverError(w, err)
+		return
+	}
+
+	app.addNotes(r.Context(), "Stock updated!")
+	app.redirectBack(w, r)
+}
+
+func (app *application) notifications(w http.ResponseWriter, r *http.Request) {
+	user := app.loggedInUser(r)
+
+	notifications, err := model.M.Notification.GetAllForUser(app.db, user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Shown as unread this time
+	if err := model.M.Notification.MarkAllRead(app.db, user.ID); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r, map[string]any{
+		"notifications": notifications,
+	})
+	app.render(w, r, http.StatusOK, "notifications.html", data)
+}
+
 func (app *application) handleTicket(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
@@ -1154,6 +1886,21 @@ func (app *application) toggleLang(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Moves to the next display currency
+func (app *application) toggleCurrency(w http.ResponseWriter, r *http.Request) {
+	current := model.Currency(app.sessionManager.GetString(r.Context(), "Currency"))
+	next := model.Currencies[0]
+	for i, c := range model.Currencies {
+		if c == current {
+			next = model.Currencies[(i+1)%len(model.Currencies)]
+			break
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "Currency", string(next))
+	app.redirectBack(w, r)
+}
+
 func (app *application) vendor(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(r.URL.Query().Get("id"))
 	if err != nil {
@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"slices"
+	"strconv"
 )
 
 func (app *application) serverError(w http.ResponseWriter, err error) {
@@ -54,6 +56,26 @@ func (app *application) loggedInUser(req *http.Request) *model.User {
 	return nil
 }
 
+// Logs the user in with a new session token, which is remembered so the session can be revoked.
+// A session that isn't remembered couldn't be revoked by a ban, so the user stays logged out then.
+func (app *application) startSession(ctx context.Context, userID uuid.UUID) error {
+	if err := app.sessionManager.RenewToken(ctx); err != nil {
+		return err
+	}
+	if err := model.M.UserSession.Create(app.db, app.sessionManager.Token(ctx), userID); err != nil {
+		return err
+	}
+	app.sessionManager.Put(ctx, "userID", userID)
+	return nil
+}
+
+// Same search with another page
+func pageURL(r *http.Request, page int) string {
+	values := r.URL.Query()
+	values.Set("Page", strconv.Itoa(page))
+	return r.URL.Path + "?" + values.Encode()
+}
+
 func (app *application) renderInvalidForm(w http.ResponseWriter, r *http.Request, page string, form any) {
 	data := app.newTemplateData(r, nil)
 	data.Form = form
@@ -118,3 +140,37 @@ func (app *application) addErrorNotes(ctx context.Context, messages ...string) {
 
 	app.sessionManager.Put(ctx, key, tmp)
 }
+
+func (app *application) cart(ctx context.Context) []model.CartItem {
+	cart, ok := app.sessionManager.Get(ctx, "cart").([]model.CartItem)
+	if !ok {
+		return []model.CartItem{}
+	}
+	return cart
+}
+
+// Adds count units of the pricing to the cart, or changes the count if it's already there
+func (app *application) addToCart(ctx context.Context, priceID uuid.UUID, count int) {
+	cart := app.cart(ctx)
+	for i := range cart {
+		if cart[i].PriceID == priceID {
+			cart[i].Count = count
+			app.sessionManager.Put(ctx, "cart", cart)
+			return
+		}
+	}
+
+	app.sessionManager.Put(ctx, "cart", append(cart, model.CartItem{PriceID: priceID, Count: count}))
+}
+
+func (app *application) removeFromCart(ctx context.Context, priceIDs ...uuid.UUID) {
+	cart := app.cart(ctx)
+	kept := make([]model.CartItem, 0, len(cart))
+	for _, item := range cart {
+		if !slices.Contains(priceIDs, item.PriceID) {
+			kept = append(kept, item)
+		}
+	}
+
+	app.sessionManager.Put(ctx, "cart", kept)
+}
@@ -3,14 +3,19 @@ package main
 import (
 	"LuomuTori/internal/config"
 	"LuomuTori/internal/log"
+	"LuomuTori/internal/model"
 	"LuomuTori/internal/service/captcha"
+	"LuomuTori/internal/service/ledger"
 	"LuomuTori/internal/service/order"
 	"LuomuTori/internal/service/payment"
+	"LuomuTori/internal/service/pledge"
+	"LuomuTori/internal/service/reputation"
 	"LuomuTori/internal/translate"
 	"context"
 	"errors"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"database/sql"
@@ -32,6 +37,9 @@ type application struct {
 	templateCache  map[string]*template.Template
 	schemaDecoder  *schema.Decoder
 	sessionManager *scs.SessionManager
+	walletBackend  payment.WalletBackend
+	// Deposit callbacks with a bad token or a deposit the wallet didn't confirm
+	rejectedCallbacks atomic.Uint64
 }
 
 type service struct {
@@ -46,6 +54,7 @@ func main() {
 	gob.Register(captcha.Solution{})
 	gob.Register(uuid.UUID{})
 	gob.Register([]Note{})
+	gob.Register([]model.CartItem{})
 
 	if err := translate.LoadTranslations(); err != nil {
 		log.Error.Fatalf("Failed to load translations: %s\n", err.Error())
@@ -67,11 +76,17 @@ func main() {
 	sessionManager := scs.New()
 	sessionManager.Store = postgresstore.New(db)
 
+	walletBackend, err := payment.NewWalletBackend(config.WalletBackend, config.MoneropayURL, config.InternalAddr, config.WalletRPCURL)
+	if err != nil {
+		log.Error.Fatalf("Invalid wallet backend: %s\n", err.Error())
+	}
+
 	app := application{
 		db:             db,
 		templateCache:  tc,
 		schemaDecoder:  schema.NewDecoder(),
 		sessionManager: sessionManager,
+		walletBackend:  walletBackend,
 	}
 
 	internal := http.Server{
@@ -86,8 +101,30 @@ func main() {
 		Handler:  app.route(),
 	}
 
+	rateProviders, err := payment.NewRateProviders(config.RateProviders, config.RateFile, config.StaticRate)
+	if err != nil {
+		log.Error.Fatalf("Invalid rate providers: %s\n", err.Error())
+	}
+	payment.SetRateProviders(rateProviders...)
+
+	random, err := payment.SetCallbackSecret(config.CallbackSecret)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+	if random {
+		// Callbacks of invoices from before a restart are rejected, polling still finds their deposits
+		log.Error.Printf("No callback secret set, using a random one\n")
+	}
+	payment.MaxRateAge = config.RateMaxAge
+
+	// Not fatal, ordering is refused until a fresh rate is available
 	if err := payment.UpdateXMRPrice(); err != nil {
-		log.Error.Fatalf("Failed to update XMR price: %s\n", err.Error())
+		log.Error.Printf("Failed to update XMR price: %s\n", err.Error())
+	}
+
+	// Before the withdrawals job so that interrupted transfers are never sent again
+	if err := payment.RecoverWithdrawals(db, app.walletBackend); err != nil {
+		log.Error.Fatalf("Failed to recover withdrawals: %s\n", err.Error())
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -96,10 +133,10 @@ func main() {
 	services := []service{
 		{
 			name:     "XMR price",
-			interval: time.Hour,
+			interval: 15 * time.Minute,
 			job: func() {
 				if err := payment.UpdateXMRPrice(); err != nil {
-					log.Error.Fatalf("Failed to update XMR price: %s\n", err.Error())
+					log.Error.Printf("Failed to update XMR price: %s\n", err.Error())
 				}
 			},
 		},
@@ -107,7 +144,7 @@ func main() {
 			name:     "Deposits",
 			interval: time.Minute,
 			job: func() {
-				if err := payment.HandleDeposits(db); err != nil {
+				if err := payment.HandleDeposits(db, app.walletBackend); err != nil {
 					log.Error.Fatalf("Failed to handle deposits: %s\n", err.Error())
 				}
 			},
@@ -116,11 +153,43 @@ func main() {
 			name:     "Withdraws",
 			interval: time.Minute,
 			job: func() {
-				if err := payment.HandleWithdrawals(db); err != nil {
+				if err := payment.HandleWithdrawals(db, app.walletBackend); err != nil {
 					log.Error.Fatalf("Failed to handle withdrawals: %s\n", err.Error())
 				}
 			},
 		},
+		{
+			name:     "Ledger reconciliation",
+			interval: time.Hour,
+			job: func() {
+				mismatches, err := ledger.Reconcile(db)
+				if err != nil {
+					log.Error.Printf("Failed to reconcile ledger: %s\n", err.Error())
+					return
+				}
+				for _, m := range mismatches {
+					log.Error.Printf("Wallet of user %s has balance %d but ledger says %d\n", m.UserID, m.Balance, m.LedgerBalance)
+				}
+			},
+		},
+		{
+			name:     "Pledge refunds",
+			interval: time.Hour,
+			job: func() {
+				if err := pledge.RefundRetired(db); err != nil {
+					log.Error.Printf("Failed to refund pledges: %s\n", err.Error())
+				}
+			},
+		},
+		{
+			name:     "Reputation",
+			interval: time.Hour,
+			job: func() {
+				if err := reputation.Refresh(db); err != nil {
+					log.Error.Printf("Failed to refresh reputations: %s\n", err.Error())
+				}
+			},
+		},
 		{
 			name:     "Forgotten orders",
 			interval: time.Hour * 12,
@@ -28,16 +28,39 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 	})
 }
 
+// Paths a user banned from logging in can still use to withdraw their balance
+var bannedPaths = map[string]bool{
+	"/user/wallet":     true,
+	"/user/withdrawal": true,
+	"/logout":          true,
+}
+
 func (app *application) requireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.sessionManager.Exists(r.Context(), "userID") {
-			next.ServeHTTP(w, r)
-		} else {
+		uid, ok := app.sessionManager.Get(r.Context(), "userID").(uuid.UUID)
+		if !ok {
 			app.clientError(w, http.StatusUnauthorized)
+			return
 		}
+
+		if !bannedPaths[r.URL.Path] {
+			banned, err := model.M.Ban.IsBanned(app.db, uid, model.BanLogin)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			if banned {
+				app.addErrorNotes(r.Context(), "Your account is banned, you can only withdraw your balance")
+				http.Redirect(w, r, "/user/wallet", http.StatusSeeOther)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
 	})
 }
 
+// Wrap inside requireAuth
 func (app *application) requireVendor(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if uid, ok := app.sessionManager.Get(r.Context(), "userID").(uuid.UUID); ok && model.M.User.IsVendor(app.db, uid) {
@@ -47,3 +70,21 @@ func (app *application) requireVendor(next http.Handler) http.Handler {
 		}
 	})
 }
+
+// Wrap inside requireVendor
+func (app *application) requireSeller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, _ := app.sessionManager.Get(r.Context(), "userID").(uuid.UUID)
+		banned, err := model.M.Ban.IsBanned(app.db, uid, model.BanSelling)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		if banned {
+			app.addErrorNotes(r.Context(), "Your account is banned from selling")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -38,26 +38,33 @@ func (app *application) route() http.Handler {
 	r.HandlerFunc(http.MethodPost, "/register", app.handleRegister)
 	r.HandlerFunc(http.MethodPost, "/login", app.handleLogin)
 	r.HandlerFunc(http.MethodPost, "/lang/toggle", app.toggleLang)
+	r.HandlerFunc(http.MethodPost, "/currency/toggle", app.toggleCurrency)
 
 	requireAuth := alice.New(app.requireAuth)
-	requireVendor := alice.New(app.requireVendor)
+	requireVendor := requireAuth.Append(app.requireVendor)
+	requireSeller := requireVendor.Append(app.requireSeller)
 
 	r.Handler(http.MethodGet, "/product", requireAuth.ThenFunc(app.product))
 	r.Handler(http.MethodGet, "/products", requireAuth.ThenFunc(app.products))
-	r.Handler(http.MethodGet, "/orders/invoice", requireAuth.ThenFunc(app.invoice))
+	r.Handler(http.MethodGet, "/orders/quote", requireAuth.ThenFunc(app.quote))
+	r.Handler(http.MethodGet, "/cart", requireAuth.ThenFunc(app.viewCart))
+	r.Handler(http.MethodGet, "/notifications", requireAuth.ThenFunc(app.notifications))
 	r.Handler(http.MethodGet, "/orders/placed", requireAuth.ThenFunc(app.ordersPlaced))
 	r.Handler(http.MethodGet, "/orders/incoming", requireAuth.ThenFunc(app.ordersIncoming))
 	r.Handler(http.MethodGet, "/orders/review", requireAuth.ThenFunc(app.review))
 	r.Handler(http.MethodGet, "/orders/dispute", requireAuth.ThenFunc(app.dispute))
 	r.Handler(http.MethodGet, "/order", requireAuth.ThenFunc(app.order))
-	r.Handler(http.MethodGet, "/user/settings", requireAuth.ThenFunc(app.servePage("settings.html")))
-	r.Handler(http.MethodGet, "/user/wallet", requireAuth.ThenFunc(app.servePage("wallet.html")))
+	r.Handler(http.MethodGet, "/user/settings", requireAuth.ThenFunc(app.settings))
+	r.Handler(http.MethodGet, "/user/wallet", requireAuth.ThenFunc(app.wallet))
 	r.Handler(http.MethodGet, "/ticket/create", requireAuth.Then(app.servePage("create-ticket.html")))
 	r.Handler(http.MethodGet, "/ticket/view/all", requireAuth.ThenFunc(app.tickets))
 	r.Handler(http.MethodGet, "/ticket/view", requireAuth.ThenFunc(app.ticket))
 	r.Handler(http.MethodGet, "/vendor", requireAuth.ThenFunc(app.vendor))
 
 	r.Handler(http.MethodPost, "/logout", requireAuth.ThenFunc(app.handleLogout))
+	r.Handler(http.MethodPost, "/cart/add", requireAuth.ThenFunc(app.handleCartAdd))
+	r.Handler(http.MethodPost, "/cart/remove", requireAuth.ThenFunc(app.handleCartRemove))
+	r.Handler(http.MethodPost, "/orders/quote", requireAuth.ThenFunc(app.handleQuote))
 	r.Handler(http.MethodPost, "/orders/create", requireAuth.ThenFunc(app.handleOrder))
 	r.Handler(http.MethodPost, "/orders/refund", requireAuth.ThenFunc(app.handleRefund))
 	r.Handler(http.MethodPost, "/orders/review", requireAuth.ThenFunc(app.handleReview))
@@ -69,16 +76,21 @@ func (app *application) route() http.Handler {
 	r.Handler(http.MethodPost, "/ticket/create", requireAuth.ThenFunc(app.handleTicket))
 	r.Handler(http.MethodPost, "/ticket/response", requireAuth.ThenFunc(app.handleTicketResponse))
 
-	r.Handler(http.MethodGet, "/vendor/create-listing", requireVendor.Then(app.servePage("create-listing.html")))
+	r.Handler(http.MethodGet, "/vendor/create-listing", requireSeller.ThenFunc(app.createListing))
+	r.Handler(http.MethodGet, "/vendor/edit-listing", requireSeller.ThenFunc(app.editListing))
 	r.Handler(http.MethodGet, "/orders/counter-dispute", requireVendor.ThenFunc(app.counterDispute))
 	r.Handler(http.MethodGet, "/orders/deliver", requireVendor.ThenFunc(app.deliver))
 	r.Handler(http.MethodGet, "/orders/decline", requireVendor.ThenFunc(app.decline))
 
-	r.Handler(http.MethodPost, "/vendor/create-listing", requireVendor.ThenFunc(app.handleCreateListing))
+	r.Handler(http.MethodPost, "/vendor/create-listing", requireSeller.ThenFunc(app.handleCreateListing))
+	r.Handler(http.MethodPost, "/vendor/edit-listing", requireSeller.ThenFunc(app.handleEditListing))
 	r.Handler(http.MethodPost, "/orders/counter-dispute", requireVendor.ThenFunc(app.handleCounterDispute))
 	r.Handler(http.MethodPost, "/orders/deliver", requireVendor.ThenFunc(app.handleDeliver))
 	r.Handler(http.MethodPost, "/orders/decline", requireVendor.ThenFunc(app.handleDecline))
 	r.Handler(http.MethodPost, "/product/delete", requireVendor.ThenFunc(app.handleProductDelete))
+	r.Handler(http.MethodPost, "/product/stock", requireSeller.ThenFunc(app.handleProductStock))
+	r.Handler(http.MethodPost, "/vendor/pledge/topup", requireVendor.ThenFunc(app.handlePledgeTopUp))
+	r.Handler(http.MethodPost, "/vendor/retire", requireVendor.ThenFunc(app.handleRetire))
 
 	secure := alice.New(setSecureHeaders, app.logRequest, app.sessionManager.LoadAndSave)
 	return secure.Then(r)
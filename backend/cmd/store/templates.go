@@ -3,10 +3,12 @@ package main
 import (
 	"LuomuTori/internal/model"
 	"LuomuTori/internal/service/payment"
+	"LuomuTori/internal/service/upload"
 	"LuomuTori/internal/translate"
 	"bytes"
 	"fmt"
 	"html/template"
+	"math"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -53,6 +55,11 @@ func Iterate(start, end int) []int {
 	return items
 }
 
+// Share in [0, 1] as a whole percentage
+func Percent(share float64) int {
+	return int(math.Round(share * 100))
+}
+
 func FmtTime(t time.Time) string {
 	return t.Format("15:04:05 02-01-2006")
 }
@@ -79,11 +86,20 @@ func NewTemplateCache() (map[string]*template.Template, error) {
 			"XMR2Fiat": func(xmr uint64) int {
 				return int(payment.XMR2Fiat(xmr))
 			},
-			"T":       translate.T,
-			"Head":    Head,
-			"Iterate": Iterate,
-			"FmtTime": FmtTime,
-			"FmtDate": FmtDate,
+			"XMR2FiatIn":   payment.XMR2FiatIn,
+			"FmtFiat":      payment.FmtFiat,
+			"DisplayPrice": payment.DisplayPrice,
+			"Currencies": func() []model.Currency {
+				return model.Currencies
+			},
+			"T":         translate.T,
+			"Tf":        translate.Tf,
+			"Head":      Head,
+			"Iterate":   Iterate,
+			"FmtTime":   FmtTime,
+			"FmtDate":   FmtDate,
+			"Percent":   Percent,
+			"Thumbnail": upload.ThumbnailPath,
 		})
 
 		ts, err := ts.ParseFiles("./ui/html/base.html")
@@ -138,11 +154,12 @@ type Note struct {
 }
 
 type templateData struct {
-	Form  any
-	Data  map[string]any
-	User  *model.User
-	Lang  string
-	Notes []Note
+	Form     any
+	Data     map[string]any
+	User     *model.User
+	Lang     string
+	Currency model.Currency
+	Notes    []Note
 }
 
 func (app *application) newTemplateData(req *http.Request, data map[string]any) *templateData {
@@ -157,6 +174,7 @@ func (app *application) newTemplateData(req *http.Request, data map[string]any)
 			data["wallet"] = wallet
 		}
 		data["isVendor"] = model.M.User.IsVendor(app.db, user.ID)
+		data["unread"], _ = model.M.Notification.CountUnread(app.db, user.ID)
 	} else {
 		data["isVendor"] = false
 	}
@@ -171,13 +189,23 @@ func (app *application) newTemplateData(req *http.Request, data map[string]any)
 		return res
 	}()
 
+	currency := func() model.Currency {
+		res := model.Currency(app.sessionManager.GetString(req.Context(), "Currency"))
+		if !model.ValidCurrency(res) {
+			res = model.CurrencyEUR
+			app.sessionManager.Put(req.Context(), "Currency", string(res))
+		}
+		return res
+	}()
+
 	// Notes are only viewed once
 	notes, _ := app.sessionManager.Pop(req.Context(), "notes").([]Note)
 
 	return &templateData{
-		Data:  data,
-		User:  user,
-		Lang:  lang,
-		Notes: notes,
+		Data:     data,
+		User:     user,
+		Lang:     lang,
+		Currency: currency,
+		Notes:    notes,
 	}
 }
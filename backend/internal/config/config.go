@@ -3,17 +3,27 @@ package config
 import (
 	"flag"
 	"os"
+	"time"
 )
 
 var (
-	Addr          string
-	InternalAddr  string
-	DSN           string
-	MoneropayURL  string
-	CssDir        string
-	UploadDir     string
-	StaticDir     string
-	PgpPrivateKey string
+	Addr           string
+	InternalAddr   string
+	DSN            string
+	WalletBackend  string
+	MoneropayURL   string
+	WalletRPCURL   string
+	CallbackSecret string
+	CssDir         string
+	UploadDir      string
+	StaticDir      string
+	PgpPrivateKey  string
+	RateProviders  string
+	RateFile       string
+	StaticRate     string
+	RateMaxAge     time.Duration
+	QuoteTTL       time.Duration
+	PledgeCooldown time.Duration
 )
 
 func Parse() {
@@ -23,7 +33,16 @@ func Parse() {
 	flag.StringVar(&StaticDir, "static-dir", "./static/", "directory where static files are stored")
 	flag.StringVar(&DSN, "dsn", os.Getenv("DSN"), "postgres data source name")
 	flag.StringVar(&InternalAddr, "internal-addr", "0.0.0.0:4420", "internal address to listen")
+	flag.StringVar(&WalletBackend, "wallet-backend", "moneropay", "wallet backend: moneropay or wallet-rpc")
 	flag.StringVar(&MoneropayURL, "moneropay-url", "http://localhost:5000", "moneropay url")
+	flag.StringVar(&WalletRPCURL, "wallet-rpc-url", "http://localhost:18083/json_rpc", "monero-wallet-rpc json-rpc url, run it with --disable-rpc-login")
+	flag.StringVar(&CallbackSecret, "callback-secret", os.Getenv("CALLBACK_SECRET"), "key of the tokens in moneropay callback urls, keep it the same across restarts")
 	flag.StringVar(&PgpPrivateKey, "PGP-private-key-file", os.Getenv("PGP-private-key-file"), "pgp private key file")
+	flag.StringVar(&RateProviders, "rate-providers", "cryptocompare", "comma separated XMR rate providers: cryptocompare, file, static")
+	flag.StringVar(&RateFile, "rate-file", "./rate.json", "file read by the file rate provider, eg. {\"EUR\": 150.25, \"USD\": 162.1}")
+	flag.StringVar(&StaticRate, "static-rate", "EUR=150", "XMR rates returned by the static rate provider, eg. EUR=150.25,USD=162.1")
+	flag.DurationVar(&RateMaxAge, "rate-max-age", 2*time.Hour, "age after which the XMR rates are too old for ordering")
+	flag.DurationVar(&QuoteTTL, "quote-ttl", 10*time.Minute, "how long a price quote is valid at checkout")
+	flag.DurationVar(&PledgeCooldown, "pledge-cooldown", 30*24*time.Hour, "time after a retirement request before the pledge is returned")
 	flag.Parse()
 }
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditBanUser                AuditAction = "ban_user"
+	AuditDeleteBan              AuditAction = "delete_ban"
+	AuditDeleteListing          AuditAction = "delete_listing"
+	AuditDeleteReview           AuditAction = "delete_review"
+	AuditDisputeDecision        AuditAction = "dispute_decision"
+	AuditTicketResponse         AuditAction = "ticket_response"
+	AuditCloseTicket            AuditAction = "close_ticket"
+	AuditPublishFees            AuditAction = "publish_fees"
+	AuditSetVendorCommission    AuditAction = "set_vendor_commission"
+	AuditDeleteVendorCommission AuditAction = "delete_vendor_commission"
+	AuditForfeitPledge          AuditAction = "forfeit_pledge"
+	AuditCreateCategory         AuditAction = "create_category"
+	AuditRenameCategory         AuditAction = "rename_category"
+	AuditMoveCategory           AuditAction = "move_category"
+	AuditDeleteCategory         AuditAction = "delete_category"
+	AuditMoveListing            AuditAction = "move_listing"
+	AuditResolveWithdrawal      AuditAction = "resolve_withdrawal"
+)
+
+// Before and After are JSON encoded states of the target.
+// Hash covers every other field and PrevHash, which is the hash of the previous event.
+type AuditEvent struct {
+	ID        int64
+	StaffID   uuid.UUID
+	Action    AuditAction
+	Target    string
+	Before    string
+	After     string
+	Reason    string
+	CreatedAt time.Time
+	PrevHash  []byte
+	Hash      []byte
+
+	// Filled when read with GetAll
+	StaffName string
+}
+
+type AuditModel struct{}
+
+// Blocks other writers until the end of the transaction so the chain can't fork
+func (m AuditModel) Lock(ec db.ExecContext) error {
+	_, err := ec.Exec("LOCK TABLE audit_events IN EXCLUSIVE MODE")
+	return err
+}
+
+func (m AuditModel) Create(ec db.ExecContext, e AuditEvent) (*AuditEvent, error) {
+	query := `
+		INSERT INTO audit_events (staff_id, action, target, before_state, after_state, reason, created_at, prev_hash, hash)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id
+	`
+
+	if err := ec.QueryRow(query, e.StaffID, e.Action, e.Target, e.Before, e.After, e.Reason, e.CreatedAt, e.PrevHash, e.Hash).Scan(&e.ID); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// Returns sql.ErrNoRows if the log is empty
+func (m AuditModel) GetLast(ec db.ExecContext) (*AuditEvent, error) {
+	query := `
+		SELECT id, staff_id, action, target, before_state, after_state, reason, created_at, prev_hash, hash
+		FROM audit_events ORDER BY id DESC LIMIT 1
+	`
+
+	e := &AuditEvent{}
+	if err := ec.QueryRow(query).Scan(&e.ID, &e.StaffID, &e.Action, &e.Target, &e.Before, &e.After, &e.Reason, &e.CreatedAt, &e.PrevHash, &e.Hash); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Oldest first, which is the order of the chain
+func (m AuditModel) GetAll(ec db.ExecContext) ([]AuditEvent, error) {
+	query := `
+		SELECT e.id, e.staff_id, e.action, e.target, e.before_state, e.after_state, e.reason, e.created_at, e.prev_hash, e.hash, staff.username
+		FROM audit_events AS e
+		JOIN staff ON staff.id = e.staff_id
+		ORDER BY e.id
+	`
+
+	rows, err := ec.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]AuditEvent, 0)
+	for rows.Next() {
+		e := AuditEvent{}
+		if err := rows.Scan(&e.ID, &e.StaffID, &e.Action, &e.Target, &e.Before, &e.After, &e.Reason, &e.CreatedAt, &e.PrevHash, &e.Hash, &e.StaffName); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
@@ -2,42 +2,179 @@ package model
 
 import (
 	"LuomuTori/internal/db"
+	"database/sql"
 	"github.com/google/uuid"
 	"time"
 )
 
+type BanScope string
+
+const (
+	// Login bans also prevent selling and buying
+	BanLogin   BanScope = "login"
+	BanSelling BanScope = "selling"
+	BanBuying  BanScope = "buying"
+)
+
+var BanScopes = []BanScope{BanLogin, BanSelling, BanBuying}
+
+func ValidBanScope(scope BanScope) bool {
+	for _, s := range BanScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Ban is permanent if ExpiresAt is not valid.
+// FreezeFunds prevents the user from withdrawing the balance of the wallet.
 type Ban struct {
-	ID        uuid.UUID
-	UserID    uuid.UUID
-	CreatedAt time.Time
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Scope       BanScope
+	Reason      string
+	ExpiresAt   sql.NullTime
+	FreezeFunds bool
+	CreatedAt   time.Time
+
+	// Filled by GetAllActive
+	Username string
+}
+
+func (b Ban) IsActive() bool {
+	return !b.ExpiresAt.Valid || b.ExpiresAt.Time.After(time.Now())
 }
 
 type BanModel struct{}
 
-func (um BanModel) Create(ec db.ExecContext, userID uuid.UUID) (*Ban, error) {
+// Replaces an earlier ban of the user with the same scope
+func (um BanModel) Create(ec db.ExecContext, userID uuid.UUID, scope BanScope, reason string, expiresAt sql.NullTime, freezeFunds bool) (*Ban, error) {
+	query := `
+		INSERT INTO bans (user_id, scope, reason, expires_at, freeze_funds) VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, scope) DO UPDATE
+		SET reason = EXCLUDED.reason, expires_at = EXCLUDED.expires_at, freeze_funds = EXCLUDED.freeze_funds, created_at = NOW()
+		RETURNING id, created_at
+	`
+
 	b := &Ban{
-		UserID: userID,
+		UserID:      userID,
+		Scope:       scope,
+		Reason:      reason,
+		ExpiresAt:   expiresAt,
+		FreezeFunds: freezeFunds,
 	}
 
-	if err := ec.QueryRow("INSERT INTO bans (user_id) VALUES($1) RETURNING id, created_at", userID).Scan(&b.ID, &b.CreatedAt); err != nil {
+	if err := ec.QueryRow(query, userID, scope, reason, expiresAt, freezeFunds).Scan(&b.ID, &b.CreatedAt); err != nil {
 		return nil, err
 	}
 
 	return b, nil
 }
 
-func (um BanModel) GetForUser(ec db.ExecContext, userID uuid.UUID) (*Ban, error) {
+// Active bans of the user
+func (um BanModel) GetAllForUser(ec db.ExecContext, userID uuid.UUID) ([]Ban, error) {
+	query := `
+		SELECT id, scope, reason, expires_at, freeze_funds, created_at FROM bans
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY created_at
+	`
+
+	rows, err := ec.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := make([]Ban, 0)
+	for rows.Next() {
+		b := Ban{
+			UserID: userID,
+		}
+		if err := rows.Scan(&b.ID, &b.Scope, &b.Reason, &b.ExpiresAt, &b.FreezeFunds, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+
+	return bans, nil
+}
+
+func (um BanModel) GetAllActive(ec db.ExecContext) ([]Ban, error) {
+	query := `
+		SELECT bans.id, bans.user_id, users.username, bans.scope, bans.reason, bans.expires_at, bans.freeze_funds, bans.created_at
+		FROM bans
+		JOIN users ON users.id = bans.user_id
+		WHERE bans.expires_at IS NULL OR bans.expires_at > NOW()
+		ORDER BY bans.created_at DESC
+	`
+
+	rows, err := ec.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := make([]Ban, 0)
+	for rows.Next() {
+		b := Ban{}
+		if err := rows.Scan(&b.ID, &b.UserID, &b.Username, &b.Scope, &b.Reason, &b.ExpiresAt, &b.FreezeFunds, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, b)
+	}
+
+	return bans, nil
+}
+
+func (um BanModel) Get(ec db.ExecContext, id uuid.UUID) (*Ban, error) {
+	query := "SELECT user_id, scope, reason, expires_at, freeze_funds, created_at FROM bans WHERE id = $1"
+
 	b := &Ban{
-		UserID: userID,
+		ID: id,
 	}
 
-	if err := ec.QueryRow("SELECT id, created_at FROM bans WHERE user_id = $1", userID).Scan(&b.ID, &b.CreatedAt); err != nil {
+	if err := ec.QueryRow(query, id).Scan(&b.UserID, &b.Scope, &b.Reason, &b.ExpiresAt, &b.FreezeFunds, &b.CreatedAt); err != nil {
 		return nil, err
 	}
 
 	return b, nil
 }
 
+// Whether the user has an active ban of the scope, or a login ban
+func (um BanModel) IsBanned(ec db.ExecContext, userID uuid.UUID, scope BanScope) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM bans
+			WHERE user_id = $1 AND scope IN ($2, 'login') AND (expires_at IS NULL OR expires_at > NOW())
+		)
+	`
+
+	var banned bool
+	if err := ec.QueryRow(query, userID, scope).Scan(&banned); err != nil {
+		return false, err
+	}
+
+	return banned, nil
+}
+
+// Whether an active ban freezes the wallet of the user
+func (um BanModel) FundsFrozen(ec db.ExecContext, userID uuid.UUID) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM bans
+			WHERE user_id = $1 AND freeze_funds AND (expires_at IS NULL OR expires_at > NOW())
+		)
+	`
+
+	var frozen bool
+	if err := ec.QueryRow(query, userID).Scan(&frozen); err != nil {
+		return false, err
+	}
+
+	return frozen, nil
+}
+
 func (um BanModel) Delete(ec db.ExecContext, id uuid.UUID) error {
 	_, err := ec.Exec("DELETE FROM bans WHERE id = $1", id)
 	return err
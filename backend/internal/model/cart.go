@@ -0,0 +1,12 @@
+package model
+
+import (
+	"github.com/google/uuid"
+)
+
+// Line of the cart. The cart is kept in the session of the customer,
+// so only the pricing and the number of units are stored.
+type CartItem struct {
+	PriceID uuid.UUID
+	Count   int
+}
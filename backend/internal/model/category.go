@@ -0,0 +1,148 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+	"time"
+)
+
+type Category struct {
+	ID        uuid.UUID
+	Name      string
+	ParentID  uuid.NullUUID
+	CreatedAt time.Time
+	// Visible products in the category and its subcategories, filled by GetAll
+	NumProducts int
+}
+
+func (c Category) IsRoot() bool {
+	return !c.ParentID.Valid
+}
+
+type CategoryModel struct{}
+
+func (m CategoryModel) Create(ec db.ExecContext, name string, parentID uuid.NullUUID) (*Category, error) {
+	query := "INSERT INTO categories (name, parent_id) VALUES($1, $2) RETURNING id, created_at"
+
+	c := &Category{
+		Name:     name,
+		ParentID: parentID,
+	}
+
+	if err := ec.QueryRow(query, name, parentID).Scan(&c.ID, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (m CategoryModel) Get(ec db.ExecContext, id uuid.UUID) (*Category, error) {
+	query := "SELECT name, parent_id, created_at FROM categories WHERE id = $1"
+
+	c := &Category{
+		ID: id,
+	}
+
+	if err := ec.QueryRow(query, id).Scan(&c.Name, &c.ParentID, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Every category ordered by name, with the number of visible products in each subtree
+func (m CategoryModel) GetAll(ec db.ExecContext) ([]Category, error) {
+	query := `
+		WITH RECURSIVE ancestors(id, ancestor_id) AS (
+			SELECT id, id FROM categories
+			UNION ALL
+			SELECT ancestors.id, categories.parent_id
+			FROM ancestors
+			JOIN categories ON categories.id = ancestors.ancestor_id
+			WHERE categories.parent_id IS NOT NULL
+		)
+		SELECT categories.id, categories.name, categories.parent_id, categories.created_at, COUNT(products.id)
+		FROM categories
+		JOIN ancestors ON ancestors.ancestor_id = categories.id
+		LEFT JOIN products ON products.category_id = ancestors.id AND ` + visibleProducts + `
+		GROUP BY categories.id
+		ORDER BY LOWER(categories.name)
+	`
+
+	rows, err := ec.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make([]Category, 0)
+	for rows.Next() {
+		c := Category{}
+		if err := rows.Scan(&c.ID, &c.Name, &c.ParentID, &c.CreatedAt, &c.NumProducts); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	return categories, nil
+}
+
+// The category and its ancestors, root first
+func (m CategoryModel) GetPath(ec db.ExecContext, id uuid.UUID) ([]Category, error) {
+	query := `
+		WITH RECURSIVE path(id, name, parent_id, created_at, depth) AS (
+			SELECT id, name, parent_id, created_at, 0 FROM categories WHERE id = $1
+			UNION ALL
+			SELECT categories.id, categories.name, categories.parent_id, categories.created_at, path.depth + 1
+			FROM categories
+			JOIN path ON categories.id = path.parent_id
+		)
+		SELECT id, name, parent_id, created_at FROM path ORDER BY depth DESC
+	`
+
+	rows, err := ec.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	path := make([]Category, 0)
+	for rows.Next() {
+		c := Category{}
+		if err := rows.Scan(&c.ID, &c.Name, &c.ParentID, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		path = append(path, c)
+	}
+
+	return path, nil
+}
+
+func (m CategoryModel) Rename(ec db.ExecContext, id uuid.UUID, name string) error {
+	_, err := ec.Exec("UPDATE categories SET name = $2 WHERE id = $1", id, name)
+	return err
+}
+
+func (m CategoryModel) SetParent(ec db.ExecContext, id uuid.UUID, parentID uuid.NullUUID) error {
+	_, err := ec.Exec("UPDATE categories SET parent_id = $2 WHERE id = $1", id, parentID)
+	return err
+}
+
+func (m CategoryModel) CountChildren(ec db.ExecContext, id uuid.UUID) (int, error) {
+	var count int
+	if err := ec.QueryRow("SELECT COUNT(*) FROM categories WHERE parent_id = $1", id).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Moves the products of the category to another, deleted products included
+func (m CategoryModel) MoveProducts(ec db.ExecContext, id uuid.UUID, to uuid.NullUUID) error {
+	_, err := ec.Exec("UPDATE products SET category_id = $2 WHERE category_id = $1", id, to)
+	return err
+}
+
+func (m CategoryModel) Delete(ec db.ExecContext, id uuid.UUID) error {
+	_, err := ec.Exec("DELETE FROM categories WHERE id = $1", id)
+	return err
+}
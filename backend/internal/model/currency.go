@@ -0,0 +1,36 @@
+package model
+
+type Currency string
+
+const (
+	CurrencyEUR Currency = "EUR"
+	CurrencyUSD Currency = "USD"
+	CurrencyGBP Currency = "GBP"
+	CurrencySEK Currency = "SEK"
+)
+
+// Currencies listings can be priced in and prices displayed in
+var Currencies = []Currency{CurrencyEUR, CurrencyUSD, CurrencyGBP, CurrencySEK}
+
+func ValidCurrency(c Currency) bool {
+	for _, currency := range Currencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Currency) Symbol() string {
+	switch c {
+	case CurrencyEUR:
+		return "€"
+	case CurrencyUSD:
+		return "$"
+	case CurrencyGBP:
+		return "£"
+	case CurrencySEK:
+		return "kr"
+	}
+	return string(c)
+}
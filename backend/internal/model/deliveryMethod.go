@@ -5,39 +5,63 @@ import (
 	"github.com/google/uuid"
 )
 
+// Delivery method of one version of a product
 type DeliveryMethod struct {
 	ID          uuid.UUID
 	Description string
 	Price       int
 	ProductID   uuid.UUID
+	VersionID   uuid.UUID
 }
 
 type DeliveryMethodModel struct{}
 
-func (pm DeliveryMethodModel) Create(ec db.ExecContext, description string, price int, productID uuid.UUID) (*DeliveryMethod, error) {
-	query := "INSERT INTO delivery_methods (description, price, product_id) VALUES ($1, $2, $3) RETURNING id"
+func (pm DeliveryMethodModel) Create(ec db.ExecContext, description string, price int, productID uuid.UUID, versionID uuid.UUID) (*DeliveryMethod, error) {
+	query := "INSERT INTO delivery_methods (description, price, product_id, version_id) VALUES ($1, $2, $3, $4) RETURNING id"
 
 	dm := &DeliveryMethod{
 		Description: description,
 		Price:       price,
 		ProductID:   productID,
+		VersionID:   versionID,
 	}
 
-	if err := ec.QueryRow(query, description, price, productID).Scan(&dm.ID); err != nil {
+	if err := ec.QueryRow(query, description, price, productID, versionID).Scan(&dm.ID); err != nil {
 		return nil, err
 	}
 
 	return dm, nil
 }
 
+// Returns the delivery method of any version, orders keep pointing at the one they were made with
 func (pm DeliveryMethodModel) Get(ec db.ExecContext, id uuid.UUID) (*DeliveryMethod, error) {
-	query := "SELECT description, price, product_id FROM delivery_methods WHERE id=$1"
+	query := "SELECT description, price, product_id, version_id FROM delivery_methods WHERE id=$1"
 
 	dm := &DeliveryMethod{
 		ID: id,
 	}
 
-	if err := ec.QueryRow(query, id).Scan(&dm.Description, &dm.Price, &dm.ProductID); err != nil {
+	if err := ec.QueryRow(query, id).Scan(&dm.Description, &dm.Price, &dm.ProductID, &dm.VersionID); err != nil {
+		return nil, err
+	}
+
+	return dm, nil
+}
+
+// Returns sql.ErrNoRows if the delivery method belongs to an old version of the product
+func (pm DeliveryMethodModel) GetCurrent(ec db.ExecContext, id uuid.UUID) (*DeliveryMethod, error) {
+	query := `
+		SELECT dm.description, dm.price, dm.product_id, dm.version_id
+		FROM delivery_methods AS dm
+		JOIN products ON products.version_id = dm.version_id
+		WHERE dm.id = $1
+	`
+
+	dm := &DeliveryMethod{
+		ID: id,
+	}
+
+	if err := ec.QueryRow(query, id).Scan(&dm.Description, &dm.Price, &dm.ProductID, &dm.VersionID); err != nil {
 		return nil, err
 	}
 
@@ -46,7 +70,7 @@ func (pm DeliveryMethodModel) Get(ec db.ExecContext, id uuid.UUID) (*DeliveryMet
 
 func (pm DeliveryMethodModel) GetForOrder(ec db.ExecContext, orderID uuid.UUID) (*DeliveryMethod, error) {
 	query := `
-		SELECT dm.id, dm.description, dm.price, dm.product_id 
+		SELECT dm.id, dm.description, dm.price, dm.product_id, dm.version_id
 		FROM delivery_methods AS dm
 		JOIN orders ON orders.delivery_method_id = dm.id
 		WHERE orders.id=$1
@@ -54,15 +78,21 @@ func (pm DeliveryMethodModel) GetForOrder(ec db.ExecContext, orderID uuid.UUID)
 
 	dm := &DeliveryMethod{}
 
-	if err := ec.QueryRow(query, orderID).Scan(&dm.ID, &dm.Description, &dm.Price, &dm.ProductID); err != nil {
+	if err := ec.QueryRow(query, orderID).Scan(&dm.ID, &dm.Description, &dm.Price, &dm.ProductID, &dm.VersionID); err != nil {
 		return nil, err
 	}
 
 	return dm, nil
 }
 
+// Delivery methods of the current version of the product
 func (pm DeliveryMethodModel) GetAllForProduct(ec db.ExecContext, productID uuid.UUID) ([]DeliveryMethod, error) {
-	query := "SELECT id, description, price FROM delivery_methods WHERE product_id=$1"
+	query := `
+		SELECT dm.id, dm.description, dm.price, dm.version_id
+		FROM delivery_methods AS dm
+		JOIN products ON products.version_id = dm.version_id
+		WHERE products.id=$1
+	`
 
 	rows, err := ec.Query(query, productID)
 	if err != nil {
@@ -76,7 +106,7 @@ func (pm DeliveryMethodModel) GetAllForProduct(ec db.ExecContext, productID uuid
 			ProductID: productID,
 		}
 
-		if err := rows.Scan(&dm.ID, &dm.Description, &dm.Price); err != nil {
+		if err := rows.Scan(&dm.ID, &dm.Description, &dm.Price, &dm.VersionID); err != nil {
 			return nil, err
 		}
 
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Incoming transaction to a wallet. CreditedAt is set when the amount is added to the balance.
+type Deposit struct {
+	ID            uuid.UUID
+	WalletID      uuid.UUID
+	Address       string
+	TxHash        string
+	Amount        uint64
+	Confirmations uint64
+	CreditedAt    sql.NullTime
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type DepositModel struct{}
+
+const depositColumns = "id, wallet_id, address, tx_hash, amount, confirmations, credited_at, created_at, updated_at"
+
+func scanDeposit(row interface{ Scan(...any) error }) (*Deposit, error) {
+	d := &Deposit{}
+	if err := row.Scan(&d.ID, &d.WalletID, &d.Address, &d.TxHash, &d.Amount, &d.Confirmations, &d.CreditedAt, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Creates the deposit of the transaction or updates it if it's already known. Pass only what the
+// wallet backend reports: the amount is overwritten until the deposit is credited, so a wrong one
+// never reaches the balance. Confirmations never go down, the callback and polling may report
+// them out of order.
+func (m DepositModel) Record(ec db.ExecContext, walletID uuid.UUID, address, txHash string, amount, confirmations uint64) (*Deposit, error) {
+	query := `
+		INSERT INTO deposits (wallet_id, address, tx_hash, amount, confirmations)
+		VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (wallet_id, tx_hash) DO UPDATE
+		SET
+			amount = CASE WHEN deposits.credited_at IS NULL THEN EXCLUDED.amount ELSE deposits.amount END,
+			confirmations = GREATEST(deposits.confirmations, EXCLUDED.confirmations),
+			updated_at = NOW()
+		RETURNING ` + depositColumns
+
+	return scanDeposit(ec.QueryRow(query, walletID, address, txHash, amount, confirmations))
+}
+
+// Reports whether the deposit was not credited before, so that it's credited only once
+func (m DepositModel) MarkCredited(ec db.ExecContext, id uuid.UUID) (bool, error) {
+	query := "UPDATE deposits SET credited_at = NOW(), updated_at = NOW() WHERE id = $1 AND credited_at IS NULL"
+
+	res, err := ec.Exec(query, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// Deposits waiting to be credited, oldest first
+func (m DepositModel) GetPendingForWallet(ec db.ExecContext, walletID uuid.UUID) ([]Deposit, error) {
+	query := "SELECT " + depositColumns + " FROM deposits WHERE wallet_id = $1 AND credited_at IS NULL ORDER BY created_at"
+
+	rows, err := ec.Query(query, walletID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deposits := make([]Deposit, 0)
+	for rows.Next() {
+		d, err := scanDeposit(rows)
+		if err != nil {
+			return nil, err
+		}
+		deposits = append(deposits, *d)
+	}
+
+	return deposits, nil
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+type EscrowStatus string
+
+const (
+	EscrowHeld     EscrowStatus = "held"
+	EscrowReleased EscrowStatus = "released"
+	EscrowRefunded EscrowStatus = "refunded"
+	EscrowSplit    EscrowStatus = "split"
+)
+
+type Escrow struct {
+	ID      uuid.UUID
+	OrderID uuid.UUID
+	Amount  uint64
+	Fee     uint64
+	Status  EscrowStatus
+
+	// Fee schedule version and commission that applied when the order was made
+	FeeScheduleID uuid.UUID
+	CommissionBps uint
+
+	CreatedAt time.Time
+	SettledAt sql.NullTime
+}
+
+func (e Escrow) IsHeld() bool {
+	return e.Status == EscrowHeld
+}
+
+type EscrowModel struct{}
+
+func (m EscrowModel) Create(ec db.ExecContext, orderID uuid.UUID, amount, fee uint64, feeScheduleID uuid.UUID, commissionBps uint) (*Escrow, error) {
+	query := `
+		INSERT INTO escrows (order_id, amount, fee, fee_schedule_id, commission_bps)
+		VALUES($1, $2, $3, $4, $5) RETURNING id, status, created_at
+	`
+
+	escrow := &Escrow{
+		OrderID:       orderID,
+		Amount:        amount,
+		Fee:           fee,
+		FeeScheduleID: feeScheduleID,
+		CommissionBps: commissionBps,
+	}
+
+	err := ec.QueryRow(query, orderID, amount, fee, feeScheduleID, commissionBps).Scan(&escrow.ID, &escrow.Status, &escrow.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+func (m EscrowModel) Get(ec db.ExecContext, id uuid.UUID) (*Escrow, error) {
+	query := "SELECT order_id, amount, fee, status, fee_schedule_id, commission_bps, created_at, settled_at FROM escrows WHERE id = $1"
+	escrow := &Escrow{
+		ID: id,
+	}
+
+	err := ec.QueryRow(query, id).Scan(&escrow.OrderID, &escrow.Amount, &escrow.Fee, &escrow.Status, &escrow.FeeScheduleID, &escrow.CommissionBps, &escrow.CreatedAt, &escrow.SettledAt)
+	if err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+func (m EscrowModel) GetForOrder(ec db.ExecContext, orderID uuid.UUID) (*Escrow, error) {
+	query := "SELECT id, amount, fee, status, fee_schedule_id, commission_bps, created_at, settled_at FROM escrows WHERE order_id = $1"
+	escrow := &Escrow{
+		OrderID: orderID,
+	}
+
+	err := ec.QueryRow(query, orderID).Scan(&escrow.ID, &escrow.Amount, &escrow.Fee, &escrow.Status, &escrow.FeeScheduleID, &escrow.CommissionBps, &escrow.CreatedAt, &escrow.SettledAt)
+	if err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
+
+// Moves a held escrow to its final status.
+// Returns sql.ErrNoRows if the escrow has already been settled.
+func (m EscrowModel) Settle(ec db.ExecContext, orderID uuid.UUID, status EscrowStatus) (*Escrow, error) {
+	query := `
+		UPDATE escrows SET status = $2, settled_at = NOW()
+		WHERE order_id = $1 AND status = 'held'
+		RETURNING id, amount, fee, fee_schedule_id, commission_bps, created_at, settled_at
+	`
+
+	escrow := &Escrow{
+		OrderID: orderID,
+		Status:  status,
+	}
+
+	err := ec.QueryRow(query, orderID, status).Scan(&escrow.ID, &escrow.Amount, &escrow.Fee, &escrow.FeeScheduleID, &escrow.CommissionBps, &escrow.CreatedAt, &escrow.SettledAt)
+	if err != nil {
+		return nil, err
+	}
+	return escrow, nil
+}
@@ -0,0 +1,213 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Commissions are in basis points (1/100 of a percent), fiat amounts in whole euros
+// and the pledge amount in piconeros.
+type FeeSchedule struct {
+	ID            uuid.UUID
+	Version       int
+	CommissionBps uint
+	WithdrawalFee int
+	WithdrawalMin int
+	PledgeAmount  uint64
+	CreatedAt     time.Time
+}
+
+type FeeTier struct {
+	ID            uuid.UUID
+	FeeScheduleID uuid.UUID
+	MinSales      int
+	CommissionBps uint
+}
+
+type VendorCommission struct {
+	VendorID      uuid.UUID
+	Username      string
+	CommissionBps uint
+	CreatedAt     time.Time
+}
+
+type FeeScheduleModel struct{}
+
+func (m FeeScheduleModel) Create(ec db.ExecContext, commissionBps uint, withdrawalFee, withdrawalMin int, pledgeAmount uint64) (*FeeSchedule, error) {
+	query := `
+		INSERT INTO fee_schedules (commission_bps, withdrawal_fee, withdrawal_min, pledge_amount)
+		VALUES($1, $2, $3, $4) RETURNING id, version, created_at
+	`
+
+	s := &FeeSchedule{
+		CommissionBps: commissionBps,
+		WithdrawalFee: withdrawalFee,
+		WithdrawalMin: withdrawalMin,
+		PledgeAmount:  pledgeAmount,
+	}
+
+	err := ec.QueryRow(query, commissionBps, withdrawalFee, withdrawalMin, pledgeAmount).Scan(&s.ID, &s.Version, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m FeeScheduleModel) Get(ec db.ExecContext, id uuid.UUID) (*FeeSchedule, error) {
+	query := "SELECT version, commission_bps, withdrawal_fee, withdrawal_min, pledge_amount, created_at FROM fee_schedules WHERE id = $1"
+
+	s := &FeeSchedule{
+		ID: id,
+	}
+
+	err := ec.QueryRow(query, id).Scan(&s.Version, &s.CommissionBps, &s.WithdrawalFee, &s.WithdrawalMin, &s.PledgeAmount, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Latest version of the fee schedule
+func (m FeeScheduleModel) GetCurrent(ec db.ExecContext) (*FeeSchedule, error) {
+	query := `
+		SELECT id, version, commission_bps, withdrawal_fee, withdrawal_min, pledge_amount, created_at
+		FROM fee_schedules
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	s := &FeeSchedule{}
+	err := ec.QueryRow(query).Scan(&s.ID, &s.Version, &s.CommissionBps, &s.WithdrawalFee, &s.WithdrawalMin, &s.PledgeAmount, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m FeeScheduleModel) GetAll(ec db.ExecContext) ([]FeeSchedule, error) {
+	query := `
+		SELECT id, version, commission_bps, withdrawal_fee, withdrawal_min, pledge_amount, created_at
+		FROM fee_schedules
+		ORDER BY version DESC
+	`
+
+	rows, err := ec.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make([]FeeSchedule, 0)
+	for rows.Next() {
+		s := FeeSchedule{}
+		if err := rows.Scan(&s.ID, &s.Version, &s.CommissionBps, &s.WithdrawalFee, &s.WithdrawalMin, &s.PledgeAmount, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, nil
+}
+
+type FeeTierModel struct{}
+
+func (m FeeTierModel) Create(ec db.ExecContext, feeScheduleID uuid.UUID, minSales int, commissionBps uint) (*FeeTier, error) {
+	query := "INSERT INTO fee_tiers (fee_schedule_id, min_sales, commission_bps) VALUES($1, $2, $3) RETURNING id"
+
+	t := &FeeTier{
+		FeeScheduleID: feeScheduleID,
+		MinSales:      minSales,
+		CommissionBps: commissionBps,
+	}
+
+	if err := ec.QueryRow(query, feeScheduleID, minSales, commissionBps).Scan(&t.ID); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Tiers of the schedule, smallest min_sales first
+func (m FeeTierModel) GetAllForSchedule(ec db.ExecContext, feeScheduleID uuid.UUID) ([]FeeTier, error) {
+	query := "SELECT id, min_sales, commission_bps FROM fee_tiers WHERE fee_schedule_id = $1 ORDER BY min_sales"
+
+	rows, err := ec.Query(query, feeScheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := make([]FeeTier, 0)
+	for rows.Next() {
+		t := FeeTier{
+			FeeScheduleID: feeScheduleID,
+		}
+		if err := rows.Scan(&t.ID, &t.MinSales, &t.CommissionBps); err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, t)
+	}
+
+	return tiers, nil
+}
+
+type VendorCommissionModel struct{}
+
+func (m VendorCommissionModel) Set(ec db.ExecContext, vendorID uuid.UUID, commissionBps uint) error {
+	query := `
+		INSERT INTO vendor_commissions (vendor_id, commission_bps) VALUES($1, $2)
+		ON CONFLICT (vendor_id) DO UPDATE SET commission_bps = EXCLUDED.commission_bps, created_at = NOW()
+	`
+	_, err := ec.Exec(query, vendorID, commissionBps)
+	return err
+}
+
+func (m VendorCommissionModel) Get(ec db.ExecContext, vendorID uuid.UUID) (*VendorCommission, error) {
+	query := `
+		SELECT users.username, vendor_commissions.commission_bps, vendor_commissions.created_at
+		FROM vendor_commissions
+		JOIN users ON users.id = vendor_commissions.vendor_id
+		WHERE vendor_commissions.vendor_id = $1
+	`
+
+	c := &VendorCommission{
+		VendorID: vendorID,
+	}
+
+	if err := ec.QueryRow(query, vendorID).Scan(&c.Username, &c.CommissionBps, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (m VendorCommissionModel) GetAll(ec db.ExecContext) ([]VendorCommission, error) {
+	query := `
+		SELECT vendor_commissions.vendor_id, users.username, vendor_commissions.commission_bps, vendor_commissions.created_at
+		FROM vendor_commissions
+		JOIN users ON users.id = vendor_commissions.vendor_id
+		ORDER BY users.username
+	`
+
+	rows, err := ec.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commissions := make([]VendorCommission, 0)
+	for rows.Next() {
+		c := VendorCommission{}
+		if err := rows.Scan(&c.VendorID, &c.Username, &c.CommissionBps, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		commissions = append(commissions, c)
+	}
+
+	return commissions, nil
+}
+
+func (m VendorCommissionModel) Delete(ec db.ExecContext, vendorID uuid.UUID) error {
+	query := "DELETE FROM vendor_commissions WHERE vendor_id = $1"
+	_, err := ec.Exec(query, vendorID)
+	return err
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+type LedgerAccount string
+
+const (
+	AccountOpening     LedgerAccount = "opening"
+	AccountUser        LedgerAccount = "user"
+	AccountEscrow      LedgerAccount = "escrow"
+	AccountFees        LedgerAccount = "fees"
+	AccountDeposits    LedgerAccount = "deposits"
+	AccountWithdrawals LedgerAccount = "withdrawals"
+	AccountPledge      LedgerAccount = "pledge"
+)
+
+type LedgerKind string
+
+const (
+	LedgerOpening       LedgerKind = "opening"
+	LedgerDeposit       LedgerKind = "deposit"
+	LedgerWithdrawal    LedgerKind = "withdrawal"
+	LedgerOrder         LedgerKind = "order"
+	LedgerRelease       LedgerKind = "release"
+	LedgerRefund        LedgerKind = "refund"
+	LedgerSplit         LedgerKind = "split"
+	LedgerPledge        LedgerKind = "pledge"
+	LedgerPledgeRefund  LedgerKind = "pledge refund"
+	LedgerPledgeForfeit LedgerKind = "pledge forfeit"
+)
+
+type LedgerTransaction struct {
+	ID          uuid.UUID
+	Kind        LedgerKind
+	ReferenceID uuid.UUID
+	CreatedAt   time.Time
+}
+
+type LedgerEntry struct {
+	ID            uuid.UUID
+	TransactionID uuid.UUID
+	Account       LedgerAccount
+	AccountID     uuid.UUID
+	Amount        int64
+	CreatedAt     time.Time
+
+	// Filled when read together with the transaction
+	Kind        LedgerKind
+	ReferenceID uuid.UUID
+}
+
+func (e LedgerEntry) IsCredit() bool {
+	return e.Amount > 0
+}
+
+// Absolute value of the entry
+func (e LedgerEntry) Abs() uint64 {
+	if e.Amount < 0 {
+		return uint64(-e.Amount)
+	}
+	return uint64(e.Amount)
+}
+
+// Wallet whose balance differs from the sum of its ledger entries
+type WalletMismatch struct {
+	UserID        uuid.UUID
+	Balance       uint64
+	LedgerBalance int64
+}
+
+type LedgerModel struct{}
+
+func (m LedgerModel) CreateTransaction(ec db.ExecContext, kind LedgerKind, referenceID uuid.UUID) (*LedgerTransaction, error) {
+	query := "INSERT INTO ledger_transactions (kind, reference_id) VALUES($1, $2) RETURNING id, created_at"
+
+	t := &LedgerTransaction{
+		Kind:        kind,
+		ReferenceID: referenceID,
+	}
+
+	if err := ec.QueryRow(query, kind, referenceID).Scan(&t.ID, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Entries are inserted with a single statement so the balance check passes even outside of a transaction
+func (m LedgerModel) CreateEntries(ec db.ExecContext, transactionID uuid.UUID, entries []LedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(entries))
+	args := make([]any, 0, 1+3*len(entries))
+	args = append(args, transactionID)
+
+	for i, e := range entries {
+		values = append(values, fmt.Sprintf("($1, $%d, $%d, $%d)", 3*i+2, 3*i+3, 3*i+4))
+		args = append(args, e.Account, e.AccountID, e.Amount)
+	}
+
+	query := "INSERT INTO ledger_entries (transaction_id, account, account_id, amount) VALUES " + strings.Join(values, ", ")
+	_, err := ec.Exec(query, args...)
+	return err
+}
+
+func (m LedgerModel) GetAllForAccount(ec db.ExecContext, account LedgerAccount, accountID uuid.UUID) ([]LedgerEntry, error) {
+	query := `
+		SELECT e.id, e.transaction_id, e.amount, e.created_at, t.kind, t.reference_id
+		FROM ledger_entries AS e
+		JOIN ledger_transactions AS t ON t.id = e.transaction_id
+		WHERE e.account = $1 AND e.account_id = $2
+		ORDER BY e.created_at DESC
+	`
+
+	rows, err := ec.Query(query, account, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]LedgerEntry, 0)
+	for rows.Next() {
+		e := LedgerEntry{
+			Account:   account,
+			AccountID: accountID,
+		}
+		if err := rows.Scan(&e.ID, &e.TransactionID, &e.Amount, &e.CreatedAt, &e.Kind, &e.ReferenceID); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (m LedgerModel) GetBalance(ec db.ExecContext, account LedgerAccount, accountID uuid.UUID) (int64, error) {
+	query := "SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE account = $1 AND account_id = $2"
+
+	var balance int64
+	if err := ec.QueryRow(query, account, accountID).Scan(&balance); err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+func (m LedgerModel) GetWalletMismatches(ec db.ExecContext) ([]WalletMismatch, error) {
+	query := `
+		SELECT wallets.user_id, wallets.balance, COALESCE(SUM(e.amount), 0)
+		FROM wallets
+		LEFT JOIN ledger_entries AS e ON e.account = 'user' AND e.account_id = wallets.user_id
+		GROUP BY wallets.user_id, wallets.balance
+		HAVING wallets.balance <> COALESCE(SUM(e.amount), 0)
+	`
+
+	rows, err := ec.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mismatches := make([]WalletMismatch, 0)
+	for rows.Next() {
+		wm := WalletMismatch{}
+		if err := rows.Scan(&wm.UserID, &wm.Balance, &wm.LedgerBalance); err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, wm)
+	}
+
+	return mismatches, nil
+}
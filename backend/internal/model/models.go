@@ -1,25 +1,42 @@
 package model
 
 type Models struct {
-	User            UserModel
-	Product         ProductModel
-	Price           PriceModel
-	Order           OrderModel
-	Review          ReviewModel
-	Invoice         InvoiceModel
-	Wallet          WalletModel
-	Withdrawal      WithdrawalModel
-	Transaction     TransactionMonel
-	Dispute         DisputeModel
-	CounterDispute  CounterDisputeModel
-	DisputeDecision DisputeDecisionModel
-	VendorPledge    VendorPledgeModel
-	DeliveryMethod  DeliveryMethodModel
-	DeclineReason   DeclineReasonModel
-	DeliveryInfo    DeliveryInfoModel
-	Ticket          TicketModel
-	TicketResponse  TicketResponseModel
-	Ban             BanModel
+	User             UserModel
+	Product          ProductModel
+	Price            PriceModel
+	Order            OrderModel
+	Review           ReviewModel
+	Invoice          InvoiceModel
+	Wallet           WalletModel
+	Withdrawal       WithdrawalModel
+	Deposit          DepositModel
+	Dispute          DisputeModel
+	CounterDispute   CounterDisputeModel
+	DisputeDecision  DisputeDecisionModel
+	VendorPledge     VendorPledgeModel
+	DeliveryMethod   DeliveryMethodModel
+	DeclineReason    DeclineReasonModel
+	DeliveryInfo     DeliveryInfoModel
+	Ticket           TicketModel
+	TicketResponse   TicketResponseModel
+	Ban              BanModel
+	Ledger           LedgerModel
+	Escrow           EscrowModel
+	OrderEvent       OrderEventModel
+	FeeSchedule      FeeScheduleModel
+	FeeTier          FeeTierModel
+	VendorCommission VendorCommissionModel
+	Quote            QuoteModel
+	OrderItem        OrderItemModel
+	Notification     NotificationModel
+	Staff            StaffModel
+	Audit            AuditModel
+	UserSession      UserSessionModel
+	Reputation       ReputationModel
+	Category         CategoryModel
+	ProductTag       ProductTagModel
+	ProductVersion   ProductVersionModel
+	ProductImage     ProductImageModel
 }
 
 var M Models
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"time"
+)
+
+// Message is a translation key formatted with Args
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Message   string
+	Args      []string
+	ReadAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+func (n Notification) IsRead() bool {
+	return n.ReadAt.Valid
+}
+
+type NotificationModel struct{}
+
+func (m NotificationModel) Create(ec db.ExecContext, userID uuid.UUID, message string, args ...string) (*Notification, error) {
+	query := "INSERT INTO notifications (user_id, message, args) VALUES($1, $2, $3) RETURNING id, created_at"
+
+	if args == nil {
+		args = []string{}
+	}
+	n := &Notification{
+		UserID:  userID,
+		Message: message,
+		Args:    args,
+	}
+
+	if err := ec.QueryRow(query, userID, message, args).Scan(&n.ID, &n.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// Notifications of the user, newest first
+func (m NotificationModel) GetAllForUser(ec db.ExecContext, userID uuid.UUID) ([]Notification, error) {
+	query := "SELECT id, message, args, read_at, created_at FROM notifications WHERE user_id = $1 ORDER BY created_at DESC"
+
+	rows, err := ec.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Scans the args array, database/sql can't do it on its own. Maps aren't safe for concurrent use.
+	types := pgtype.NewMap()
+
+	notifications := make([]Notification, 0)
+	for rows.Next() {
+		n := Notification{
+			UserID: userID,
+		}
+		if err := rows.Scan(&n.ID, &n.Message, types.SQLScanner(&n.Args), &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, nil
+}
+
+func (m NotificationModel) CountUnread(ec db.ExecContext, userID uuid.UUID) (int, error) {
+	query := "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL"
+
+	var count int
+	if err := ec.QueryRow(query, userID).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (m NotificationModel) MarkAllRead(ec db.ExecContext, userID uuid.UUID) error {
+	query := "UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL"
+	_, err := ec.Exec(query, userID)
+	return err
+}
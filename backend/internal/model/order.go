@@ -2,6 +2,7 @@ package model
 
 import (
 	"LuomuTori/internal/db"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"time"
@@ -19,11 +20,47 @@ const (
 	StatusDisputeSettled   OrderStatus = "dispute settled"
 )
 
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// Statuses an order can move to from each status.
+// Keep in sync with the orders_check_transition trigger.
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusPaid:             {StatusDelivered, StatusDeclined},
+	StatusDelivered:        {StatusCompleted, StatusDisputed},
+	StatusDisputed:         {StatusDisputeCountered, StatusDisputeSettled},
+	StatusDisputeCountered: {StatusDisputeSettled},
+}
+
+func CanTransition(from, to OrderStatus) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned when an order can't move from its current status to the requested one.
+// It matches ErrIllegalTransition with errors.Is.
+type TransitionError struct {
+	OrderID uuid.UUID
+	From    OrderStatus
+	To      OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order %s can't move from '%s' to '%s'", e.OrderID, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
 type Order struct {
 	ID               uuid.UUID
 	Status           OrderStatus
 	Details          string
-	PriceID          uuid.UUID
+	VendorID         uuid.UUID
 	DeliveryMethodID uuid.UUID
 	CustomerID       uuid.UUID
 	CreatedAt        time.Time
@@ -31,26 +68,31 @@ type Order struct {
 
 type OrderModel struct{}
 
-func validStatus(_ OrderStatus) bool {
-	return true
+func validStatus(status OrderStatus) bool {
+	switch status {
+	case StatusPaid, StatusDeclined, StatusDelivered, StatusCompleted,
+		StatusDisputed, StatusDisputeCountered, StatusDisputeSettled:
+		return true
+	}
+	return false
 }
 
-func (om OrderModel) Create(ec db.ExecContext, priceID uuid.UUID, deliveryMethodID uuid.UUID, customerID uuid.UUID, status OrderStatus, details string) (*Order, error) {
+func (om OrderModel) Create(ec db.ExecContext, vendorID uuid.UUID, deliveryMethodID uuid.UUID, customerID uuid.UUID, status OrderStatus, details string) (*Order, error) {
 	if !validStatus(status) {
 		return nil, fmt.Errorf("not a valid status: %s", status)
 	}
 
-	query := "INSERT INTO orders (status, details, price_id, delivery_method_id, customer_id) VALUES($1, $2, $3, $4, $5) RETURNING id, created_at"
+	query := "INSERT INTO orders (status, details, vendor_id, delivery_method_id, customer_id) VALUES($1, $2, $3, $4, $5) RETURNING id, created_at"
 
 	order := &Order{
 		Status:           status,
 		Details:          details,
-		PriceID:          priceID,
+		VendorID:         vendorID,
 		DeliveryMethodID: deliveryMethodID,
 		CustomerID:       customerID,
 	}
 
-	err := ec.QueryRow(query, status, details, priceID, deliveryMethodID, customerID).Scan(&order.ID, &order.CreatedAt)
+	err := ec.QueryRow(query, status, details, vendorID, deliveryMethodID, customerID).Scan(&order.ID, &order.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -58,13 +100,13 @@ func (om OrderModel) Create(ec db.ExecContext, priceID uuid.UUID, deliveryMethod
 }
 
 func (om OrderModel) Get(ec db.ExecContext, id uuid.UUID) (*Order, error) {
-	query := "SELECT status, details, price_id, delivery_method_id, customer_id, created_at FROM orders WHERE id = $1"
+	query := "SELECT status, details, vendor_id, delivery_method_id, customer_id, created_at FROM orders WHERE id = $1"
 
 	o := &Order{
 		ID: id,
 	}
 
-	err := ec.QueryRow(query, id).Scan(&o.Status, &o.Details, &o.PriceID, &o.DeliveryMethodID, &o.CustomerID, &o.CreatedAt)
+	err := ec.QueryRow(query, id).Scan(&o.Status, &o.Details, &o.VendorID, &o.DeliveryMethodID, &o.CustomerID, &o.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -73,7 +115,7 @@ func (om OrderModel) Get(ec db.ExecContext, id uuid.UUID) (*Order, error) {
 }
 
 func (om OrderModel) GetAll(ec db.ExecContext, customerID uuid.UUID) ([]Order, error) {
-	query := "SELECT id, status, details, price_id, delivery_method_id, created_at FROM orders WHERE customer_id = $1"
+	query := "SELECT id, status, details, vendor_id, delivery_method_id, created_at FROM orders WHERE customer_id = $1"
 
 	rows, err := ec.Query(query, customerID)
 	if err != nil {
@@ -87,7 +129,7 @@ func (om OrderModel) GetAll(ec db.ExecContext, customerID uuid.UUID) ([]Order, e
 		o := Order{
 			CustomerID: customerID,
 		}
-		err := rows.Scan(&o.ID, &o.Status, &o.Details, &o.PriceID, &o.DeliveryMethodID, &o.CreatedAt)
+		err := rows.Scan(&o.ID, &o.Status, &o.Details, &o.VendorID, &o.DeliveryMethodID, &o.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -99,7 +141,7 @@ func (om OrderModel) GetAll(ec db.ExecContext, customerID uuid.UUID) ([]Order, e
 }
 
 func (om OrderModel) GetAllWithStatus(ec db.ExecContext, status OrderStatus) ([]Order, error) {
-	query := "SELECT id, details, price_id, delivery_method_id, created_at FROM orders WHERE status = $1"
+	query := "SELECT id, details, vendor_id, delivery_method_id, created_at FROM orders WHERE status = $1"
 
 	rows, err := ec.Query(query, status)
 	if err != nil {
@@ -113,7 +155,7 @@ func (om OrderModel) GetAllWithStatus(ec db.ExecContext, status OrderStatus) ([]
 		o := Order{
 			Status: status,
 		}
-		err := rows.Scan(&o.ID, &o.Details, &o.PriceID, &o.DeliveryMethodID, &o.CreatedAt)
+		err := rows.Scan(&o.ID, &o.Details, &o.VendorID, &o.DeliveryMethodID, &o.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -126,11 +168,9 @@ func (om OrderModel) GetAllWithStatus(ec db.ExecContext, status OrderStatus) ([]
 
 func (om OrderModel) GetAllForVendor(ec db.ExecContext, vendorID uuid.UUID) ([]Order, error) {
 	query := `
-	SELECT orders.id, orders.status, orders.details, orders.price_id, orders.delivery_method_id, orders.customer_id, created_at 
+	SELECT id, status, details, delivery_method_id, customer_id, created_at
 	FROM orders
-	JOIN prices ON orders.price_id = prices.id
-	JOIN products ON prices.product_id = products.id
-	WHERE products.vendor_id = $1
+	WHERE vendor_id = $1
 	`
 
 	rows, err := ec.Query(query, vendorID)
@@ -142,8 +182,10 @@ func (om OrderModel) GetAllForVendor(ec db.ExecContext, vendorID uuid.UUID) ([]O
 	orders := make([]Order, 0)
 
 	for rows.Next() {
-		o := Order{}
-		err := rows.Scan(&o.ID, &o.Status, &o.Details, &o.DeliveryMethodID, &o.PriceID, &o.CustomerID, &o.CreatedAt)
+		o := Order{
+			VendorID: vendorID,
+		}
+		err := rows.Scan(&o.ID, &o.Status, &o.Details, &o.DeliveryMethodID, &o.CustomerID, &o.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -154,28 +196,29 @@ func (om OrderModel) GetAllForVendor(ec db.ExecContext, vendorID uuid.UUID) ([]O
 	return orders, nil
 }
 
+// Moves the order to status if the transition is legal. The row is locked until the end of the transaction,
+// so concurrent updates see the new status and fail instead of overwriting it.
 func (om OrderModel) UpdateStatus(ec db.ExecContext, id uuid.UUID, status OrderStatus) (*Order, error) {
-	// TODO: There could be more sanity checks
 	if !validStatus(status) {
 		return nil, fmt.Errorf("not a valid status: %s", status)
 	}
 
-	query := func() string {
-		switch status {
-		case StatusCompleted:
-			return fmt.Sprintf("UPDATE orders SET status = '%s' WHERE id = $1 AND status = 'delivered' RETURNING details, price_id, customer_id, created_at", status)
-		case StatusDisputeSettled:
-			return fmt.Sprintf("UPDATE orders SET status = '%s' WHERE id = $1 AND status = 'disputed' OR status = 'dispute countered' RETURNING details, price_id, customer_id, created_at", status)
-		default:
-			return fmt.Sprintf("UPDATE orders SET status = '%s' WHERE id = $1 RETURNING details, price_id, customer_id, created_at", status)
-		}
-	}()
+	var current OrderStatus
+	if err := ec.QueryRow("SELECT status FROM orders WHERE id = $1 FOR UPDATE", id).Scan(&current); err != nil {
+		return nil, err
+	}
+
+	if !CanTransition(current, status) {
+		return nil, &TransitionError{OrderID: id, From: current, To: status}
+	}
+
+	query := "UPDATE orders SET status = $2 WHERE id = $1 RETURNING details, vendor_id, delivery_method_id, customer_id, created_at"
 
 	o := &Order{
 		ID:     id,
 		Status: status,
 	}
-	err := ec.QueryRow(query, id).Scan(&o.Details, &o.PriceID, &o.CustomerID, &o.CreatedAt)
+	err := ec.QueryRow(query, id, status).Scan(&o.Details, &o.VendorID, &o.DeliveryMethodID, &o.CustomerID, &o.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -186,10 +229,8 @@ func (om OrderModel) UpdateStatus(ec db.ExecContext, id uuid.UUID, status OrderS
 func (om OrderModel) GetVendor(ec db.ExecContext, orderID uuid.UUID) (*User, error) {
 	query := `
 		SELECT users.id, users.username, users.created_at, users.pgp_key
-		FROM orders 
-		JOIN prices ON prices.id = orders.price_id	
-		JOIN products ON products.id = prices.product_id
-		JOIN users ON users.id = products.vendor_id	
+		FROM orders
+		JOIN users ON users.id = orders.vendor_id
 		WHERE orders.id = $1
 	`
 
@@ -201,3 +242,41 @@ func (om OrderModel) GetVendor(ec db.ExecContext, orderID uuid.UUID) (*User, err
 
 	return u, nil
 }
+
+// Orders of the vendor which still have funds in escrow
+func (om OrderModel) CountOpenForVendor(ec db.ExecContext, vendorID uuid.UUID) (int, error) {
+	query := "SELECT COUNT(*) FROM orders WHERE vendor_id = $1 AND status IN ('paid', 'delivered', 'disputed', 'dispute countered')"
+
+	var count int
+	if err := ec.QueryRow(query, vendorID).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (om OrderModel) CountDisputedForVendor(ec db.ExecContext, vendorID uuid.UUID) (int, error) {
+	query := "SELECT COUNT(*) FROM orders WHERE vendor_id = $1 AND status IN ('disputed', 'dispute countered')"
+
+	var count int
+	if err := ec.QueryRow(query, vendorID).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (om OrderModel) CountCompletedForVendor(ec db.ExecContext, vendorID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM orders
+		WHERE vendor_id = $1 AND status = 'completed'
+	`
+
+	var count int
+	if err := ec.QueryRow(query, vendorID).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+	"time"
+)
+
+type ActorRole string
+
+const (
+	ActorCustomer ActorRole = "customer"
+	ActorVendor   ActorRole = "vendor"
+	ActorAdmin    ActorRole = "admin"
+	ActorSystem   ActorRole = "system"
+)
+
+// Actor is whoever caused an order event. Admin and system actors have no user ID.
+type Actor struct {
+	Role ActorRole
+	ID   uuid.NullUUID
+}
+
+func CustomerActor(id uuid.UUID) Actor {
+	return Actor{Role: ActorCustomer, ID: uuid.NullUUID{UUID: id, Valid: true}}
+}
+
+func VendorActor(id uuid.UUID) Actor {
+	return Actor{Role: ActorVendor, ID: uuid.NullUUID{UUID: id, Valid: true}}
+}
+
+var (
+	AdminActor  = Actor{Role: ActorAdmin}
+	SystemActor = Actor{Role: ActorSystem}
+)
+
+type OrderEvent struct {
+	ID        uuid.UUID
+	OrderID   uuid.UUID
+	Status    OrderStatus
+	Actor     Actor
+	CreatedAt time.Time
+}
+
+type OrderEventModel struct{}
+
+func (m OrderEventModel) Create(ec db.ExecContext, orderID uuid.UUID, status OrderStatus, actor Actor) (*OrderEvent, error) {
+	query := "INSERT INTO order_events (order_id, status, actor_role, actor_id) VALUES($1, $2, $3, $4) RETURNING id, created_at"
+
+	event := &OrderEvent{
+		OrderID: orderID,
+		Status:  status,
+		Actor:   actor,
+	}
+
+	err := ec.QueryRow(query, orderID, status, actor.Role, actor.ID).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (m OrderEventModel) GetAllForOrder(ec db.ExecContext, orderID uuid.UUID) ([]OrderEvent, error) {
+	query := "SELECT id, status, actor_role, actor_id, created_at FROM order_events WHERE order_id = $1 ORDER BY created_at"
+
+	rows, err := ec.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]OrderEvent, 0)
+
+	for rows.Next() {
+		e := OrderEvent{
+			OrderID: orderID,
+		}
+		if err := rows.Scan(&e.ID, &e.Status, &e.Actor.Role, &e.Actor.ID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, nil
+}
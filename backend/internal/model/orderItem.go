@@ -0,0 +1,62 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+)
+
+// One line of an order. UnitPrice is the price of the pricing when the order was made,
+// in the currency of the product.
+type OrderItem struct {
+	ID        uuid.UUID
+	OrderID   uuid.UUID
+	PriceID   uuid.UUID
+	Count     int
+	UnitPrice int
+}
+
+func (i OrderItem) Total() int {
+	return i.Count * i.UnitPrice
+}
+
+type OrderItemModel struct{}
+
+func (m OrderItemModel) Create(ec db.ExecContext, orderID, priceID uuid.UUID, count, unitPrice int) (*OrderItem, error) {
+	query := "INSERT INTO order_items (order_id, price_id, count, unit_price) VALUES($1, $2, $3, $4) RETURNING id"
+
+	i := &OrderItem{
+		OrderID:   orderID,
+		PriceID:   priceID,
+		Count:     count,
+		UnitPrice: unitPrice,
+	}
+
+	if err := ec.QueryRow(query, orderID, priceID, count, unitPrice).Scan(&i.ID); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (m OrderItemModel) GetAllForOrder(ec db.ExecContext, orderID uuid.UUID) ([]OrderItem, error) {
+	query := "SELECT id, price_id, count, unit_price FROM order_items WHERE order_id = $1 ORDER BY position"
+
+	rows, err := ec.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]OrderItem, 0)
+	for rows.Next() {
+		i := OrderItem{
+			OrderID: orderID,
+		}
+		if err := rows.Scan(&i.ID, &i.PriceID, &i.Count, &i.UnitPrice); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+
+	return items, nil
+}
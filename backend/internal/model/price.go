@@ -5,25 +5,28 @@ import (
 	"github.com/google/uuid"
 )
 
+// Pricing of one version of a product
 type Price struct {
 	ID        uuid.UUID
 	Quantity  int
 	Price     int
 	ProductID uuid.UUID
+	VersionID uuid.UUID
 }
 
 type PriceModel struct{}
 
-func (pm PriceModel) Create(ec db.ExecContext, quantity int, price int, productID uuid.UUID) (*Price, error) {
-	query := "INSERT INTO prices (quantity, price, product_id) VALUES ($1, $2, $3) RETURNING id"
+func (pm PriceModel) Create(ec db.ExecContext, quantity int, price int, productID uuid.UUID, versionID uuid.UUID) (*Price, error) {
+	query := "INSERT INTO prices (quantity, price, product_id, version_id) VALUES ($1, $2, $3, $4) RETURNING id"
 
 	p := &Price{
 		Quantity:  quantity,
 		Price:     price,
 		ProductID: productID,
+		VersionID: versionID,
 	}
 
-	err := ec.QueryRow(query, quantity, price, productID).Scan(&p.ID)
+	err := ec.QueryRow(query, quantity, price, productID, versionID).Scan(&p.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -31,14 +34,15 @@ func (pm PriceModel) Create(ec db.ExecContext, quantity int, price int, productI
 	return p, err
 }
 
+// Returns the pricing of any version, orders keep pointing at the one they were made with
 func (pm PriceModel) Get(ec db.ExecContext, id uuid.UUID) (*Price, error) {
-	query := "SELECT quantity, price, product_id FROM prices WHERE id = $1"
+	query := "SELECT quantity, price, product_id, version_id FROM prices WHERE id = $1"
 
 	p := &Price{
 		ID: id,
 	}
 
-	err := ec.QueryRow(query, id).Scan(&p.Quantity, &p.Price, &p.ProductID)
+	err := ec.QueryRow(query, id).Scan(&p.Quantity, &p.Price, &p.ProductID, &p.VersionID)
 	if err != nil {
 		return nil, err
 	}
@@ -46,8 +50,34 @@ func (pm PriceModel) Get(ec db.ExecContext, id uuid.UUID) (*Price, error) {
 	return p, nil
 }
 
+// Returns sql.ErrNoRows if the pricing belongs to an old version of the product
+func (pm PriceModel) GetCurrent(ec db.ExecContext, id uuid.UUID) (*Price, error) {
+	query := `
+		SELECT prices.quantity, prices.price, prices.product_id, prices.version_id FROM prices
+		JOIN products ON products.version_id = prices.version_id
+		WHERE prices.id = $1
+	`
+
+	p := &Price{
+		ID: id,
+	}
+
+	err := ec.QueryRow(query, id).Scan(&p.Quantity, &p.Price, &p.ProductID, &p.VersionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Pricings of the current version of the product
 func (pm PriceModel) GetAll(ec db.ExecContext, productID uuid.UUID) ([]Price, error) {
-	query := "SELECT id, quantity, price FROM prices WHERE product_id = $1"
+	query := `
+		SELECT prices.id, prices.quantity, prices.price, prices.version_id FROM prices
+		JOIN products ON products.version_id = prices.version_id
+		WHERE products.id = $1
+		ORDER BY prices.quantity
+	`
 
 	rows, err := ec.Query(query, productID)
 	if err != nil {
@@ -61,7 +91,7 @@ func (pm PriceModel) GetAll(ec db.ExecContext, productID uuid.UUID) ([]Price, er
 		p := Price{
 			ProductID: productID,
 		}
-		err = rows.Scan(&p.ID, &p.Quantity, &p.Price)
+		err = rows.Scan(&p.ID, &p.Quantity, &p.Price, &p.VersionID)
 		if err != nil {
 			return nil, err
 		}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"LuomuTori/internal/db"
+	"database/sql"
 	"github.com/google/uuid"
 )
 
@@ -11,20 +12,57 @@ type Product struct {
 	Description   string
 	ImageFilename string
 	VendorID      uuid.UUID
+	// Prices and delivery methods of the product are in this currency
+	Currency Currency
+	// Grams left, unlimited if not valid
+	Stock sql.NullInt32
+	// Vendor is notified when stock falls to this
+	LowStock int
+	// Uncategorized if not valid
+	CategoryID uuid.NullUUID
+	// Current version, its pricings and delivery methods are the ones for sale
+	VersionID uuid.UUID
+	// Filled by Get and GetForUpdate
+	DeletedAt sql.NullTime
+}
+
+func (p Product) IsDeleted() bool {
+	return p.DeletedAt.Valid
+}
+
+// Whether quantity grams can be ordered
+func (p Product) InStock(quantity int) bool {
+	return !p.Stock.Valid || int(p.Stock.Int32) >= quantity
 }
 
 type ProductModel struct{}
 
-func (pm *ProductModel) Create(ec db.ExecContext, title string, description string, imageFilename string, vendorID uuid.UUID) (*Product, error) {
-	query := "INSERT INTO products (title, description, image_filename, vendor_id) VALUES ($1, $2, $3, $4) RETURNING id"
+// Listings of retiring vendors and vendors banned from selling are hidden
+const visibleProducts = `
+	products.deleted_at IS NULL AND EXISTS(
+		SELECT 1 FROM vendor_pledges
+		WHERE vendor_pledges.user_id = products.vendor_id AND vendor_pledges.status = 'active'
+	) AND NOT EXISTS(
+		SELECT 1 FROM bans
+		WHERE bans.user_id = products.vendor_id AND bans.scope IN ('selling', 'login')
+		AND (bans.expires_at IS NULL OR bans.expires_at > NOW())
+	)
+`
+
+func (pm *ProductModel) Create(ec db.ExecContext, title string, description string, imageFilename string, vendorID uuid.UUID, currency Currency, stock sql.NullInt32, lowStock int, categoryID uuid.NullUUID) (*Product, error) {
+	query := "INSERT INTO products (title, description, image_filename, vendor_id, currency, stock, low_stock, category_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
 	p := &Product{
 		Title:         title,
 		Description:   description,
 		ImageFilename: imageFilename,
 		VendorID:      vendorID,
+		Currency:      currency,
+		Stock:         stock,
+		LowStock:      lowStock,
+		CategoryID:    categoryID,
 	}
 
-	err := ec.QueryRow(query, title, description, imageFilename, vendorID).Scan(&p.ID)
+	err := ec.QueryRow(query, title, description, imageFilename, vendorID, currency, stock, lowStock, categoryID).Scan(&p.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -32,40 +70,22 @@ func (pm *ProductModel) Create(ec db.ExecContext, title string, description stri
 }
 
 func (pm *ProductModel) Get(ec db.ExecContext, id uuid.UUID) (*Product, error) {
-	query := "SELECT title, description, image_filename, vendor_id FROM products WHERE id = $1"
-
-	p := &Product{
-		ID: id,
-	}
-
-	err := ec.QueryRow(query, id).Scan(&p.Title, &p.Description, &p.ImageFilename, &p.VendorID)
-	if err != nil {
-		return nil, err
-	}
-
-	return p, nil
+	return pm.get(ec, "SELECT "+productColumns+" FROM products WHERE id = $1", id)
 }
 
-func (pm *ProductModel) GetAll(ec db.ExecContext) ([]Product, error) {
-	query := "SELECT id, title, description, image_filename, vendor_id FROM products WHERE deleted_at IS NULL"
+func (pm *ProductModel) GetForUpdate(ec db.ExecContext, id uuid.UUID) (*Product, error) {
+	return pm.get(ec, "SELECT "+productColumns+" FROM products WHERE id = $1 FOR UPDATE", id)
+}
 
-	products := make([]Product, 0)
+const productColumns = "id, title, description, image_filename, vendor_id, currency, stock, low_stock, category_id, version_id, deleted_at"
 
-	rows, err := ec.Query(query)
+func (pm *ProductModel) get(ec db.ExecContext, query string, args ...any) (*Product, error) {
+	p := &Product{}
+	err := ec.QueryRow(query, args...).Scan(&p.ID, &p.Title, &p.Description, &p.ImageFilename, &p.VendorID, &p.Currency, &p.Stock, &p.LowStock, &p.CategoryID, &p.VersionID, &p.DeletedAt)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		p := Product{}
-		err := rows.Scan(&p.ID, &p.Title, &p.Description, &p.ImageFilename, &p.VendorID)
-		if err != nil {
-			return nil, err
-		}
-		products = append(products, p)
-	}
-	return products, nil
+	return p, nil
 }
 
 func (pm *ProductModel) Delete(ec db.ExecContext, id uuid.UUID) error {
@@ -73,3 +93,40 @@ func (pm *ProductModel) Delete(ec db.ExecContext, id uuid.UUID) error {
 	_, err := ec.Exec(query, id)
 	return err
 }
+
+func (pm *ProductModel) SetStock(ec db.ExecContext, id uuid.UUID, stock sql.NullInt32, lowStock int) error {
+	query := "UPDATE products SET stock = $2, low_stock = $3 WHERE id = $1"
+	_, err := ec.Exec(query, id, stock, lowStock)
+	return err
+}
+
+// Makes the version current and copies its listing to the product
+func (pm *ProductModel) SetVersion(ec db.ExecContext, id uuid.UUID, version *ProductVersion) error {
+	query := "UPDATE products SET version_id = $2, title = $3, description = $4, image_filename = $5 WHERE id = $1"
+	_, err := ec.Exec(query, id, version.ID, version.Title, version.Description, version.ImageFilename)
+	return err
+}
+
+func (pm *ProductModel) SetCategory(ec db.ExecContext, id uuid.UUID, categoryID uuid.NullUUID) error {
+	query := "UPDATE products SET category_id = $2 WHERE id = $1"
+	_, err := ec.Exec(query, id, categoryID)
+	return err
+}
+
+// Takes grams from the stock in a single statement so concurrent orders can't oversell.
+// Returns sql.ErrNoRows if there isn't enough stock, the stock stays unlimited if it's not tracked.
+func (pm *ProductModel) TakeStock(ec db.ExecContext, id uuid.UUID, grams int) (*Product, error) {
+	query := `
+		UPDATE products SET stock = stock - $2
+		WHERE id = $1 AND (stock IS NULL OR stock >= $2)
+		RETURNING ` + productColumns
+
+	return pm.get(ec, query, id, grams)
+}
+
+// Returns grams to the stock of a product that tracks it
+func (pm *ProductModel) Restock(ec db.ExecContext, id uuid.UUID, grams int) error {
+	query := "UPDATE products SET stock = stock + $2 WHERE id = $1 AND stock IS NOT NULL"
+	_, err := ec.Exec(query, id, grams)
+	return err
+}
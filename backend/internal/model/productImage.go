@@ -0,0 +1,38 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+)
+
+type ProductImageModel struct{}
+
+// Adds the images to the version in the given order
+func (m ProductImageModel) Create(ec db.ExecContext, versionID uuid.UUID, filenames []string) error {
+	query := `
+		INSERT INTO product_images (version_id, filename, position)
+		SELECT $1, filename, position - 1 FROM unnest($2::text[]) WITH ORDINALITY AS images(filename, position)
+	`
+	_, err := ec.Exec(query, versionID, filenames)
+	return err
+}
+
+// Filenames of the images of the version in display order
+func (m ProductImageModel) GetAllForVersion(ec db.ExecContext, versionID uuid.UUID) ([]string, error) {
+	rows, err := ec.Query("SELECT filename FROM product_images WHERE version_id = $1 ORDER BY position", versionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filenames := make([]string, 0)
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+
+	return filenames, nil
+}
@@ -0,0 +1,241 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+)
+
+type ProductSort string
+
+const (
+	SortRelevance   ProductSort = "relevance"
+	SortNewest      ProductSort = "newest"
+	SortPriceAsc    ProductSort = "price-asc"
+	SortPriceDesc   ProductSort = "price-desc"
+	SortRating      ProductSort = "rating"
+	SortBestSelling ProductSort = "best-selling"
+)
+
+var ProductSorts = []ProductSort{SortRelevance, SortNewest, SortPriceAsc, SortPriceDesc, SortRating, SortBestSelling}
+
+func (s ProductSort) Label() string {
+	switch s {
+	case SortRelevance:
+		return "Relevance"
+	case SortNewest:
+		return "Newest"
+	case SortPriceAsc:
+		return "Cheapest first"
+	case SortPriceDesc:
+		return "Most expensive first"
+	case SortRating:
+		return "Best rated"
+	case SortBestSelling:
+		return "Best selling"
+	}
+	return string(s)
+}
+
+func ValidProductSort(s ProductSort) bool {
+	for _, sort := range ProductSorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+// Postgres text search configuration, each has its own column in products
+type SearchDictionary string
+
+const (
+	DictionaryFinnish SearchDictionary = "finnish"
+	DictionaryEnglish SearchDictionary = "english"
+)
+
+// Filters and ordering of a product search, zero values don't filter.
+// Prices are compared by the cheapest pricing of a product converted to XMR with Rates,
+// products in a currency without a rate don't match price bounds and are sorted last by price.
+type ProductQuery struct {
+	Text       string
+	Dictionary SearchDictionary
+	VendorID   uuid.NullUUID
+	// Matches the subcategories too
+	CategoryID     uuid.NullUUID
+	Tag            string
+	DeliveryMethod string
+	MinRating      int
+	MinXMR         float64
+	MaxXMR         float64
+	// XMR price of each currency
+	Rates  map[Currency]float64
+	Sort   ProductSort
+	Limit  int
+	Offset int
+}
+
+// Returns a page of visible products matching the query and the number of all matches
+func (pm *ProductModel) Search(ec db.ExecContext, q ProductQuery) ([]Product, int, error) {
+	args := make([]any, 0)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	currencies := make([]string, 0, len(q.Rates))
+	prices := make([]float64, 0, len(q.Rates))
+	for currency, price := range q.Rates {
+		if price > 0 {
+			currencies = append(currencies, string(currency))
+			prices = append(prices, price)
+		}
+	}
+
+	dictionary, searchColumn := DictionaryEnglish, "products.search_english"
+	if q.Dictionary == DictionaryFinnish {
+		dictionary, searchColumn = DictionaryFinnish, "products.search_finnish"
+	}
+
+	rank := "0"
+	conditions := []string{visibleProducts}
+	if q.Text != "" {
+		tsquery := fmt.Sprintf("websearch_to_tsquery(%s::regconfig, %s)", arg(dictionary), arg(q.Text))
+		conditions = append(conditions, fmt.Sprintf("%s @@ %s", searchColumn, tsquery))
+		rank = fmt.Sprintf("ts_rank(%s, %s)", searchColumn, tsquery)
+	}
+	if q.VendorID.Valid {
+		conditions = append(conditions, "products.vendor_id = "+arg(q.VendorID.UUID))
+	}
+	if q.CategoryID.Valid {
+		conditions = append(conditions, fmt.Sprintf(`products.category_id IN (
+			WITH RECURSIVE subtree(id) AS (
+				SELECT id FROM categories WHERE id = %s
+				UNION ALL
+				SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+			)
+			SELECT id FROM subtree
+		)`, arg(q.CategoryID.UUID)))
+	}
+	if q.Tag != "" {
+		conditions = append(conditions, "EXISTS(SELECT 1 FROM product_tags WHERE product_tags.product_id = products.id AND product_tags.tag = "+arg(q.Tag)+")")
+	}
+	if q.DeliveryMethod != "" {
+		conditions = append(conditions, fmt.Sprintf(`EXISTS(
+			SELECT 1 FROM delivery_methods
+			WHERE delivery_methods.version_id = products.version_id AND delivery_methods.description ILIKE %s
+		)`, arg("%"+escapeLike(q.DeliveryMethod)+"%")))
+	}
+	if q.MinRating > 0 {
+		conditions = append(conditions, "COALESCE(ratings.grade, 0) >= "+arg(q.MinRating))
+	}
+	if q.MinXMR > 0 {
+		conditions = append(conditions, "cheapest.price / rates.xmr_price >= "+arg(q.MinXMR))
+	}
+	if q.MaxXMR > 0 {
+		conditions = append(conditions, "cheapest.price / rates.xmr_price <= "+arg(q.MaxXMR))
+	}
+
+	var order string
+	switch q.Sort {
+	case SortPriceAsc:
+		order = "cheapest.price / rates.xmr_price ASC NULLS LAST"
+	case SortPriceDesc:
+		order = "cheapest.price / rates.xmr_price DESC NULLS LAST"
+	case SortRating:
+		order = "COALESCE(ratings.grade, 0) DESC"
+	case SortBestSelling:
+		order = "sales.count DESC"
+	case SortRelevance:
+		order = rank + " DESC"
+	}
+	if order == "" {
+		order = "products.created_at DESC"
+	} else {
+		order += ", products.created_at DESC"
+	}
+
+	query := fmt.Sprintf(`
+		WITH rates(currency, xmr_price) AS (
+			SELECT * FROM unnest(%s::text[], %s::float8[])
+		),
+		-- A review counts once for each product of the reviewed order
+		ratings(product_id, grade) AS (
+			SELECT reviewed.product_id, AVG(reviews.grade)
+			FROM reviews
+			JOIN (
+				SELECT DISTINCT order_items.order_id, prices.product_id FROM order_items
+				JOIN prices ON prices.id = order_items.price_id
+			) AS reviewed ON reviewed.order_id = reviews.order_id
+			GROUP BY reviewed.product_id
+		)
+		SELECT products.id, products.title, products.description, products.image_filename, products.vendor_id,
+			products.currency, products.stock, products.low_stock, products.category_id, products.version_id, COUNT(*) OVER()
+		FROM products
+		LEFT JOIN rates ON rates.currency = products.currency
+		CROSS JOIN LATERAL (
+			SELECT MIN(prices.price)::float8 AS price FROM prices WHERE prices.version_id = products.version_id
+		) AS cheapest
+		LEFT JOIN ratings ON ratings.product_id = products.id
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM(order_items.count), 0) AS count FROM order_items
+			JOIN prices ON prices.id = order_items.price_id
+			JOIN orders ON orders.id = order_items.order_id
+			WHERE prices.product_id = products.id AND orders.status <> 'declined'
+		) AS sales
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s OFFSET %s
+	`, arg(currencies), arg(prices), strings.Join(conditions, " AND "), order, arg(q.Limit), arg(q.Offset))
+
+	rows, err := ec.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	products := make([]Product, 0)
+	for rows.Next() {
+		p := Product{}
+		err := rows.Scan(&p.ID, &p.Title, &p.Description, &p.ImageFilename, &p.VendorID, &p.Currency, &p.Stock, &p.LowStock, &p.CategoryID, &p.VersionID, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		products = append(products, p)
+	}
+
+	return products, total, nil
+}
+
+// Vendors with visible products, ordered by username
+func (pm *ProductModel) GetVendors(ec db.ExecContext) ([]User, error) {
+	query := `
+		SELECT DISTINCT users.id, users.username FROM users
+		JOIN products ON products.vendor_id = users.id
+		WHERE ` + visibleProducts + `
+		ORDER BY users.username
+	`
+
+	rows, err := ec.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vendors := make([]User, 0)
+	for rows.Next() {
+		u := User{}
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, err
+		}
+		vendors = append(vendors, u)
+	}
+
+	return vendors, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
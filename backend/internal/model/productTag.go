@@ -0,0 +1,41 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+)
+
+type ProductTagModel struct{}
+
+// Replaces the tags of the product
+func (m ProductTagModel) Set(ec db.ExecContext, productID uuid.UUID, tags []string) error {
+	if _, err := ec.Exec("DELETE FROM product_tags WHERE product_id = $1", productID); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	_, err := ec.Exec("INSERT INTO product_tags (product_id, tag) SELECT $1, unnest($2::text[])", productID, tags)
+	return err
+}
+
+func (m ProductTagModel) GetAllForProduct(ec db.ExecContext, productID uuid.UUID) ([]string, error) {
+	rows, err := ec.Query("SELECT tag FROM product_tags WHERE product_id = $1 ORDER BY tag", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]string, 0)
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
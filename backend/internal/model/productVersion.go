@@ -0,0 +1,84 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Snapshot of a listing. Versions are numbered from 1 and never change once created.
+type ProductVersion struct {
+	ID            uuid.UUID
+	ProductID     uuid.UUID
+	Version       int
+	Title         string
+	Description   string
+	ImageFilename string
+	CreatedAt     time.Time
+}
+
+type ProductVersionModel struct{}
+
+// Creates the next version of the product. Lock the product first so concurrent edits get their own numbers.
+func (m ProductVersionModel) Create(ec db.ExecContext, productID uuid.UUID, title, description, imageFilename string) (*ProductVersion, error) {
+	query := `
+		INSERT INTO product_versions (product_id, version, title, description, image_filename)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4 FROM product_versions WHERE product_id = $1
+		RETURNING id, version, created_at
+	`
+
+	v := &ProductVersion{
+		ProductID:     productID,
+		Title:         title,
+		Description:   description,
+		ImageFilename: imageFilename,
+	}
+
+	if err := ec.QueryRow(query, productID, title, description, imageFilename).Scan(&v.ID, &v.Version, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (m ProductVersionModel) Get(ec db.ExecContext, id uuid.UUID) (*ProductVersion, error) {
+	query := "SELECT product_id, version, title, description, image_filename, created_at FROM product_versions WHERE id = $1"
+
+	v := &ProductVersion{
+		ID: id,
+	}
+
+	if err := ec.QueryRow(query, id).Scan(&v.ProductID, &v.Version, &v.Title, &v.Description, &v.ImageFilename, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Versions of the product, newest first
+func (m ProductVersionModel) GetAllForProduct(ec db.ExecContext, productID uuid.UUID) ([]ProductVersion, error) {
+	query := `
+		SELECT id, version, title, description, image_filename, created_at FROM product_versions
+		WHERE product_id = $1
+		ORDER BY version DESC
+	`
+
+	rows, err := ec.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]ProductVersion, 0)
+	for rows.Next() {
+		v := ProductVersion{
+			ProductID: productID,
+		}
+		if err := rows.Scan(&v.ID, &v.Version, &v.Title, &v.Description, &v.ImageFilename, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Quote locks the XMR amount of an order for a while.
+// Fiat totals are in the currency of the product.
+type Quote struct {
+	ID               uuid.UUID
+	CustomerID       uuid.UUID
+	VendorID         uuid.UUID
+	DeliveryMethodID uuid.UUID
+	Currency         Currency
+	ItemTotal        int
+	DeliveryTotal    int
+	XMRAmount        uint64
+	Fee              uint64
+	FeeScheduleID    uuid.UUID
+	CommissionBps    uint
+	OrderID          uuid.NullUUID
+	ExpiresAt        time.Time
+	CreatedAt        time.Time
+	Items            []QuoteItem
+}
+
+type QuoteItem struct {
+	ID        uuid.UUID
+	QuoteID   uuid.UUID
+	PriceID   uuid.UUID
+	Count     int
+	UnitPrice int
+}
+
+func (q Quote) FiatTotal() int {
+	return q.ItemTotal + q.DeliveryTotal
+}
+
+func (q Quote) IsExpired() bool {
+	return time.Now().After(q.ExpiresAt)
+}
+
+func (q Quote) IsUsed() bool {
+	return q.OrderID.Valid
+}
+
+type QuoteModel struct{}
+
+// Creates the quote with its items, call inside a transaction
+func (m QuoteModel) Create(ec db.ExecContext, q Quote) (*Quote, error) {
+	query := `
+		INSERT INTO quotes (customer_id, vendor_id, delivery_method_id, currency, item_total, delivery_total,
+			xmr_amount, fee, fee_schedule_id, commission_bps, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at
+	`
+
+	err := ec.QueryRow(query, q.CustomerID, q.VendorID, q.DeliveryMethodID, q.Currency, q.ItemTotal, q.DeliveryTotal,
+		q.XMRAmount, q.Fee, q.FeeScheduleID, q.CommissionBps, q.ExpiresAt).Scan(&q.ID, &q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	itemQuery := "INSERT INTO quote_items (quote_id, price_id, count, unit_price) VALUES($1, $2, $3, $4) RETURNING id"
+	for i := range q.Items {
+		item := &q.Items[i]
+		item.QuoteID = q.ID
+		if err := ec.QueryRow(itemQuery, q.ID, item.PriceID, item.Count, item.UnitPrice).Scan(&item.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &q, nil
+}
+
+func (m QuoteModel) Get(ec db.ExecContext, id uuid.UUID) (*Quote, error) {
+	return m.get(ec, "SELECT "+quoteColumns+" FROM quotes WHERE id = $1", id)
+}
+
+// Locks the quote until the end of the transaction so it can't be used twice
+func (m QuoteModel) GetForUpdate(ec db.ExecContext, id uuid.UUID) (*Quote, error) {
+	return m.get(ec, "SELECT "+quoteColumns+" FROM quotes WHERE id = $1 FOR UPDATE", id)
+}
+
+func (m QuoteModel) SetOrder(ec db.ExecContext, id, orderID uuid.UUID) error {
+	query := "UPDATE quotes SET order_id = $2 WHERE id = $1 AND order_id IS NULL"
+	_, err := ec.Exec(query, id, orderID)
+	return err
+}
+
+const quoteColumns = `id, customer_id, vendor_id, delivery_method_id, currency, item_total, delivery_total,
+	xmr_amount, fee, fee_schedule_id, commission_bps, order_id, expires_at, created_at`
+
+func (m QuoteModel) get(ec db.ExecContext, query string, id uuid.UUID) (*Quote, error) {
+	q := &Quote{}
+	err := ec.QueryRow(query, id).Scan(&q.ID, &q.CustomerID, &q.VendorID, &q.DeliveryMethodID, &q.Currency, &q.ItemTotal, &q.DeliveryTotal,
+		&q.XMRAmount, &q.Fee, &q.FeeScheduleID, &q.CommissionBps, &q.OrderID, &q.ExpiresAt, &q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := ec.Query("SELECT id, price_id, count, unit_price FROM quote_items WHERE quote_id = $1 ORDER BY position", q.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	q.Items = make([]QuoteItem, 0)
+	for rows.Next() {
+		item := QuoteItem{
+			QuoteID: q.ID,
+		}
+		if err := rows.Scan(&item.ID, &item.PriceID, &item.Count, &item.UnitPrice); err != nil {
+			return nil, err
+		}
+		q.Items = append(q.Items, item)
+	}
+
+	return q, nil
+}
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Precomputed reputation of a vendor. Component scores are in [0, 1] and Score in [0, 100].
+// WeightedGrade is the average review grade weighted by order value and recency.
+type Reputation struct {
+	VendorID         uuid.UUID
+	Score            float64
+	ReviewScore      float64
+	DisputeScore     float64
+	DeclineScore     float64
+	DeliveryScore    float64
+	AgeScore         float64
+	WeightedGrade    float64
+	NumReviews       int
+	NumOrders        int
+	NumDisputes      int
+	NumDisputesLost  int
+	NumDeclined      int
+	AvgDeliveryHours float64
+	AccountAgeDays   int
+	UpdatedAt        time.Time
+}
+
+// Review grade with the value of its order in piconeros
+type GradedOrder struct {
+	Grade     int
+	XMRValue  uint64
+	CreatedAt time.Time
+}
+
+// Order history of a vendor the reputation is computed from
+type VendorStats struct {
+	AccountCreatedAt time.Time
+	NumOrders        int
+	NumDeclined      int
+	NumDisputes      int
+	NumDisputesLost  int
+	NumDisputesDrawn int
+	NumDelivered     int
+	AvgDeliveryHours float64
+}
+
+type ReputationModel struct{}
+
+const reputationColumns = `vendor_id, score, review_score, dispute_score, decline_score, delivery_score, age_score,
+	weighted_grade, num_reviews, num_orders, num_disputes, num_disputes_lost, num_declined,
+	avg_delivery_hours, account_age_days, updated_at`
+
+func (m ReputationModel) Upsert(ec db.ExecContext, r *Reputation) error {
+	query := `
+		INSERT INTO vendor_reputations (` + reputationColumns + `)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NOW())
+		ON CONFLICT (vendor_id) DO UPDATE SET
+			score = EXCLUDED.score,
+			review_score = EXCLUDED.review_score,
+			dispute_score = EXCLUDED.dispute_score,
+			decline_score = EXCLUDED.decline_score,
+			delivery_score = EXCLUDED.delivery_score,
+			age_score = EXCLUDED.age_score,
+			weighted_grade = EXCLUDED.weighted_grade,
+			num_reviews = EXCLUDED.num_reviews,
+			num_orders = EXCLUDED.num_orders,
+			num_disputes = EXCLUDED.num_disputes,
+			num_disputes_lost = EXCLUDED.num_disputes_lost,
+			num_declined = EXCLUDED.num_declined,
+			avg_delivery_hours = EXCLUDED.avg_delivery_hours,
+			account_age_days = EXCLUDED.account_age_days,
+			updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`
+
+	return ec.QueryRow(query, r.VendorID, r.Score, r.ReviewScore, r.DisputeScore, r.DeclineScore, r.DeliveryScore, r.AgeScore,
+		r.WeightedGrade, r.NumReviews, r.NumOrders, r.NumDisputes, r.NumDisputesLost, r.NumDeclined,
+		r.AvgDeliveryHours, r.AccountAgeDays).Scan(&r.UpdatedAt)
+}
+
+// Returns sql.ErrNoRows when the reputation job hasn't rated the vendor yet
+func (m ReputationModel) Get(ec db.ExecContext, vendorID uuid.UUID) (*Reputation, error) {
+	query := "SELECT " + reputationColumns + " FROM vendor_reputations WHERE vendor_id = $1"
+
+	r := &Reputation{}
+	err := ec.QueryRow(query, vendorID).Scan(&r.VendorID, &r.Score, &r.ReviewScore, &r.DisputeScore, &r.DeclineScore,
+		&r.DeliveryScore, &r.AgeScore, &r.WeightedGrade, &r.NumReviews, &r.NumOrders, &r.NumDisputes,
+		&r.NumDisputesLost, &r.NumDeclined, &r.AvgDeliveryHours, &r.AccountAgeDays, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Every user that has ever pledged
+func (m ReputationModel) GetAllVendorIDs(ec db.ExecContext) ([]uuid.UUID, error) {
+	rows, err := ec.Query("SELECT user_id FROM vendor_pledges")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (m ReputationModel) GetGradedOrders(ec db.ExecContext, vendorID uuid.UUID) ([]GradedOrder, error) {
+	query := `
+		SELECT reviews.grade, COALESCE(escrows.amount + escrows.fee, 0), reviews.created_at
+		FROM reviews
+		JOIN orders ON orders.id = reviews.order_id
+		LEFT JOIN escrows ON escrows.order_id = orders.id
+		WHERE orders.vendor_id = $1
+	`
+
+	rows, err := ec.Query(query, vendorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	graded := make([]GradedOrder, 0)
+	for rows.Next() {
+		g := GradedOrder{}
+		if err := rows.Scan(&g.Grade, &g.XMRValue, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		graded = append(graded, g)
+	}
+
+	return graded, nil
+}
+
+// Delivery latency is measured from the payment, which happens when the order is created
+func (m ReputationModel) GetVendorStats(ec db.ExecContext, vendorID uuid.UUID) (*VendorStats, error) {
+	query := `
+		SELECT users.created_at,
+			COUNT(DISTINCT orders.id),
+			COUNT(DISTINCT orders.id) FILTER (WHERE orders.status = 'declined'),
+			COUNT(DISTINCT disputes.id),
+			COUNT(DISTINCT dispute_decisions.id) FILTER (WHERE dispute_decisions.outcome = 'customer won'),
+			COUNT(DISTINCT dispute_decisions.id) FILTER (WHERE dispute_decisions.outcome = 'draw'),
+			COUNT(DISTINCT delivery_infos.id),
+			-- Averaged apart from the joins, which repeat a delivery for each dispute decision
+			(
+				SELECT COALESCE(AVG(EXTRACT(EPOCH FROM d.created_at - o.created_at)) / 3600, 0)::float8
+				FROM delivery_infos AS d
+				JOIN orders AS o ON o.id = d.order_id
+				WHERE o.vendor_id = users.id
+			)
+		FROM users
+		LEFT JOIN orders ON orders.vendor_id = users.id
+		LEFT JOIN disputes ON disputes.order_id = orders.id
+		LEFT JOIN dispute_decisions ON dispute_decisions.dispute_id = disputes.id
+		LEFT JOIN delivery_infos ON delivery_infos.order_id = orders.id
+		WHERE users.id = $1
+		GROUP BY users.id
+	`
+
+	s := &VendorStats{}
+	err := ec.QueryRow(query, vendorID).Scan(&s.AccountCreatedAt, &s.NumOrders, &s.NumDeclined, &s.NumDisputes,
+		&s.NumDisputesLost, &s.NumDisputesDrawn, &s.NumDelivered, &s.AvgDeliveryHours)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -31,6 +31,20 @@ func (m ReviewModel) Create(ec db.ExecContext, grade int, message string, orderI
 	return r, nil
 }
 
+func (m ReviewModel) Get(ec db.ExecContext, id uuid.UUID) (*Review, error) {
+	query := "SELECT grade, message, order_id FROM reviews WHERE id = $1"
+
+	r := &Review{
+		ID: id,
+	}
+
+	if err := ec.QueryRow(query, id).Scan(&r.Grade, &r.Message, &r.OrderID); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
 func (m ReviewModel) GetAuthor(ec db.ExecContext, reviewID uuid.UUID) (*User, error) {
 	query := `
 		SELECT users.id, users.username, users.created_at
@@ -53,9 +67,11 @@ func (m ReviewModel) GetAllForProduct(ec db.ExecContext, productID uuid.UUID) ([
 	query := `
 		SELECT reviews.id, reviews.grade, reviews.message, reviews.order_id
 		FROM reviews
-		JOIN orders ON orders.id = reviews.order_id
-		JOIN prices ON prices.id = orders.price_id
-		WHERE prices.product_id = $1;
+		WHERE EXISTS (
+			SELECT 1 FROM order_items
+			JOIN prices ON prices.id = order_items.price_id
+			WHERE order_items.order_id = reviews.order_id AND prices.product_id = $1
+		);
 		`
 
 	rows, err := ec.Query(query, productID)
@@ -82,10 +98,8 @@ func (m ReviewModel) GetAllForVendor(ec db.ExecContext, vendorID uuid.UUID) ([]R
 	query := `
 		SELECT reviews.id, reviews.grade, reviews.message, reviews.order_id
 		FROM reviews
-		JOIN orders ON reviews.order_id = orders.order_id
-		JOIN prices ON orders.price_id = prices.id
-		JOIN products ON prices.product_id = products.id
-		WHERE products.vendor_id = $1;
+		JOIN orders ON orders.id = reviews.order_id
+		WHERE orders.vendor_id = $1;
 		`
 
 	rows, err := ec.Query(query, vendorID)
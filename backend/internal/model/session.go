@@ -0,0 +1,35 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"github.com/google/uuid"
+)
+
+// Maps the tokens of the scs session store to users
+type UserSessionModel struct{}
+
+func (m UserSessionModel) Create(ec db.ExecContext, token string, userID uuid.UUID) error {
+	_, err := ec.Exec("INSERT INTO user_sessions (token, user_id) VALUES($1, $2) ON CONFLICT (token) DO NOTHING", token, userID)
+	return err
+}
+
+func (m UserSessionModel) Delete(ec db.ExecContext, token string) error {
+	_, err := ec.Exec("DELETE FROM user_sessions WHERE token = $1", token)
+	return err
+}
+
+// Deletes every session of the user from the session store, which logs the user out everywhere
+func (m UserSessionModel) RevokeAllForUser(ec db.ExecContext, userID uuid.UUID) (int64, error) {
+	query := "DELETE FROM sessions WHERE token IN (SELECT token FROM user_sessions WHERE user_id = $1)"
+
+	res, err := ec.Exec(query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := ec.Exec("DELETE FROM user_sessions WHERE user_id = $1", userID); err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"LuomuTori/internal/db"
+	"database/sql"
+	"github.com/google/uuid"
+	"time"
+)
+
+type StaffRole string
+
+const (
+	// Bans users and removes listings, reviews and handles tickets
+	RoleModerator StaffRole = "moderator"
+	// Settles disputes
+	RoleArbiter StaffRole = "arbiter"
+	// Manages fee schedules and vendor commissions
+	RoleFinance StaffRole = "finance"
+	// Has every role
+	RoleSuperadmin StaffRole = "superadmin"
+)
+
+var StaffRoles = []StaffRole{RoleModerator, RoleArbiter, RoleFinance, RoleSuperadmin}
+
+func ValidStaffRole(role StaffRole) bool {
+	for _, r := range StaffRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type Staff struct {
+	ID         uuid.UUID
+	Username   string
+	PgpKey     string
+	Roles      []StaffRole
+	CreatedAt  time.Time
+	DisabledAt sql.NullTime
+}
+
+func (s Staff) HasRole(role StaffRole) bool {
+	for _, r := range s.Roles {
+		if r == role || r == RoleSuperadmin {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Staff) IsDisabled() bool {
+	return s.DisabledAt.Valid
+}
+
+type StaffModel struct{}
+
+func (m StaffModel) Create(ec db.ExecContext, username string, passwordHash []byte, pgpKey string) (*Staff, error) {
+	query := "INSERT INTO staff (username, password_hash, pgp_key) VALUES($1, $2, $3) RETURNING id, created_at"
+
+	s := &Staff{
+		Username: username,
+		PgpKey:   pgpKey,
+		Roles:    []StaffRole{},
+	}
+
+	if err := ec.QueryRow(query, username, passwordHash, pgpKey).Scan(&s.ID, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m StaffModel) AddRole(ec db.ExecContext, staffID uuid.UUID, role StaffRole) error {
+	query := "INSERT INTO staff_roles (staff_id, role) VALUES($1, $2) ON CONFLICT DO NOTHING"
+	_, err := ec.Exec(query, staffID, role)
+	return err
+}
+
+func (m StaffModel) Get(ec db.ExecContext, id uuid.UUID) (*Staff, error) {
+	return m.get(ec, "SELECT id, username, pgp_key, created_at, disabled_at FROM staff WHERE id = $1", id)
+}
+
+func (m StaffModel) GetWithName(ec db.ExecContext, username string) (*Staff, error) {
+	return m.get(ec, "SELECT id, username, pgp_key, created_at, disabled_at FROM staff WHERE username = $1", username)
+}
+
+func (m StaffModel) GetHashedPassword(ec db.ExecContext, id uuid.UUID) ([]byte, error) {
+	var hash []byte
+	if err := ec.QueryRow("SELECT password_hash FROM staff WHERE id = $1", id).Scan(&hash); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+func (m StaffModel) get(ec db.ExecContext, query string, arg any) (*Staff, error) {
+	s := &Staff{}
+	if err := ec.QueryRow(query, arg).Scan(&s.ID, &s.Username, &s.PgpKey, &s.CreatedAt, &s.DisabledAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := ec.Query("SELECT role FROM staff_roles WHERE staff_id = $1", s.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s.Roles = make([]StaffRole, 0)
+	for rows.Next() {
+		var role StaffRole
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		s.Roles = append(s.Roles, role)
+	}
+
+	return s, nil
+}
@@ -136,7 +136,8 @@ func (um UserModel) GetHashedPassword(ec db.ExecContext, id uuid.UUID) ([]byte,
 }
 
 func (m UserModel) IsVendor(ec db.ExecContext, id uuid.UUID) bool {
-	query := "SELECT 1 FROM vendor_pledges WHERE user_id = $1"
+	// Retiring vendors still handle their open orders
+	query := "SELECT 1 FROM vendor_pledges WHERE user_id = $1 AND status <> 'retired'"
 	var i int = 0
 	err := ec.QueryRow(query, id).Scan(&i)
 	return err == nil && i == 1
@@ -2,30 +2,73 @@ package model
 
 import (
 	"LuomuTori/internal/db"
+	"database/sql"
 	"github.com/google/uuid"
 	"time"
 )
 
+type PledgeStatus string
+
+const (
+	PledgeActive   PledgeStatus = "active"
+	PledgeRetiring PledgeStatus = "retiring"
+	PledgeRetired  PledgeStatus = "retired"
+)
+
+// Levels of the pledge are counted with the pledge amount of FeeScheduleID
 type VendorPledge struct {
-	ID           uuid.UUID
-	Amount       uint64
-	LogoFilename string
-	UserID       uuid.UUID
-	CreatedAt    time.Time
+	ID                uuid.UUID
+	Amount            uint64
+	FeeScheduleID     uuid.UUID
+	LogoFilename      string
+	UserID            uuid.UUID
+	Status            PledgeStatus
+	RetireRequestedAt sql.NullTime
+	RetiredAt         sql.NullTime
+	CreatedAt         time.Time
+}
+
+func (p VendorPledge) IsActive() bool {
+	return p.Status == PledgeActive
+}
+
+func (p VendorPledge) IsRetiring() bool {
+	return p.Status == PledgeRetiring
+}
+
+type PledgeForfeit struct {
+	ID          uuid.UUID
+	PledgeID    uuid.UUID
+	Amount      uint64
+	RecipientID uuid.NullUUID
+	Reason      string
+	CreatedAt   time.Time
 }
 
 type VendorPledgeModel struct{}
 
-func (m VendorPledgeModel) Create(ec db.ExecContext, amount uint64, logoFilename string, userID uuid.UUID) (*VendorPledge, error) {
-	query := "INSERT INTO vendor_pledges (amount, logo_filename, user_id) VALUES($1, $2, $3) RETURNING id, created_at"
+const pledgeColumns = "id, amount, fee_schedule_id, logo_filename, user_id, status, retire_requested_at, retired_at, created_at"
+
+func scanPledge(row interface{ Scan(...any) error }) (*VendorPledge, error) {
+	p := &VendorPledge{}
+	if err := row.Scan(&p.ID, &p.Amount, &p.FeeScheduleID, &p.LogoFilename, &p.UserID, &p.Status, &p.RetireRequestedAt, &p.RetiredAt, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (m VendorPledgeModel) Create(ec db.ExecContext, amount uint64, feeScheduleID uuid.UUID, logoFilename string, userID uuid.UUID) (*VendorPledge, error) {
+	query := "INSERT INTO vendor_pledges (amount, fee_schedule_id, logo_filename, user_id) VALUES($1, $2, $3, $4) RETURNING id, created_at"
 
 	pledge := &VendorPledge{
-		Amount:       amount,
-		LogoFilename: logoFilename,
-		UserID:       userID,
+		Amount:        amount,
+		FeeScheduleID: feeScheduleID,
+		LogoFilename:  logoFilename,
+		UserID:        userID,
+		Status:        PledgeActive,
 	}
 
-	err := ec.QueryRow(query, amount, logoFilename, userID).Scan(&pledge.ID, &pledge.CreatedAt)
+	err := ec.QueryRow(query, amount, feeScheduleID, logoFilename, userID).Scan(&pledge.ID, &pledge.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -34,17 +77,83 @@ func (m VendorPledgeModel) Create(ec db.ExecContext, amount uint64, logoFilename
 }
 
 func (m VendorPledgeModel) GetForUser(ec db.ExecContext, userID uuid.UUID) (*VendorPledge, error) {
-	query := "SELECT id, amount, logo_filename, created_at FROM vendor_pledges WHERE user_id=$1"
+	query := "SELECT " + pledgeColumns + " FROM vendor_pledges WHERE user_id=$1"
+	return scanPledge(ec.QueryRow(query, userID))
+}
 
-	pledge := &VendorPledge{
-		UserID: userID,
-	}
+// Locks the pledge until the end of the transaction
+func (m VendorPledgeModel) GetForUpdate(ec db.ExecContext, userID uuid.UUID) (*VendorPledge, error) {
+	query := "SELECT " + pledgeColumns + " FROM vendor_pledges WHERE user_id=$1 FOR UPDATE"
+	return scanPledge(ec.QueryRow(query, userID))
+}
 
-	err := ec.QueryRow(query, userID).Scan(&pledge.ID, &pledge.Amount, &pledge.LogoFilename, &pledge.CreatedAt)
+// Retiring pledges whose retirement was requested before the time
+func (m VendorPledgeModel) GetAllRetiringBefore(ec db.ExecContext, before time.Time) ([]VendorPledge, error) {
+	query := "SELECT " + pledgeColumns + " FROM vendor_pledges WHERE status = 'retiring' AND retire_requested_at < $1"
+
+	rows, err := ec.Query(query, before)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return pledge, nil
+	pledges := make([]VendorPledge, 0)
+	for rows.Next() {
+		p, err := scanPledge(rows)
+		if err != nil {
+			return nil, err
+		}
+		pledges = append(pledges, *p)
+	}
+
+	return pledges, nil
+}
+
+// Makes a retired vendor a vendor again with a new pledge
+func (m VendorPledgeModel) Reactivate(ec db.ExecContext, id uuid.UUID, amount uint64, feeScheduleID uuid.UUID, logoFilename string) error {
+	query := `
+		UPDATE vendor_pledges
+		SET status = 'active', amount = $2, fee_schedule_id = $3, logo_filename = $4, retire_requested_at = NULL, retired_at = NULL
+		WHERE id = $1
+	`
+	_, err := ec.Exec(query, id, amount, feeScheduleID, logoFilename)
+	return err
+}
+
+func (m VendorPledgeModel) AddAmount(ec db.ExecContext, id uuid.UUID, amount uint64) (*VendorPledge, error) {
+	query := "UPDATE vendor_pledges SET amount = amount + $2 WHERE id = $1 RETURNING " + pledgeColumns
+	return scanPledge(ec.QueryRow(query, id, amount))
+}
+
+// Returns sql.ErrNoRows if less than the amount is pledged
+func (m VendorPledgeModel) ReduceAmount(ec db.ExecContext, id uuid.UUID, amount uint64) (*VendorPledge, error) {
+	query := "UPDATE vendor_pledges SET amount = amount - $2 WHERE id = $1 AND amount >= $2 RETURNING " + pledgeColumns
+	return scanPledge(ec.QueryRow(query, id, amount))
+}
+
+func (m VendorPledgeModel) RequestRetirement(ec db.ExecContext, id uuid.UUID) error {
+	_, err := ec.Exec("UPDATE vendor_pledges SET status = 'retiring', retire_requested_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+func (m VendorPledgeModel) Retire(ec db.ExecContext, id uuid.UUID) error {
+	_, err := ec.Exec("UPDATE vendor_pledges SET status = 'retired', amount = 0, retired_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+func (m VendorPledgeModel) CreateForfeit(ec db.ExecContext, pledgeID uuid.UUID, amount uint64, recipientID uuid.NullUUID, reason string) (*PledgeForfeit, error) {
+	query := "INSERT INTO pledge_forfeits (pledge_id, amount, recipient_id, reason) VALUES($1, $2, $3, $4) RETURNING id, created_at"
+
+	f := &PledgeForfeit{
+		PledgeID:    pledgeID,
+		Amount:      amount,
+		RecipientID: recipientID,
+		Reason:      reason,
+	}
+
+	if err := ec.QueryRow(query, pledgeID, amount, recipientID, reason).Scan(&f.ID, &f.CreatedAt); err != nil {
+		return nil, err
+	}
 
+	return f, nil
 }
@@ -0,0 +1,102 @@
+package view
+
+import (
+	"LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"slices"
+	"sort"
+)
+
+// Items in the cart from one vendor. They are ordered together with one of the delivery methods.
+type CartGroup struct {
+	Vendor          *model.User
+	Lines           []Line
+	DeliveryMethods []model.DeliveryMethod
+}
+
+func (g CartGroup) Currency() model.Currency {
+	return linesCurrency(g.Lines)
+}
+
+func (g CartGroup) ItemTotal() int {
+	return linesTotal(g.Lines)
+}
+
+type CartView struct{}
+
+// Groups the cart by vendor. Items whose pricing no longer exists or belongs to an old version of the listing are left out.
+func (cv CartView) Get(ec db.ExecContext, items []model.CartItem) ([]CartGroup, error) {
+	groups := make([]CartGroup, 0)
+	index := make(map[uuid.UUID]int)
+
+	for _, item := range items {
+		line, err := cartLine(ec, item)
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			continue
+		}
+
+		i, ok := index[line.Product.VendorID]
+		if !ok {
+			vendor, err := model.M.User.Get(ec, line.Product.VendorID)
+			if err != nil {
+				return nil, err
+			}
+
+			i = len(groups)
+			index[vendor.ID] = i
+			groups = append(groups, CartGroup{Vendor: vendor})
+		}
+
+		group := &groups[i]
+		group.Lines = append(group.Lines, *line)
+
+		dms, err := model.M.DeliveryMethod.GetAllForProduct(ec, line.Product.ID)
+		if err != nil {
+			return nil, err
+		}
+		group.DeliveryMethods = appendDeliveryMethods(group.DeliveryMethods, dms)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Vendor.Username < groups[j].Vendor.Username
+	})
+
+	return groups, nil
+}
+
+func cartLine(ec db.ExecContext, item model.CartItem) (*Line, error) {
+	price, err := model.M.Price.GetCurrent(ec, item.PriceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	product, err := model.M.Product.Get(ec, price.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Line{
+		Product:   product,
+		Price:     price,
+		Count:     item.Count,
+		UnitPrice: price.Price,
+	}, nil
+}
+
+func appendDeliveryMethods(dms []model.DeliveryMethod, more []model.DeliveryMethod) []model.DeliveryMethod {
+	for _, dm := range more {
+		if !slices.ContainsFunc(dms, func(d model.DeliveryMethod) bool { return d.ID == dm.ID }) {
+			dms = append(dms, dm)
+		}
+	}
+	return dms
+}
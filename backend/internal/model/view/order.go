@@ -6,16 +6,44 @@ import (
 	"github.com/google/uuid"
 )
 
+// One line of an order, a quote or the cart. UnitPrice is in the currency of the product.
+// Lines of an order show the listing as it was in the version that was ordered.
+type Line struct {
+	Product   *model.Product
+	Price     *model.Price
+	Count     int
+	UnitPrice int
+	// Number of the ordered version, 0 outside orders
+	Version int
+}
+
+func (l Line) Total() int {
+	return l.Count * l.UnitPrice
+}
+
+// Grams of product on the line
+func (l Line) Quantity() int {
+	return l.Count * l.Price.Quantity
+}
+
 type Order struct {
 	Order          *model.Order
-	Product        *model.Product
-	Price          *model.Price
+	Lines          []Line
 	DeliveryMethod *model.DeliveryMethod
-	Invoice        *model.Invoice
+	Escrow         *model.Escrow
 	DeliveryInfo   *model.DeliveryInfo
 	DeclineReason  *model.DeclineReason
 }
 
+// Products of an order are from one vendor and priced in one currency
+func (o Order) Currency() model.Currency {
+	return linesCurrency(o.Lines)
+}
+
+func (o Order) ItemTotal() int {
+	return linesTotal(o.Lines)
+}
+
 type OrderView struct{}
 
 func (ov OrderView) Get(ec db.ExecContext, orderID uuid.UUID) (*Order, error) {
@@ -24,7 +52,7 @@ func (ov OrderView) Get(ec db.ExecContext, orderID uuid.UUID) (*Order, error) {
 		return nil, err
 	}
 
-	price, err := model.M.Price.Get(ec, order.PriceID)
+	lines, err := ov.lines(ec, orderID)
 	if err != nil {
 		return nil, err
 	}
@@ -34,19 +62,16 @@ func (ov OrderView) Get(ec db.ExecContext, orderID uuid.UUID) (*Order, error) {
 		return nil, err
 	}
 
-	product, err := model.M.Product.Get(ec, price.ProductID)
+	escrow, err := model.M.Escrow.GetForOrder(ec, order.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	invoice, err := model.M.Invoice.GetWithOrderID(ec, order.ID)
-
 	view := &Order{
 		Order:          order,
-		Product:        product,
-		Price:          price,
+		Lines:          lines,
 		DeliveryMethod: dm,
-		Invoice:        invoice,
+		Escrow:         escrow,
 	}
 
 	switch {
@@ -69,18 +94,14 @@ func (ov OrderView) Get(ec db.ExecContext, orderID uuid.UUID) (*Order, error) {
 
 func (ov OrderView) GetAllForCustomer(ec db.ExecContext, customerID uuid.UUID) ([]Order, error) {
 	query := `
-	SELECT orders.id, orders.status, orders.details, orders.price_id, orders.customer_id, orders.created_at,
-		products.id, products.title, products.description, products.image_filename, products.vendor_id,
-		prices.id, prices.quantity, prices.price, prices.product_id,
-		dm.id, dm.description, dm.price, dm.product_id,
-		invoices.id, invoices.address, invoices.order_id, invoices.xmr_price, invoices.created_at
-	FROM users
-	JOIN orders ON orders.customer_id = users.id
-	JOIN invoices ON invoices.order_id = orders.id
-	JOIN prices ON prices.id = orders.price_id
+	SELECT orders.id, orders.status, orders.details, orders.vendor_id, orders.customer_id, orders.created_at,
+		dm.id, dm.description, dm.price, dm.product_id, dm.version_id,
+		escrows.id, escrows.order_id, escrows.amount, escrows.fee, escrows.status, escrows.fee_schedule_id, escrows.commission_bps,
+		escrows.created_at, escrows.settled_at
+	FROM orders
+	JOIN escrows ON escrows.order_id = orders.id
 	JOIN delivery_methods AS dm ON dm.id = orders.delivery_method_id
-	JOIN products ON products.id = prices.product_id
-	WHERE users.id = $1
+	WHERE orders.customer_id = $1
 	ORDER BY orders.created_at DESC
 	`
 
@@ -93,45 +114,51 @@ func (ov OrderView) GetAllForCustomer(ec db.ExecContext, customerID uuid.UUID) (
 	orders := make([]Order, 0)
 	for rows.Next() {
 		order := &model.Order{}
-		product := &model.Product{}
-		price := &model.Price{}
 		dm := &model.DeliveryMethod{}
-		invoice := &model.Invoice{}
+		escrow := &model.Escrow{}
 
 		err = rows.Scan(
-			&order.ID, &order.Status, &order.Details, &order.PriceID, &order.CustomerID, &order.CreatedAt,
-			&product.ID, &product.Title, &product.Description, &product.ImageFilename, &product.VendorID,
-			&price.ID, &price.Quantity, &price.Price, &price.ProductID,
-			&dm.ID, &dm.Description, &dm.Price, &dm.ProductID,
-			&invoice.ID, &invoice.Address, &invoice.OrderID, &invoice.XMRPrice, &invoice.CreatedAt)
+			&order.ID, &order.Status, &order.Details, &order.VendorID, &order.CustomerID, &order.CreatedAt,
+			&dm.ID, &dm.Description, &dm.Price, &dm.ProductID, &dm.VersionID,
+			&escrow.ID, &escrow.OrderID, &escrow.Amount, &escrow.Fee, &escrow.Status, &escrow.FeeScheduleID, &escrow.CommissionBps,
+			&escrow.CreatedAt, &escrow.SettledAt)
 		if err != nil {
 			return nil, err
 		}
 
-		view := Order{
+		orders = append(orders, Order{
 			Order:          order,
-			Product:        product,
-			Price:          price,
 			DeliveryMethod: dm,
-			Invoice:        invoice,
+			Escrow:         escrow,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		view := &orders[i]
+
+		lines, err := ov.lines(ec, view.Order.ID)
+		if err != nil {
+			return nil, err
 		}
+		view.Lines = lines
 
-		switch order.Status {
+		switch view.Order.Status {
 		case model.StatusDelivered:
-			di, err := model.M.DeliveryInfo.GetForOrder(ec, order.ID)
+			di, err := model.M.DeliveryInfo.GetForOrder(ec, view.Order.ID)
 			if err != nil {
 				return nil, err
 			}
 			view.DeliveryInfo = di
 		case model.StatusDeclined:
-			dr, err := model.M.DeclineReason.GetForOrder(ec, order.ID)
+			dr, err := model.M.DeclineReason.GetForOrder(ec, view.Order.ID)
 			if err != nil {
 				return nil, err
 			}
 			view.DeclineReason = dr
 		}
-
-		orders = append(orders, view)
 	}
 
 	return orders, nil
@@ -139,15 +166,11 @@ func (ov OrderView) GetAllForCustomer(ec db.ExecContext, customerID uuid.UUID) (
 
 func (ov OrderView) GetAllForVendor(ec db.ExecContext, vendorID uuid.UUID) ([]Order, error) {
 	query := `
-	SELECT orders.id, orders.status, orders.details, orders.price_id, orders.customer_id, orders.created_at,
-		products.id, products.title, products.description, products.image_filename, products.vendor_id,
-		prices.id, prices.quantity, prices.price, prices.product_id,
-		dm.id, dm.description, dm.price, dm.product_id
-	FROM products
-	JOIN prices ON prices.product_id = products.id 
-	JOIN orders ON orders.price_id = prices.id
+	SELECT orders.id, orders.status, orders.details, orders.vendor_id, orders.customer_id, orders.created_at,
+		dm.id, dm.description, dm.price, dm.product_id, dm.version_id
+	FROM orders
 	JOIN delivery_methods AS dm ON dm.id = orders.delivery_method_id
-	WHERE products.vendor_id = $1
+	WHERE orders.vendor_id = $1
 	ORDER BY orders.created_at DESC
 	`
 
@@ -160,26 +183,92 @@ func (ov OrderView) GetAllForVendor(ec db.ExecContext, vendorID uuid.UUID) ([]Or
 	orders := make([]Order, 0)
 	for rows.Next() {
 		order := &model.Order{}
-		product := &model.Product{}
-		price := &model.Price{}
 		dm := &model.DeliveryMethod{}
 
 		err = rows.Scan(
-			&order.ID, &order.Status, &order.Details, &order.PriceID, &order.CustomerID, &order.CreatedAt,
-			&product.ID, &product.Title, &product.Description, &product.ImageFilename, &product.VendorID,
-			&price.ID, &price.Quantity, &price.Price, &price.ProductID,
-			&dm.ID, &dm.Description, &dm.Price, &dm.ProductID)
+			&order.ID, &order.Status, &order.Details, &order.VendorID, &order.CustomerID, &order.CreatedAt,
+			&dm.ID, &dm.Description, &dm.Price, &dm.ProductID, &dm.VersionID)
 		if err != nil {
 			return nil, err
 		}
 
 		orders = append(orders, Order{
 			Order:          order,
-			Product:        product,
-			Price:          price,
 			DeliveryMethod: dm,
 		})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		lines, err := ov.lines(ec, orders[i].Order.ID)
+		if err != nil {
+			return nil, err
+		}
+		orders[i].Lines = lines
+	}
 
 	return orders, nil
 }
+
+func (ov OrderView) lines(ec db.ExecContext, orderID uuid.UUID) ([]Line, error) {
+	query := `
+	SELECT order_items.count, order_items.unit_price, product_versions.version,
+		products.id, product_versions.title, product_versions.description, product_versions.image_filename,
+		products.vendor_id, products.currency, products.version_id,
+		prices.id, prices.quantity, prices.price, prices.product_id, prices.version_id
+	FROM order_items
+	JOIN prices ON prices.id = order_items.price_id
+	JOIN product_versions ON product_versions.id = prices.version_id
+	JOIN products ON products.id = prices.product_id
+	WHERE order_items.order_id = $1
+	ORDER BY order_items.position
+	`
+
+	rows, err := ec.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]Line, 0)
+	for rows.Next() {
+		line := Line{
+			Product: &model.Product{},
+			Price:   &model.Price{},
+		}
+
+		err := rows.Scan(&line.Count, &line.UnitPrice, &line.Version,
+			&line.Product.ID, &line.Product.Title, &line.Product.Description, &line.Product.ImageFilename,
+			&line.Product.VendorID, &line.Product.Currency, &line.Product.VersionID,
+			&line.Price.ID, &line.Price.Quantity, &line.Price.Price, &line.Price.ProductID, &line.Price.VersionID)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+func linesCurrency(lines []Line) model.Currency {
+	if len(lines) == 0 {
+		return model.CurrencyEUR
+	}
+	return lines[0].Product.Currency
+}
+
+func linesTotal(lines []Line) int {
+	total := 0
+	for _, line := range lines {
+		total += line.Total()
+	}
+	return total
+}
+
+// Status changes of the order, oldest first
+func (ov OrderView) Timeline(ec db.ExecContext, orderID uuid.UUID) ([]model.OrderEvent, error) {
+	return model.M.OrderEvent.GetAllForOrder(ec, orderID)
+}
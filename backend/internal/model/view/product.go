@@ -14,6 +14,23 @@ type Product struct {
 	Reviews         []Review
 	Rating          Rating
 	NumReviews      int
+	// Category of the product and its ancestors, root first
+	Breadcrumbs []model.Category
+	Tags        []string
+	// Images of the current version in display order, the first is the cover
+	Images []string
+	// Newest first, the first one is current
+	Versions []model.ProductVersion
+	// None of the pricings fit in the stock
+	SoldOut bool
+}
+
+// Number of the current version
+func (p Product) Version() int {
+	if len(p.Versions) == 0 {
+		return 0
+	}
+	return p.Versions[0].Version
 }
 
 type ProductView struct{}
@@ -44,6 +61,29 @@ func (pv ProductView) Get(ec db.ExecContext, productID uuid.UUID) (*Product, err
 		return nil, err
 	}
 
+	breadcrumbs := make([]model.Category, 0)
+	if product.CategoryID.Valid {
+		breadcrumbs, err = model.M.Category.GetPath(ec, product.CategoryID.UUID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := model.M.ProductTag.GetAllForProduct(ec, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := model.M.ProductVersion.GetAllForProduct(ec, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := model.M.ProductImage.GetAllForVersion(ec, product.VersionID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Product{
 		Product:         product,
 		Prices:          prices,
@@ -52,13 +92,19 @@ func (pv ProductView) Get(ec db.ExecContext, productID uuid.UUID) (*Product, err
 		Reviews:         reviews,
 		Rating:          calculateRating(reviews),
 		NumReviews:      len(reviews),
+		SoldOut:         soldOut(product, prices),
+		Breadcrumbs:     breadcrumbs,
+		Tags:            tags,
+		Images:          images,
+		Versions:        versions,
 	}, nil
 }
 
-func (pv ProductView) GetAll(ec db.ExecContext) ([]Product, error) {
-	products, err := model.M.Product.GetAll(ec)
+// Page of products matching the query and the number of all matches
+func (pv ProductView) Search(ec db.ExecContext, q model.ProductQuery) ([]Product, int, error) {
+	products, total, err := model.M.Product.Search(ec, q)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	res := make([]Product, 0, len(products))
@@ -66,9 +112,18 @@ func (pv ProductView) GetAll(ec db.ExecContext) ([]Product, error) {
 	for _, product := range products {
 		p, err := pv.Get(ec, product.ID)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		res = append(res, *p)
 	}
-	return res, nil
+	return res, total, nil
+}
+
+func soldOut(product *model.Product, prices []model.Price) bool {
+	for _, price := range prices {
+		if product.InStock(price.Quantity) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,53 @@
+package view
+
+import (
+	"LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"github.com/google/uuid"
+)
+
+type Quote struct {
+	Quote          *model.Quote
+	Lines          []Line
+	DeliveryMethod *model.DeliveryMethod
+}
+
+type QuoteView struct{}
+
+func (qv QuoteView) Get(ec db.ExecContext, quoteID uuid.UUID) (*Quote, error) {
+	quote, err := model.M.Quote.Get(ec, quoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]Line, 0, len(quote.Items))
+	for _, item := range quote.Items {
+		price, err := model.M.Price.Get(ec, item.PriceID)
+		if err != nil {
+			return nil, err
+		}
+
+		product, err := model.M.Product.Get(ec, price.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, Line{
+			Product:   product,
+			Price:     price,
+			Count:     item.Count,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+
+	dm, err := model.M.DeliveryMethod.Get(ec, quote.DeliveryMethodID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quote{
+		Quote:          quote,
+		Lines:          lines,
+		DeliveryMethod: dm,
+	}, nil
+}
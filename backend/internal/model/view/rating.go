@@ -15,11 +15,16 @@ func calculateRating(reviews []Review) Rating {
 		rating = rating / float64(len(reviews))
 	}
 
+	return ratingOf(rating)
+}
+
+// Rounds the grade to halves
+func ratingOf(grade float64) Rating {
 	half := false
-	whole := int(rating)
-	if rating-float64(whole) > 0.75 {
+	whole := int(grade)
+	if grade-float64(whole) > 0.75 {
 		whole += 1
-	} else if rating-float64(whole) > 0.25 {
+	} else if grade-float64(whole) > 0.25 {
 		half = true
 	}
 
@@ -9,6 +9,8 @@ import (
 type Review struct {
 	Review *model.Review
 	Author *model.User
+	// Version of the product that was ordered, 0 in reviews of a vendor
+	Version int
 }
 
 type ReviewView struct{}
@@ -16,13 +18,18 @@ type ReviewView struct{}
 func (rv ReviewView) GetAllForProduct(ec db.ExecContext, productID uuid.UUID) ([]Review, error) {
 	query := `
 		SELECT reviews.id, reviews.grade, reviews.message, reviews.order_id, 
-			authors.id, authors.username, authors.created_at
-		FROM reviews 
+			authors.id, authors.username, authors.created_at, ordered.version
+		FROM reviews
 		JOIN orders ON orders.id = reviews.order_id
 		JOIN users AS authors ON authors.id = orders.customer_id
-		JOIN prices ON prices.id = orders.price_id 
-		JOIN products ON products.id = prices.product_id
-		WHERE products.id = $1;
+		CROSS JOIN LATERAL (
+			SELECT MAX(product_versions.version) AS version FROM order_items
+			JOIN prices ON prices.id = order_items.price_id
+			JOIN product_versions ON product_versions.id = prices.version_id
+			WHERE order_items.order_id = orders.id AND prices.product_id = $1
+		) AS ordered
+		WHERE ordered.version IS NOT NULL
+		ORDER BY ordered.version DESC, reviews.created_at DESC;
 		`
 
 	rows, err := ec.Query(query, productID)
@@ -35,14 +42,16 @@ func (rv ReviewView) GetAllForProduct(ec db.ExecContext, productID uuid.UUID) ([
 	for rows.Next() {
 		r := &model.Review{}
 		a := &model.User{}
-		err = rows.Scan(&r.ID, &r.Grade, &r.Message, &r.OrderID, &a.ID, &a.Username, &a.CreatedAt)
+		var version int
+		err = rows.Scan(&r.ID, &r.Grade, &r.Message, &r.OrderID, &a.ID, &a.Username, &a.CreatedAt, &version)
 		if err != nil {
 			return nil, err
 		}
 
 		reviews = append(reviews, Review{
-			Review: r,
-			Author: a,
+			Review:  r,
+			Author:  a,
+			Version: version,
 		})
 	}
 
@@ -53,12 +62,10 @@ func (rv ReviewView) GetAllForVendor(ec db.ExecContext, vendorID uuid.UUID) ([]R
 	query := `
 		SELECT reviews.id, reviews.grade, reviews.message, reviews.order_id, 
 			authors.id, authors.username, authors.created_at
-		FROM products
-		JOIN prices ON prices.product_id = products.id
-		JOIN orders ON orders.price_id = prices.id
+		FROM orders
 		JOIN reviews ON reviews.order_id = orders.id
 		JOIN users AS authors ON authors.id = orders.customer_id
-		WHERE products.vendor_id = $1
+		WHERE orders.vendor_id = $1
 		`
 
 	rows, err := ec.Query(query, vendorID)
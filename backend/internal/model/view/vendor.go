@@ -3,6 +3,8 @@ package view
 import (
 	"LuomuTori/internal/db"
 	"LuomuTori/internal/model"
+	"database/sql"
+	"errors"
 	"github.com/google/uuid"
 )
 
@@ -12,6 +14,8 @@ type Vendor struct {
 	Rating       Rating
 	NumReviews   int
 	NumDisputes  int
+	// Nil until the reputation job has rated the vendor
+	Reputation *model.Reputation
 }
 
 type VendorView struct{}
@@ -33,23 +37,27 @@ func (pv VendorView) Get(ec db.ExecContext, vendorID uuid.UUID) (*Vendor, error)
 		return nil, err
 	}
 
-	orders, err := model.M.Order.GetAllForVendor(ec, vendorID)
+	numDisputes, err := model.M.Order.CountDisputedForVendor(ec, vendorID)
 	if err != nil {
 		return nil, err
 	}
 
-	numDisputes := 0
-	for _, order := range orders {
-		if order.Status == model.StatusDisputed || order.Status == model.StatusDisputeCountered {
-			numDisputes += 1
-		}
+	reputation, err := model.M.Reputation.Get(ec, vendorID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	rating := calculateRating(reviews)
+	if reputation != nil {
+		rating = ratingOf(reputation.WeightedGrade)
 	}
 
 	return &Vendor{
 		User:         user,
 		LogoFilename: pledge.LogoFilename,
-		Rating:       calculateRating(reviews),
+		Rating:       rating,
 		NumReviews:   len(reviews),
 		NumDisputes:  numDisputes,
+		Reputation:   reputation,
 	}, nil
 }
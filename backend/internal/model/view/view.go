@@ -3,11 +3,12 @@ package view
 type Views struct {
 	Product ProductView
 	Order   OrderView
-	Invoice InvoiceView
 	Review  ReviewView
 	Dispute DisputeView
 	Vendor  VendorView
 	Ticket  TicketView
+	Cart    CartView
+	Quote   QuoteView
 }
 
 var V Views
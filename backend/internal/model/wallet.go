@@ -5,25 +5,28 @@ import (
 	"github.com/google/uuid"
 )
 
+// InvoiceID is that of the deposit address, deposit callbacks carry it
 type Wallet struct {
-	ID      uuid.UUID
-	Address string
-	Balance uint64
-	UserID  uuid.UUID
+	ID        uuid.UUID
+	Address   string
+	InvoiceID uuid.UUID
+	Balance   uint64
+	UserID    uuid.UUID
 }
 
 type WalletModel struct{}
 
-func (m WalletModel) Create(ec db.ExecContext, userID uuid.UUID, address string) (*Wallet, error) {
-	query := "INSERT INTO wallets (address, user_id) VALUES($1, $2) RETURNING id"
+func (m WalletModel) Create(ec db.ExecContext, userID uuid.UUID, address string, invoiceID uuid.UUID) (*Wallet, error) {
+	query := "INSERT INTO wallets (address, invoice_id, user_id) VALUES($1, $2, $3) RETURNING id"
 
 	wallet := &Wallet{
-		Address: address,
-		Balance: 0,
-		UserID:  userID,
+		Address:   address,
+		InvoiceID: invoiceID,
+		Balance:   0,
+		UserID:    userID,
 	}
 
-	err := ec.QueryRow(query, address, userID).Scan(&wallet.ID)
+	err := ec.QueryRow(query, address, invoiceID, userID).Scan(&wallet.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -31,13 +34,13 @@ func (m WalletModel) Create(ec db.ExecContext, userID uuid.UUID, address string)
 }
 
 func (m WalletModel) Get(ec db.ExecContext, id uuid.UUID) (*Wallet, error) {
-	query := "SELECT address, balance, user_id FROM wallets WHERE id = $1"
+	query := "SELECT address, invoice_id, balance, user_id FROM wallets WHERE id = $1"
 
 	wallet := &Wallet{
 		ID: id,
 	}
 
-	err := ec.QueryRow(query, id).Scan(&wallet.Address, &wallet.Balance, &wallet.UserID)
+	err := ec.QueryRow(query, id).Scan(&wallet.Address, &wallet.InvoiceID, &wallet.Balance, &wallet.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +49,7 @@ func (m WalletModel) Get(ec db.ExecContext, id uuid.UUID) (*Wallet, error) {
 }
 
 func (m WalletModel) GetAll(ec db.ExecContext) ([]Wallet, error) {
-	query := "SELECT id, address, balance, user_id FROM wallets"
+	query := "SELECT id, address, invoice_id, balance, user_id FROM wallets"
 
 	rows, err := ec.Query(query)
 	if err != nil {
@@ -58,7 +61,7 @@ func (m WalletModel) GetAll(ec db.ExecContext) ([]Wallet, error) {
 
 	for rows.Next() {
 		w := Wallet{}
-		err := rows.Scan(&w.ID, &w.Address, &w.Balance, &w.UserID)
+		err := rows.Scan(&w.ID, &w.Address, &w.InvoiceID, &w.Balance, &w.UserID)
 		if err != nil {
 			return nil, err
 		}
@@ -71,7 +74,7 @@ func (m WalletModel) GetAll(ec db.ExecContext) ([]Wallet, error) {
 
 func (m WalletModel) GetForUser(ec db.ExecContext, userID uuid.UUID) (*Wallet, error) {
 	query := `
-	SELECT wallets.id, wallets.address, wallets.balance
+	SELECT wallets.id, wallets.address, wallets.invoice_id, wallets.balance
 	FROM wallets 
 	JOIN users ON wallets.user_id = users.id
 	WHERE users.id = $1
@@ -81,7 +84,7 @@ func (m WalletModel) GetForUser(ec db.ExecContext, userID uuid.UUID) (*Wallet, e
 		UserID: userID,
 	}
 
-	err := ec.QueryRow(query, userID).Scan(&wallet.ID, &wallet.Address, &wallet.Balance)
+	err := ec.QueryRow(query, userID).Scan(&wallet.ID, &wallet.Address, &wallet.InvoiceID, &wallet.Balance)
 	if err != nil {
 		return nil, err
 	}
@@ -144,19 +147,20 @@ func (m WalletModel) ReduceBalance(ec db.ExecContext, id uuid.UUID, amount uint6
 	return wallet, nil
 }
 
-func (m WalletModel) UpdateAddress(ec db.ExecContext, id uuid.UUID, address string) (*Wallet, error) {
+func (m WalletModel) UpdateAddress(ec db.ExecContext, id uuid.UUID, address string, invoiceID uuid.UUID) (*Wallet, error) {
 	query := `
 	UPDATE wallets 
-	SET address = $2 
+	SET address = $2, invoice_id = $3
 	WHERE id = $1
 	RETURNING balance, user_id
 	`
 	wallet := &Wallet{
-		ID:      id,
-		Address: address,
+		ID:        id,
+		Address:   address,
+		InvoiceID: invoiceID,
 	}
 
-	err := ec.QueryRow(query, id, address).Scan(&wallet.Balance, &wallet.UserID)
+	err := ec.QueryRow(query, id, address, invoiceID).Scan(&wallet.Balance, &wallet.UserID)
 	if err != nil {
 		return nil, err
 	}
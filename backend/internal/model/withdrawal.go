@@ -9,47 +9,71 @@ import (
 type WithdrawalStatus string
 
 const (
-	WithdrawalPending    WithdrawalStatus = "pending"
+	// Waiting for the next transfer run
+	WithdrawalPending WithdrawalStatus = "pending"
+	// Handed to the wallet backend, the transfer may or may not have been made
 	WithdrawalProcessing WithdrawalStatus = "processing"
+	// Transfer made, waiting for confirmations
+	WithdrawalSent      WithdrawalStatus = "sent"
+	WithdrawalConfirmed WithdrawalStatus = "confirmed"
+	// Nobody knows whether the transfer was made or the wallet refused it, staff resolves it so
+	// funds are never sent twice
+	WithdrawalUnknown WithdrawalStatus = "unknown"
 )
 
+// IdempotencyKey is sent with every transfer call of the withdrawal and changes only when a failed
+// transfer is retried. TxHash is empty until the transfer is made.
 type Withdrawal struct {
-	ID          uuid.UUID
-	Amount      uint64
-	DestAddress string
-	Status      WithdrawalStatus
-	CreatedAt   time.Time
+	ID             uuid.UUID
+	UserID         uuid.UUID
+	Amount         uint64
+	DestAddress    string
+	Status         WithdrawalStatus
+	IdempotencyKey uuid.UUID
+	TxHash         string
+	Confirmations  uint64
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
 
 type WithdrawalModel struct{}
 
-func (m WithdrawalModel) Create(ec db.ExecContext, destAddress string, amount uint64, status WithdrawalStatus) (*Withdrawal, error) {
-	query := "INSERT INTO withdrawals (amount, dest_address, status) VALUES($1, $2, $3) RETURNING id, created_at"
+const withdrawalColumns = "id, user_id, amount, dest_address, status, idempotency_key, COALESCE(tx_hash, ''), confirmations, created_at, updated_at"
 
-	withdrawal := &Withdrawal{
-		Amount:      0,
-		DestAddress: destAddress,
-		Status:      status,
-	}
-
-	err := ec.QueryRow(query, amount, destAddress, status).Scan(&withdrawal.ID, &withdrawal.CreatedAt)
-	if err != nil {
+func scanWithdrawal(row interface{ Scan(...any) error }) (*Withdrawal, error) {
+	w := new(Withdrawal)
+	if err := row.Scan(&w.ID, &w.UserID, &w.Amount, &w.DestAddress, &w.Status, &w.IdempotencyKey, &w.TxHash, &w.Confirmations, &w.CreatedAt, &w.UpdatedAt); err != nil {
 		return nil, err
 	}
-	return withdrawal, nil
+	return w, nil
+}
+
+func (m WithdrawalModel) Create(ec db.ExecContext, userID uuid.UUID, destAddress string, amount uint64, status WithdrawalStatus) (*Withdrawal, error) {
+	query := "INSERT INTO withdrawals (user_id, amount, dest_address, status) VALUES($1, $2, $3, $4) RETURNING " + withdrawalColumns
 
+	return scanWithdrawal(ec.QueryRow(query, userID, amount, destAddress, status))
 }
 
-func (m WithdrawalModel) Delete(ec db.ExecContext, id uuid.UUID) error {
-	query := "DELETE FROM withdrawals WHERE id = $1"
-	_, err := ec.Exec(query, id)
-	return err
+func (m WithdrawalModel) Get(ec db.ExecContext, id uuid.UUID) (*Withdrawal, error) {
+	query := "SELECT " + withdrawalColumns + " FROM withdrawals WHERE id = $1"
+
+	return scanWithdrawal(ec.QueryRow(query, id))
 }
 
+// Oldest first
 func (m WithdrawalModel) GetAllWithStatus(ec db.ExecContext, status WithdrawalStatus) ([]Withdrawal, error) {
-	query := "SELECT * FROM withdrawals WHERE status = $1"
+	query := "SELECT " + withdrawalColumns + " FROM withdrawals WHERE status = $1 ORDER BY created_at"
+	return m.getAll(ec, query, status)
+}
 
-	rows, err := ec.Query(query, status)
+// Newest first
+func (m WithdrawalModel) GetAllForUser(ec db.ExecContext, userID uuid.UUID) ([]Withdrawal, error) {
+	query := "SELECT " + withdrawalColumns + " FROM withdrawals WHERE user_id = $1 ORDER BY created_at DESC"
+	return m.getAll(ec, query, userID)
+}
+
+func (m WithdrawalModel) getAll(ec db.ExecContext, query string, args ...any) ([]Withdrawal, error) {
+	rows, err := ec.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -58,28 +82,54 @@ func (m WithdrawalModel) GetAllWithStatus(ec db.ExecContext, status WithdrawalSt
 	ws := []Withdrawal{}
 
 	for rows.Next() {
-		w := Withdrawal{}
-		if err := rows.Scan(&w.ID, &w.Amount, &w.DestAddress, &w.Status, &w.CreatedAt); err != nil {
+		w, err := scanWithdrawal(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		ws = append(ws, w)
+		ws = append(ws, *w)
 	}
 
 	return ws, nil
 }
 
-func (m WithdrawalModel) UpdateStatus(ec db.ExecContext, id uuid.UUID, status WithdrawalStatus) (*Withdrawal, error) {
-	query := "UPDATE withdrawals SET status = $2 WHERE id = $1 RETURNING amount, dest_address, created_at"
+// Moves the withdrawal from one status to another and reports whether it was in the from status.
+// Concurrent runs can't both move the same withdrawal.
+func (m WithdrawalModel) UpdateStatus(ec db.ExecContext, id uuid.UUID, from, to WithdrawalStatus) (bool, error) {
+	query := "UPDATE withdrawals SET status = $3, updated_at = NOW() WHERE id = $1 AND status = $2"
 
-	w := &Withdrawal{
-		ID:     id,
-		Status: status,
+	res, err := ec.Exec(query, id, from, to)
+	if err != nil {
+		return false, err
 	}
 
-	if err := ec.QueryRow(query, id, status).Scan(&w.Amount, &w.DestAddress, &w.CreatedAt); err != nil {
-		return nil, err
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
 	}
 
-	return w, nil
+	return n == 1, nil
+}
+
+func (m WithdrawalModel) SetSent(ec db.ExecContext, id uuid.UUID, txHash string) error {
+	query := "UPDATE withdrawals SET status = $2, tx_hash = $3, confirmations = 0, updated_at = NOW() WHERE id = $1"
+	_, err := ec.Exec(query, id, WithdrawalSent, txHash)
+	return err
+}
+
+func (m WithdrawalModel) SetConfirmations(ec db.ExecContext, id uuid.UUID, status WithdrawalStatus, confirmations uint64) error {
+	query := "UPDATE withdrawals SET status = $2, confirmations = $3, updated_at = NOW() WHERE id = $1"
+	_, err := ec.Exec(query, id, status, confirmations)
+	return err
+}
+
+// Queues the withdrawal to be transferred again under a new idempotency key
+func (m WithdrawalModel) Requeue(ec db.ExecContext, id uuid.UUID) error {
+	query := `
+		UPDATE withdrawals
+		SET status = $2, idempotency_key = gen_random_uuid(), tx_hash = NULL, confirmations = 0, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := ec.Exec(query, id, WithdrawalPending)
+	return err
 }
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoReason = errors.New("Reason is required")
+)
+
+// What a staff member did. Before and After are encoded as JSON, nil is stored as null.
+type Entry struct {
+	StaffID uuid.UUID
+	Action  model.AuditAction
+	Target  string
+	Before  any
+	After   any
+	Reason  string
+}
+
+// Appends the entry to the end of the chain.
+// Call this inside the database transaction of the mutation, so the mutation and its record are committed together.
+func Record(ec db.ExecContext, entry Entry) (*model.AuditEvent, error) {
+	if strings.TrimSpace(entry.Reason) == "" {
+		return nil, ErrNoReason
+	}
+
+	before, err := json.Marshal(entry.Before)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := json.Marshal(entry.After)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.M.Audit.Lock(ec); err != nil {
+		return nil, err
+	}
+
+	prevHash := []byte{}
+	last, err := model.M.Audit.GetLast(ec)
+	if err == nil {
+		prevHash = last.Hash
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	e := model.AuditEvent{
+		StaffID: entry.StaffID,
+		Action:  entry.Action,
+		Target:  entry.Target,
+		Before:  string(before),
+		After:   string(after),
+		Reason:  entry.Reason,
+		// Postgres stores microseconds, the hash must match what is read back
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		PrevHash:  prevHash,
+	}
+	e.Hash = Hash(e)
+
+	return model.M.Audit.Create(ec, e)
+}
+
+// SHA-256 of the previous hash and the fields of the event, each prefixed with its length
+func Hash(e model.AuditEvent) []byte {
+	h := sha256.New()
+
+	write := func(b []byte) {
+		binary.Write(h, binary.BigEndian, uint64(len(b)))
+		h.Write(b)
+	}
+
+	write(e.PrevHash)
+	write(e.StaffID[:])
+	write([]byte(e.Action))
+	write([]byte(e.Target))
+	write([]byte(e.Before))
+	write([]byte(e.After))
+	write([]byte(e.Reason))
+	binary.Write(h, binary.BigEndian, e.CreatedAt.UnixMicro())
+
+	return h.Sum(nil)
+}
+
+type Problem struct {
+	EventID int64
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("event %d: %s", p.EventID, p.Message)
+}
+
+// Checks the chain of events, which must be ordered oldest first.
+// An edited event doesn't match its hash and a removed event breaks the link of the event after it.
+// Removing events from the end of the log can only be detected by comparing to a hash seen earlier, see Contains.
+func Verify(events []model.AuditEvent) []Problem {
+	problems := make([]Problem, 0)
+
+	prevHash := []byte{}
+	for _, e := range events {
+		if !bytes.Equal(e.PrevHash, prevHash) {
+			problems = append(problems, Problem{EventID: e.ID, Message: "previous hash doesn't match, events before this have been removed or edited"})
+		}
+
+		if !bytes.Equal(Hash(e), e.Hash) {
+			problems = append(problems, Problem{EventID: e.ID, Message: "contents don't match the hash, the event has been edited"})
+		}
+
+		prevHash = e.Hash
+	}
+
+	return problems
+}
+
+// Whether an event with the hash is still in the log
+func Contains(events []model.AuditEvent, hash []byte) bool {
+	for _, e := range events {
+		if bytes.Equal(e.Hash, hash) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"LuomuTori/internal/model"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func chain(n int) []model.AuditEvent {
+	events := make([]model.AuditEvent, 0, n)
+	prevHash := []byte{}
+	for i := 0; i < n; i++ {
+		e := model.AuditEvent{
+			ID:        int64(i + 1),
+			StaffID:   uuid.New(),
+			Action:    model.AuditBanUser,
+			Target:    uuid.NewString(),
+			Before:    "null",
+			After:     `{"ID": 1}`,
+			Reason:    "spam",
+			CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+			PrevHash:  prevHash,
+		}
+		e.Hash = Hash(e)
+		prevHash = e.Hash
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestVerify(t *testing.T) {
+	if problems := Verify(chain(5)); len(problems) != 0 {
+		t.Fatalf("Intact chain should verify, got %v\n", problems)
+	}
+
+	edited := chain(5)
+	edited[2].Reason = "no reason"
+	if problems := Verify(edited); len(problems) != 1 || problems[0].EventID != 3 {
+		t.Fatalf("Edited event should be detected, got %v\n", problems)
+	}
+
+	// Rehashing the edited event breaks the link of the next one
+	edited[2].Hash = Hash(edited[2])
+	if problems := Verify(edited); len(problems) != 1 || problems[0].EventID != 4 {
+		t.Fatalf("Rehashed event should break the chain, got %v\n", problems)
+	}
+
+	events := chain(5)
+	removed := append(events[:1:1], events[2:]...)
+	if problems := Verify(removed); len(problems) != 1 || problems[0].EventID != 3 {
+		t.Fatalf("Removed event should be detected, got %v\n", problems)
+	}
+
+	if problems := Verify(events[1:]); len(problems) != 1 || problems[0].EventID != 2 {
+		t.Fatalf("Removed first event should be detected, got %v\n", problems)
+	}
+
+	if !Contains(events, events[4].Hash) || Contains(events[:4], events[4].Hash) {
+		t.Fatalf("Removed last event should be detected with its hash\n")
+	}
+}
@@ -23,7 +23,7 @@ var (
 	ErrAccountIsBanned           = errors.New("Account is banned")
 )
 
-func Register(db *sql.DB, username, password string, pgpKey string) (*model.User, error) {
+func Register(db *sql.DB, wb payment.WalletBackend, username, password string, pgpKey string) (*model.User, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
@@ -49,12 +49,13 @@ func Register(db *sql.DB, username, password string, pgpKey string) (*model.User
 		return nil, err
 	}
 
-	invoice, err := payment.CreateInvoiceForDeposits(u.ID)
+	invoiceID := uuid.New()
+	address, err := wb.NewDepositAddress(u.ID, invoiceID)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = model.M.Wallet.Create(tx, u.ID, invoice.Address)
+	_, err = model.M.Wallet.Create(tx, u.ID, address, invoiceID)
 	if err != nil {
 		return nil, err
 	}
@@ -74,8 +75,19 @@ func Authenticate(db *sql.DB, username, password string) (*model.User, error) {
 		return nil, err
 	}
 
-	if ban, _ := model.M.Ban.GetForUser(db, user.ID); ban != nil {
-		return nil, ErrAccountIsBanned
+	// Banned users may still login to withdraw their balance, unless it's frozen
+	banned, err := model.M.Ban.IsBanned(db, user.ID, model.BanLogin)
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		frozen, err := model.M.Ban.FundsFrozen(db, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if frozen {
+			return nil, ErrAccountIsBanned
+		}
 	}
 
 	hash, err := model.M.User.GetHashedPassword(db, user.ID)
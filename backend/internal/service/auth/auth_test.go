@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"LuomuTori/internal/log"
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/payment"
+	"database/sql"
+	"errors"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"os"
+	"testing"
+)
+
+// Migrated database of the tests, emptied of users. Set TEST_DSN to run them. Packages share
+// the database, so run them with -p 1.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DSN not set")
+	}
+	log.Init()
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("TRUNCATE users CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRegister(t *testing.T) {
+	db := testDB(t)
+	fake := payment.NewFakeWallet()
+
+	u, err := Register(db, fake, "alice", "alice123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := model.M.Wallet.GetForUser(db, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.Received(wallet.Address); err != nil {
+		t.Fatalf("Wallet should get a deposit address of the backend, got %v\n", err)
+	}
+
+	if _, err := Register(db, fake, "alice", "other123", ""); !errors.Is(err, ErrUsernameAlreadyRegistered) {
+		t.Fatalf("Expected ErrUsernameAlreadyRegistered, got %v\n", err)
+	}
+
+	// Without a deposit address nobody could pay in, so the user isn't created either
+	fake.Unreachable = true
+	if _, err := Register(db, fake, "bob", "bob123", ""); !errors.Is(err, payment.ErrFakeUnreachable) {
+		t.Fatalf("Expected ErrFakeUnreachable, got %v\n", err)
+	}
+	if _, err := model.M.User.GetWithName(db, "bob"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("User should not be created without a wallet, got %v\n", err)
+	}
+}
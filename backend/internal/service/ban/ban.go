@@ -0,0 +1,76 @@
+package ban
+
+import (
+	mydb "LuomuTori/internal/db"
+	"LuomuTori/internal/log"
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/order"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrInvalidScope  = errors.New("Invalid ban scope")
+	ErrInvalidExpiry = errors.New("Ban must expire in the future")
+)
+
+const declineReason = "The vendor has been banned"
+
+// Bans the user and revokes all of their sessions.
+// Call this inside a database transaction and DeclineOpenOrders after it's committed.
+func Create(tx mydb.ExecContext, userID uuid.UUID, scope model.BanScope, reason string, expiresAt sql.NullTime, freezeFunds bool) (*model.Ban, error) {
+	if !model.ValidBanScope(scope) {
+		return nil, ErrInvalidScope
+	}
+
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	if _, err := model.M.User.Get(tx, userID); err != nil {
+		return nil, err
+	}
+
+	ban, err := model.M.Ban.Create(tx, userID, scope, reason, expiresAt, freezeFunds)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := model.M.UserSession.RevokeAllForUser(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	log.Info.Printf("Banned user %s from %s, revoked %d sessions\n", userID, scope, revoked)
+
+	return ban, nil
+}
+
+// Declines the paid orders of a vendor banned from selling, which refunds the customers.
+// Each order is declined in its own transaction, so a failure leaves the rest declined.
+func DeclineOpenOrders(db *sql.DB, vendorID uuid.UUID) (int, error) {
+	banned, err := model.M.Ban.IsBanned(db, vendorID, model.BanSelling)
+	if err != nil || !banned {
+		return 0, err
+	}
+
+	orders, err := model.M.Order.GetAllForVendor(db, vendorID)
+	if err != nil {
+		return 0, err
+	}
+
+	declined := 0
+	for _, o := range orders {
+		if o.Status != model.StatusPaid {
+			continue
+		}
+
+		if err := order.Decline(db, o.ID, declineReason, model.AdminActor); err != nil {
+			return declined, err
+		}
+		declined++
+	}
+
+	return declined, nil
+}
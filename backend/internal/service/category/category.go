@@ -0,0 +1,216 @@
+package category
+
+import (
+	mydb "LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidName      = errors.New("Name must be 1-64 characters")
+	ErrDuplicateName    = errors.New("Category with the name already exists")
+	ErrNoSuchCategory   = errors.New("No such category")
+	ErrCycle            = errors.New("Category can't be moved under itself")
+	ErrHasSubcategories = errors.New("Category has subcategories")
+)
+
+const maxNameLength = 64
+
+// Category with its depth in the tree, roots are at depth 0
+type Node struct {
+	model.Category
+	Depth int
+}
+
+// Categories in depth-first order, children sorted like the input
+func Tree(categories []model.Category) []Node {
+	children := make(map[uuid.NullUUID][]model.Category)
+	for _, c := range categories {
+		children[c.ParentID] = append(children[c.ParentID], c)
+	}
+
+	nodes := make([]Node, 0, len(categories))
+	var walk func(parentID uuid.NullUUID, depth int)
+	walk = func(parentID uuid.NullUUID, depth int) {
+		for _, c := range children[parentID] {
+			nodes = append(nodes, Node{Category: c, Depth: depth})
+			walk(uuid.NullUUID{UUID: c.ID, Valid: true}, depth+1)
+		}
+	}
+	walk(uuid.NullUUID{}, 0)
+
+	return nodes
+}
+
+// Direct subcategories of the parent, roots if the parent is not valid
+func Children(categories []model.Category, parentID uuid.NullUUID) []model.Category {
+	children := make([]model.Category, 0)
+	for _, c := range categories {
+		if c.ParentID == parentID {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+func normalizeName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+func checkParent(ec mydb.ExecContext, parentID uuid.NullUUID) error {
+	if !parentID.Valid {
+		return nil
+	}
+	if _, err := model.M.Category.Get(ec, parentID.UUID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoSuchCategory
+		}
+		return err
+	}
+	return nil
+}
+
+func checkUnique(ec mydb.ExecContext, name string, parentID uuid.NullUUID, except uuid.UUID) error {
+	categories, err := model.M.Category.GetAll(ec)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range Children(categories, parentID) {
+		if c.ID != except && strings.EqualFold(c.Name, name) {
+			return ErrDuplicateName
+		}
+	}
+	return nil
+}
+
+func Create(ec mydb.ExecContext, name string, parentID uuid.NullUUID) (*model.Category, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkParent(ec, parentID); err != nil {
+		return nil, err
+	}
+
+	if err := checkUnique(ec, name, parentID, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	return model.M.Category.Create(ec, name, parentID)
+}
+
+func Rename(ec mydb.ExecContext, id uuid.UUID, name string) (*model.Category, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := get(ec, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkUnique(ec, name, c.ParentID, c.ID); err != nil {
+		return nil, err
+	}
+
+	if err := model.M.Category.Rename(ec, id, name); err != nil {
+		return nil, err
+	}
+
+	c.Name = name
+	return c, nil
+}
+
+// Moves the category and its subtree under another parent, or to the roots if parentID is not valid.
+// Call this inside a database transaction.
+func Move(tx mydb.ExecContext, id uuid.UUID, parentID uuid.NullUUID) (*model.Category, error) {
+	c, err := get(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkParent(tx, parentID); err != nil {
+		return nil, err
+	}
+
+	if parentID.Valid {
+		path, err := model.M.Category.GetPath(tx, parentID.UUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, ancestor := range path {
+			if ancestor.ID == id {
+				return nil, ErrCycle
+			}
+		}
+	}
+
+	if err := checkUnique(tx, c.Name, parentID, c.ID); err != nil {
+		return nil, err
+	}
+
+	if err := model.M.Category.SetParent(tx, id, parentID); err != nil {
+		return nil, err
+	}
+
+	c.ParentID = parentID
+	return c, nil
+}
+
+// Deletes a category without subcategories, its listings move to the parent.
+// Call this inside a database transaction.
+func Delete(tx mydb.ExecContext, id uuid.UUID) (*model.Category, error) {
+	c, err := get(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := model.M.Category.CountChildren(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if children > 0 {
+		return nil, ErrHasSubcategories
+	}
+
+	if err := model.M.Category.MoveProducts(tx, id, c.ParentID); err != nil {
+		return nil, err
+	}
+
+	if err := model.M.Category.Delete(tx, id); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Moves a listing to a category, or out of every category if categoryID is not valid
+func MoveListing(ec mydb.ExecContext, productID uuid.UUID, categoryID uuid.NullUUID) error {
+	if err := checkParent(ec, categoryID); err != nil {
+		return err
+	}
+
+	return model.M.Product.SetCategory(ec, productID, categoryID)
+}
+
+func get(ec mydb.ExecContext, id uuid.UUID) (*model.Category, error) {
+	c, err := model.M.Category.Get(ec, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoSuchCategory
+		}
+		return nil, err
+	}
+	return c, nil
+}
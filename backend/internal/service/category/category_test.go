@@ -0,0 +1,59 @@
+package category
+
+import (
+	"LuomuTori/internal/model"
+	"github.com/google/uuid"
+	"testing"
+)
+
+func child(name string, parent model.Category) model.Category {
+	return model.Category{ID: uuid.New(), Name: name, ParentID: uuid.NullUUID{UUID: parent.ID, Valid: true}}
+}
+
+func TestTree(t *testing.T) {
+	flowers := model.Category{ID: uuid.New(), Name: "Flowers"}
+	herbs := model.Category{ID: uuid.New(), Name: "Herbs"}
+	roses := child("Roses", flowers)
+	tulips := child("Tulips", flowers)
+	red := child("Red", roses)
+
+	nodes := Tree([]model.Category{flowers, herbs, red, roses, tulips})
+
+	want := []struct {
+		name  string
+		depth int
+	}{{"Flowers", 0}, {"Roses", 1}, {"Red", 2}, {"Tulips", 1}, {"Herbs", 0}}
+	if len(nodes) != len(want) {
+		t.Fatalf("Expected %d nodes, got %d\n", len(want), len(nodes))
+	}
+	for i, w := range want {
+		if nodes[i].Name != w.name || nodes[i].Depth != w.depth {
+			t.Fatalf("Node %d should be %s at depth %d, got %s at depth %d\n", i, w.name, w.depth, nodes[i].Name, nodes[i].Depth)
+		}
+	}
+}
+
+func TestTreeSkipsOrphans(t *testing.T) {
+	missing := model.Category{ID: uuid.New(), Name: "Missing"}
+	orphan := child("Orphan", missing)
+
+	if nodes := Tree([]model.Category{orphan}); len(nodes) != 0 {
+		t.Fatalf("Category without a listed parent should be left out, got %d nodes\n", len(nodes))
+	}
+}
+
+func TestChildren(t *testing.T) {
+	flowers := model.Category{ID: uuid.New(), Name: "Flowers"}
+	roses := child("Roses", flowers)
+	categories := []model.Category{flowers, roses}
+
+	roots := Children(categories, uuid.NullUUID{})
+	if len(roots) != 1 || roots[0].ID != flowers.ID {
+		t.Fatalf("Expected Flowers as the only root, got %v\n", roots)
+	}
+
+	children := Children(categories, uuid.NullUUID{UUID: flowers.ID, Valid: true})
+	if len(children) != 1 || children[0].ID != roses.ID {
+		t.Fatalf("Expected Roses as the only child of Flowers, got %v\n", children)
+	}
+}
@@ -1,12 +1,14 @@
 package dispute
 
 import (
+	mydb "LuomuTori/internal/db"
 	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/escrow"
 	"database/sql"
 	"github.com/google/uuid"
 )
 
-func CreateDispute(db *sql.DB, orderID uuid.UUID, claim string) (*model.Dispute, error) {
+func CreateDispute(db *sql.DB, orderID uuid.UUID, claim string, actor model.Actor) (*model.Dispute, error) {
 	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
@@ -17,6 +19,10 @@ func CreateDispute(db *sql.DB, orderID uuid.UUID, claim string) (*model.Dispute,
 		return nil, err
 	}
 
+	if _, err := model.M.OrderEvent.Create(tx, orderID, model.StatusDisputed, actor); err != nil {
+		return nil, err
+	}
+
 	dispute, err := model.M.Dispute.Create(tx, claim, orderID)
 	if err != nil {
 		return nil, err
@@ -29,7 +35,7 @@ func CreateDispute(db *sql.DB, orderID uuid.UUID, claim string) (*model.Dispute,
 	return dispute, nil
 }
 
-func CreateCounterDispute(db *sql.DB, orderID uuid.UUID, claim string) (*model.CounterDispute, error) {
+func CreateCounterDispute(db *sql.DB, orderID uuid.UUID, claim string, actor model.Actor) (*model.CounterDispute, error) {
 	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
@@ -45,6 +51,10 @@ func CreateCounterDispute(db *sql.DB, orderID uuid.UUID, claim string) (*model.C
 		return nil, err
 	}
 
+	if _, err := model.M.OrderEvent.Create(tx, orderID, model.StatusDisputeCountered, actor); err != nil {
+		return nil, err
+	}
+
 	counterDispute, err := model.M.CounterDispute.Create(tx, claim, dispute.ID)
 	if err != nil {
 		return nil, err
@@ -57,13 +67,9 @@ func CreateCounterDispute(db *sql.DB, orderID uuid.UUID, claim string) (*model.C
 	return counterDispute, err
 }
 
-func CreateDisputeDecision(db *sql.DB, disputeID uuid.UUID, outcome model.DisputeOutcome, reason string) (*model.DisputeDecision, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
-
+// Settles the dispute and moves the escrow to the winner.
+// Call this inside a database transaction, the admin console records the decision in the same transaction.
+func CreateDisputeDecision(tx mydb.ExecContext, disputeID uuid.UUID, outcome model.DisputeOutcome, reason string, actor model.Actor) (*model.DisputeDecision, error) {
 	dispute, err := model.M.Dispute.Get(tx, disputeID)
 	if err != nil {
 		return nil, err
@@ -79,8 +85,7 @@ func CreateDisputeDecision(db *sql.DB, disputeID uuid.UUID, outcome model.Disput
 		return nil, err
 	}
 
-	invoice, err := model.M.Invoice.GetForOrder(tx, order.ID)
-	if err != nil {
+	if _, err := model.M.OrderEvent.Create(tx, order.ID, order.Status, actor); err != nil {
 		return nil, err
 	}
 
@@ -89,38 +94,17 @@ func CreateDisputeDecision(db *sql.DB, disputeID uuid.UUID, outcome model.Disput
 		return nil, err
 	}
 
-	vendorWallet, err := model.M.Wallet.GetForUser(tx, vendor.ID)
-	if err != nil {
-		return nil, err
-	}
-
-	customerWallet, err := model.M.Wallet.GetForUser(tx, order.CustomerID)
-	if err != nil {
-		return nil, err
-	}
-
 	switch outcome {
 	case model.OutcomeVendorWon:
-		if _, err := model.M.Wallet.AddBalance(tx, vendorWallet.ID, invoice.XMRPrice); err != nil {
-			return nil, err
-		}
+		_, err = escrow.Release(tx, order.ID, vendor.ID)
 	case model.OutcomeDraw:
-		split := invoice.XMRPrice / 2
-		if _, err := model.M.Wallet.AddBalance(tx, vendorWallet.ID, split); err != nil {
-			return nil, err
-		}
-		if _, err := model.M.Wallet.AddBalance(tx, customerWallet.ID, split); err != nil {
-			return nil, err
-		}
+		_, err = escrow.Split(tx, order.ID, vendor.ID, order.CustomerID)
 	case model.OutcomeCustomerWon:
-		if _, err := model.M.Wallet.AddBalance(tx, customerWallet.ID, invoice.XMRPrice); err != nil {
-			return nil, err
-		}
+		_, err = escrow.Refund(tx, order.ID, order.CustomerID)
 	}
-
-	if err := tx.Commit(); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
-	return decision, err
+	return decision, nil
 }
@@ -0,0 +1,88 @@
+package escrow
+
+import (
+	"LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/ledger"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAlreadySettled = errors.New("Escrow has already been settled")
+)
+
+// Moves amount+fee from the customers wallet. Amount is held in escrow until the order is settled
+// and fee goes to the market. The fee schedule and commission are recorded with the escrow.
+func Hold(ec db.ExecContext, orderID, customerID uuid.UUID, amount, fee uint64, feeScheduleID uuid.UUID, commissionBps uint) (*model.Escrow, error) {
+	err := ledger.Transfer(ec, model.LedgerOrder, orderID, ledger.User(customerID),
+		ledger.To(ledger.Escrow(orderID), amount),
+		ledger.To(ledger.Fees, fee))
+	if err != nil {
+		return nil, err
+	}
+
+	return model.M.Escrow.Create(ec, orderID, amount, fee, feeScheduleID, commissionBps)
+}
+
+// Pays the escrow of the order to the vendor
+func Release(ec db.ExecContext, orderID, vendorID uuid.UUID) (*model.Escrow, error) {
+	escrow, err := settle(ec, orderID, model.EscrowReleased)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ledger.Transfer(ec, model.LedgerRelease, orderID, ledger.Escrow(orderID), ledger.To(ledger.User(vendorID), escrow.Amount))
+	if err != nil {
+		return nil, err
+	}
+
+	return escrow, nil
+}
+
+// Returns the escrow of the order to the customer
+func Refund(ec db.ExecContext, orderID, customerID uuid.UUID) (*model.Escrow, error) {
+	escrow, err := settle(ec, orderID, model.EscrowRefunded)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ledger.Transfer(ec, model.LedgerRefund, orderID, ledger.Escrow(orderID), ledger.To(ledger.User(customerID), escrow.Amount))
+	if err != nil {
+		return nil, err
+	}
+
+	return escrow, nil
+}
+
+// Splits the escrow of the order in half between the vendor and the customer.
+// Customer gets the odd piconero.
+func Split(ec db.ExecContext, orderID, vendorID, customerID uuid.UUID) (*model.Escrow, error) {
+	escrow, err := settle(ec, orderID, model.EscrowSplit)
+	if err != nil {
+		return nil, err
+	}
+
+	half := escrow.Amount / 2
+	err = ledger.Transfer(ec, model.LedgerSplit, orderID, ledger.Escrow(orderID),
+		ledger.To(ledger.User(vendorID), half),
+		ledger.To(ledger.User(customerID), escrow.Amount-half))
+	if err != nil {
+		return nil, err
+	}
+
+	return escrow, nil
+}
+
+// Settling is a conditional update on held escrows, so of two concurrent payouts only one can succeed
+func settle(ec db.ExecContext, orderID uuid.UUID, status model.EscrowStatus) (*model.Escrow, error) {
+	escrow, err := model.M.Escrow.Settle(ec, orderID, status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAlreadySettled
+		}
+		return nil, err
+	}
+	return escrow, nil
+}
@@ -0,0 +1,131 @@
+package fee
+
+import (
+	"LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"sort"
+)
+
+var (
+	ErrInvalidCommission = errors.New("Commission must be between 0 and 10000 basis points")
+	ErrInvalidWithdrawal = errors.New("Withdrawal minimum must be larger than the withdrawal fee")
+	ErrDuplicateTier     = errors.New("Fee tiers must have distinct sales thresholds")
+	ErrInvalidPledge     = errors.New("Pledge amount must be larger than zero")
+)
+
+const maxBps = 10000
+
+// Schedule is a fee schedule version together with its tiers
+type Schedule struct {
+	model.FeeSchedule
+	Tiers []model.FeeTier
+}
+
+type Tier struct {
+	MinSales      int
+	CommissionBps uint
+}
+
+func Current(ec db.ExecContext) (*Schedule, error) {
+	s, err := model.M.FeeSchedule.GetCurrent(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	tiers, err := model.M.FeeTier.GetAllForSchedule(ec, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schedule{FeeSchedule: *s, Tiers: tiers}, nil
+}
+
+// Publishes a new version of the fee schedule. Orders made before keep their old fees.
+// Call this inside a database transaction so the tiers are published together with the schedule.
+func Publish(tx db.ExecContext, commissionBps uint, withdrawalFee, withdrawalMin int, pledgeAmount uint64, tiers []Tier) (*Schedule, error) {
+	if commissionBps > maxBps {
+		return nil, ErrInvalidCommission
+	}
+
+	if withdrawalFee < 0 || withdrawalMin <= withdrawalFee {
+		return nil, ErrInvalidWithdrawal
+	}
+
+	// A free pledge would let anyone sell
+	if pledgeAmount == 0 {
+		return nil, ErrInvalidPledge
+	}
+
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinSales < tiers[j].MinSales })
+
+	seen := make(map[int]bool)
+	for _, t := range tiers {
+		if t.CommissionBps > maxBps {
+			return nil, ErrInvalidCommission
+		}
+		if seen[t.MinSales] {
+			return nil, ErrDuplicateTier
+		}
+		seen[t.MinSales] = true
+	}
+
+	s, err := model.M.FeeSchedule.Create(tx, commissionBps, withdrawalFee, withdrawalMin, pledgeAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &Schedule{FeeSchedule: *s, Tiers: make([]model.FeeTier, 0, len(tiers))}
+	for _, t := range tiers {
+		tier, err := model.M.FeeTier.Create(tx, s.ID, t.MinSales, t.CommissionBps)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Tiers = append(schedule.Tiers, *tier)
+	}
+
+	return schedule, nil
+}
+
+// Commission the vendor pays under the schedule.
+// A vendor specific override wins, then the highest tier the vendor has reached and finally the base commission.
+func (s Schedule) Commission(ec db.ExecContext, vendorID uuid.UUID) (uint, error) {
+	override, err := model.M.VendorCommission.Get(ec, vendorID)
+	if err == nil {
+		return override.CommissionBps, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	if len(s.Tiers) == 0 {
+		return s.CommissionBps, nil
+	}
+
+	sales, err := model.M.Order.CountCompletedForVendor(ec, vendorID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Tiers are ordered by MinSales
+	commission := s.CommissionBps
+	for _, t := range s.Tiers {
+		if sales >= t.MinSales {
+			commission = t.CommissionBps
+		}
+	}
+
+	return commission, nil
+}
+
+func SetVendorCommission(ec db.ExecContext, vendorID uuid.UUID, commissionBps uint) error {
+	if commissionBps > maxBps {
+		return ErrInvalidCommission
+	}
+	return model.M.VendorCommission.Set(ec, vendorID, commissionBps)
+}
+
+func RemoveVendorCommission(ec db.ExecContext, vendorID uuid.UUID) error {
+	return model.M.VendorCommission.Delete(ec, vendorID)
+}
@@ -0,0 +1,138 @@
+package ledger
+
+import (
+	"LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotEnoughBalance = errors.New("Not enough balance")
+)
+
+// Account is one side of a ledger entry.
+// System accounts (fees, deposits, withdrawals) have a nil ID.
+type Account struct {
+	Kind model.LedgerAccount
+	ID   uuid.UUID
+}
+
+var (
+	Fees        = Account{Kind: model.AccountFees}
+	Deposits    = Account{Kind: model.AccountDeposits}
+	Withdrawals = Account{Kind: model.AccountWithdrawals}
+)
+
+func User(userID uuid.UUID) Account {
+	return Account{Kind: model.AccountUser, ID: userID}
+}
+
+func Escrow(orderID uuid.UUID) Account {
+	return Account{Kind: model.AccountEscrow, ID: orderID}
+}
+
+func Pledge(userID uuid.UUID) Account {
+	return Account{Kind: model.AccountPledge, ID: userID}
+}
+
+type Leg struct {
+	To     Account
+	Amount uint64
+}
+
+func To(account Account, amount uint64) Leg {
+	return Leg{To: account, Amount: amount}
+}
+
+// Moves funds from one account to the accounts of legs as a single balanced ledger transaction.
+// Wallet balances of user accounts are changed with the same ExecContext,
+// so call this inside a database transaction to keep the wallets and the ledger in sync.
+func Transfer(ec db.ExecContext, kind model.LedgerKind, referenceID uuid.UUID, from Account, legs ...Leg) error {
+	var total uint64 = 0
+	entries := make([]model.LedgerEntry, 0, len(legs)+1)
+	for _, leg := range legs {
+		if leg.Amount == 0 {
+			continue
+		}
+		total += leg.Amount
+		entries = append(entries, model.LedgerEntry{
+			Account:   leg.To.Kind,
+			AccountID: leg.To.ID,
+			Amount:    int64(leg.Amount),
+		})
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	entries = append(entries, model.LedgerEntry{
+		Account:   from.Kind,
+		AccountID: from.ID,
+		Amount:    -int64(total),
+	})
+
+	if from.Kind == model.AccountUser {
+		if err := reduceWallet(ec, from.ID, total); err != nil {
+			return err
+		}
+	}
+
+	for _, leg := range legs {
+		if leg.To.Kind == model.AccountUser && leg.Amount > 0 {
+			if err := addWallet(ec, leg.To.ID, leg.Amount); err != nil {
+				return err
+			}
+		}
+	}
+
+	t, err := model.M.Ledger.CreateTransaction(ec, kind, referenceID)
+	if err != nil {
+		return err
+	}
+
+	return model.M.Ledger.CreateEntries(ec, t.ID, entries)
+}
+
+func reduceWallet(ec db.ExecContext, userID uuid.UUID, amount uint64) error {
+	wallet, err := model.M.Wallet.GetForUser(ec, userID)
+	if err != nil {
+		return err
+	}
+
+	// Fails because of the balance >= $2 constraint
+	if _, err := model.M.Wallet.ReduceBalance(ec, wallet.ID, amount); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotEnoughBalance
+		}
+		return err
+	}
+
+	return nil
+}
+
+func addWallet(ec db.ExecContext, userID uuid.UUID, amount uint64) error {
+	wallet, err := model.M.Wallet.GetForUser(ec, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = model.M.Wallet.AddBalance(ec, wallet.ID, amount)
+	return err
+}
+
+// Ledger entries of the users wallet, newest first
+func Statement(ec db.ExecContext, userID uuid.UUID) ([]model.LedgerEntry, error) {
+	return model.M.Ledger.GetAllForAccount(ec, model.AccountUser, userID)
+}
+
+func Balance(ec db.ExecContext, account Account) (int64, error) {
+	return model.M.Ledger.GetBalance(ec, account.Kind, account.ID)
+}
+
+// Returns wallets whose balance doesn't match the ledger
+func Reconcile(ec db.ExecContext) ([]model.WalletMismatch, error) {
+	return model.M.Ledger.GetWalletMismatches(ec)
+}
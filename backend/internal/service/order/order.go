@@ -1,78 +1,302 @@
 package order
 
 import (
+	"LuomuTori/internal/config"
 	"LuomuTori/internal/db"
 	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/escrow"
+	"LuomuTori/internal/service/fee"
+	"LuomuTori/internal/service/ledger"
 	"LuomuTori/internal/service/payment"
+	"LuomuTori/internal/service/pledge"
 	"database/sql"
 	"errors"
 	"github.com/google/uuid"
+	"strconv"
+	"time"
 )
 
 var (
-	ErrNotEnoughBalance = errors.New("Not enough balance")
-	ErrCustomerIsVendor = errors.New("Customer can't be vendor")
+	ErrNotEnoughBalance      = errors.New("Not enough balance")
+	ErrCustomerIsVendor      = errors.New("Customer can't be vendor")
+	ErrInvalidDeliveryMethod = errors.New("Delivery method is not for these products")
+	ErrInvalidQuote          = errors.New("Invalid quote")
+	ErrQuoteExpired          = errors.New("Quote has expired")
+	ErrEmptyCart             = errors.New("Cart is empty")
+	ErrInvalidItems          = errors.New("Items must be from one vendor and have a positive count")
+	ErrMixedCurrencies       = errors.New("Items must be priced in the same currency")
+	ErrOutOfStock            = errors.New("Not enough stock")
+	ErrBuyingBanned          = errors.New("Customer is banned from buying")
+	ErrVendorBanned          = errors.New("Vendor is banned from selling")
+	ErrVendorNotSelling      = errors.New("Vendor is not selling at the moment")
+	ErrOrderLimit            = errors.New("Order is over the limit of the vendor")
+	ErrListingChanged        = errors.New("Listing has been edited")
 )
 
-func Create(db *sql.DB, priceID, deliveryMethodID, customerID uuid.UUID, details string) (*model.Order, error) {
-	price, err := model.M.Price.Get(db, priceID)
-	if err != nil {
-		return nil, err
+// Most units of one pricing in an order
+const MaxItemCount = 100
+
+// Prices the items of one vendor in XMR at the current rate of their currency.
+// The delivery method must belong to one of the products.
+// The quote is valid for config.QuoteTTL and can be used for one order.
+func Quote(db *sql.DB, items []model.CartItem, deliveryMethodID, customerID uuid.UUID) (*model.Quote, error) {
+	if len(items) == 0 {
+		return nil, ErrEmptyCart
 	}
 
-	delivery, err := model.M.DeliveryMethod.Get(db, deliveryMethodID)
+	banned, err := model.M.Ban.IsBanned(db, customerID, model.BanBuying)
 	if err != nil {
 		return nil, err
 	}
+	if banned {
+		return nil, ErrBuyingBanned
+	}
 
-	wallet, err := model.M.Wallet.GetForUser(db, customerID)
-	if err != nil {
-		return nil, err
+	quote := model.Quote{
+		CustomerID:       customerID,
+		DeliveryMethodID: deliveryMethodID,
+		Items:            make([]model.QuoteItem, 0, len(items)),
 	}
 
-	xmrPrice := payment.Fiat2XMR(float64(price.Price + delivery.Price))
-	if wallet.Balance >= xmrPrice {
-		tx, err := db.Begin()
-		if err != nil {
-			return nil, err
+	productIDs := make(map[uuid.UUID]bool)
+	grams := make(map[uuid.UUID]int)
+	for i, item := range items {
+		if item.Count <= 0 || item.Count > MaxItemCount {
+			return nil, ErrInvalidItems
 		}
-		defer tx.Rollback()
 
-		_, err = model.M.Wallet.ReduceBalance(tx, wallet.ID, xmrPrice)
+		price, err := model.M.Price.GetCurrent(db, item.PriceID)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrListingChanged
+			}
 			return nil, err
 		}
 
-		order, err := model.M.Order.Create(tx, priceID, deliveryMethodID, customerID, model.StatusPaid, details)
+		product, err := model.M.Product.Get(db, price.ProductID)
 		if err != nil {
 			return nil, err
 		}
 
-		if IsVendor(tx, customerID, order.ID) {
-			return nil, ErrCustomerIsVendor
+		if i == 0 {
+			quote.VendorID = product.VendorID
+			quote.Currency = product.Currency
+		} else if product.VendorID != quote.VendorID {
+			return nil, ErrInvalidItems
+		} else if product.Currency != quote.Currency {
+			return nil, ErrMixedCurrencies
 		}
 
-		// Invoice is used to store the value in escrow
-		if _, err := model.M.Invoice.Create(tx, wallet.Address, order.ID, payment.TakeCut(xmrPrice)); err != nil {
-			return nil, err
+		for _, qi := range quote.Items {
+			if qi.PriceID == price.ID {
+				return nil, ErrInvalidItems
+			}
 		}
 
-		if err := tx.Commit(); err != nil {
-			return nil, err
+		// Checked again when the order is made
+		grams[product.ID] += item.Count * price.Quantity
+		if !product.InStock(grams[product.ID]) {
+			return nil, ErrOutOfStock
+		}
+
+		productIDs[product.ID] = true
+		quote.ItemTotal += item.Count * price.Price
+		quote.Items = append(quote.Items, model.QuoteItem{
+			PriceID:   price.ID,
+			Count:     item.Count,
+			UnitPrice: price.Price,
+		})
+	}
+
+	if quote.VendorID == customerID {
+		return nil, ErrCustomerIsVendor
+	}
+
+	banned, err = model.M.Ban.IsBanned(db, quote.VendorID, model.BanSelling)
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		return nil, ErrVendorBanned
+	}
+
+	delivery, err := model.M.DeliveryMethod.GetCurrent(db, deliveryMethodID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrListingChanged
 		}
+		return nil, err
+	}
+
+	if !productIDs[delivery.ProductID] {
+		return nil, ErrInvalidDeliveryMethod
+	}
+	quote.DeliveryTotal = delivery.Price
+
+	// Refuse to convert the price with an outdated rate
+	if err := payment.CheckRate(quote.Currency); err != nil {
+		return nil, err
+	}
+
+	schedule, err := fee.Current(db)
+	if err != nil {
+		return nil, err
+	}
+
+	commission, err := schedule.Commission(db, quote.VendorID)
+	if err != nil {
+		return nil, err
+	}
+
+	quote.XMRAmount = payment.Fiat2XMRIn(float64(quote.FiatTotal()), quote.Currency)
+
+	// Vendors with a larger pledge can take larger orders
+	limit, err := pledge.OrderLimit(db, quote.VendorID)
+	if err != nil {
+		if errors.Is(err, pledge.ErrNotSelling) {
+			return nil, ErrVendorNotSelling
+		}
+		return nil, err
+	}
+	if limit > 0 && quote.XMRAmount > limit {
+		return nil, ErrOrderLimit
+	}
+
+	quote.Fee = quote.XMRAmount - payment.TakeCut(quote.XMRAmount, commission)
+	quote.FeeScheduleID = schedule.ID
+	quote.CommissionBps = commission
+	quote.ExpiresAt = time.Now().Add(config.QuoteTTL)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := model.M.Quote.Create(tx, quote)
+	if err != nil {
+		return nil, err
+	}
 
-		return order, nil
-	} else {
-		return nil, ErrNotEnoughBalance
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
+
+	return created, nil
 }
 
-func Complete(db *sql.DB, orderID uuid.UUID) error {
-	invoice, err := model.M.Invoice.GetWithOrderID(db, orderID)
+// Creates one order with the items of the quote and debits exactly the quoted XMR amount into a single escrow
+func Create(db *sql.DB, quoteID, customerID uuid.UUID, details string) (*model.Order, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
+	quote, err := model.M.Quote.GetForUpdate(tx, quoteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidQuote
+		}
+		return nil, err
+	}
+
+	if quote.CustomerID != customerID || quote.IsUsed() {
+		return nil, ErrInvalidQuote
+	}
+
+	if quote.IsExpired() {
+		return nil, ErrQuoteExpired
+	}
+
+	if quote.VendorID == customerID {
+		return nil, ErrCustomerIsVendor
+	}
+
+	// Either could have been banned after the quote
+	banned, err := model.M.Ban.IsBanned(tx, customerID, model.BanBuying)
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		return nil, ErrBuyingBanned
+	}
+
+	banned, err = model.M.Ban.IsBanned(tx, quote.VendorID, model.BanSelling)
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		return nil, ErrVendorBanned
+	}
+
+	// A forfeit after the quote can lower the limit
+	limit, err := pledge.OrderLimit(tx, quote.VendorID)
+	if err != nil {
+		if errors.Is(err, pledge.ErrNotSelling) {
+			return nil, ErrVendorNotSelling
+		}
+		return nil, err
+	}
+	if limit > 0 && quote.XMRAmount > limit {
+		return nil, ErrOrderLimit
+	}
+
+	// Quoted pricings must still be for sale, the order is made with the version the customer saw
+	for _, item := range quote.Items {
+		if _, err := model.M.Price.GetCurrent(tx, item.PriceID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrListingChanged
+			}
+			return nil, err
+		}
+	}
+	if _, err := model.M.DeliveryMethod.GetCurrent(tx, quote.DeliveryMethodID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrListingChanged
+		}
+		return nil, err
+	}
+
+	order, err := model.M.Order.Create(tx, quote.VendorID, quote.DeliveryMethodID, customerID, model.StatusPaid, details)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range quote.Items {
+		if _, err := model.M.OrderItem.Create(tx, order.ID, item.PriceID, item.Count, item.UnitPrice); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := takeStock(tx, order.ID); err != nil {
+		return nil, err
+	}
+
+	if err := model.M.Quote.SetOrder(tx, quote.ID, order.ID); err != nil {
+		return nil, err
+	}
+
+	if _, err := model.M.OrderEvent.Create(tx, order.ID, order.Status, model.CustomerActor(customerID)); err != nil {
+		return nil, err
+	}
+
+	escrowAmount := quote.XMRAmount - quote.Fee
+	if _, err := escrow.Hold(tx, order.ID, customerID, escrowAmount, quote.Fee, quote.FeeScheduleID, quote.CommissionBps); err != nil {
+		if errors.Is(err, ledger.ErrNotEnoughBalance) {
+			return nil, ErrNotEnoughBalance
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func Complete(db *sql.DB, orderID uuid.UUID, actor model.Actor) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -84,17 +308,16 @@ func Complete(db *sql.DB, orderID uuid.UUID) error {
 		return err
 	}
 
-	vendor, err := model.M.Order.GetVendor(tx, order.ID)
-	if err != nil {
+	if _, err := model.M.OrderEvent.Create(tx, order.ID, order.Status, actor); err != nil {
 		return err
 	}
 
-	wallet, err := model.M.Wallet.GetForUser(tx, vendor.ID)
+	vendor, err := model.M.Order.GetVendor(tx, order.ID)
 	if err != nil {
 		return err
 	}
 
-	if _, err = model.M.Wallet.AddBalance(tx, wallet.ID, invoice.XMRPrice); err != nil {
+	if _, err := escrow.Release(tx, order.ID, vendor.ID); err != nil {
 		return err
 	}
 
@@ -105,7 +328,7 @@ func Complete(db *sql.DB, orderID uuid.UUID) error {
 	return nil
 }
 
-func Refund(db *sql.DB, orderID uuid.UUID) error {
+func Refund(db *sql.DB, orderID uuid.UUID, actor model.Actor) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -117,17 +340,15 @@ func Refund(db *sql.DB, orderID uuid.UUID) error {
 		return err
 	}
 
-	invoice, err := model.M.Invoice.GetForOrder(tx, order.ID)
-	if err != nil {
+	if _, err := model.M.OrderEvent.Create(tx, order.ID, order.Status, actor); err != nil {
 		return err
 	}
 
-	customerWallet, err := model.M.Wallet.GetForUser(tx, order.CustomerID)
-	if err != nil {
+	if _, err := escrow.Refund(tx, order.ID, order.CustomerID); err != nil {
 		return err
 	}
 
-	if _, err := model.M.Wallet.AddBalance(tx, customerWallet.ID, invoice.XMRPrice); err != nil {
+	if err := restock(tx, order.ID); err != nil {
 		return err
 	}
 
@@ -138,7 +359,7 @@ func Refund(db *sql.DB, orderID uuid.UUID) error {
 	return nil
 }
 
-func Deliver(db *sql.DB, orderID uuid.UUID, info string) (*model.Order, error) {
+func Deliver(db *sql.DB, orderID uuid.UUID, info string, actor model.Actor) (*model.Order, error) {
 	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
@@ -150,6 +371,10 @@ func Deliver(db *sql.DB, orderID uuid.UUID, info string) (*model.Order, error) {
 		return nil, err
 	}
 
+	if _, err := model.M.OrderEvent.Create(tx, order.ID, order.Status, actor); err != nil {
+		return nil, err
+	}
+
 	if _, err := model.M.DeliveryInfo.Create(tx, info, orderID); err != nil {
 		return nil, err
 	}
@@ -162,7 +387,7 @@ func Deliver(db *sql.DB, orderID uuid.UUID, info string) (*model.Order, error) {
 
 }
 
-func Decline(db *sql.DB, orderID uuid.UUID, reason string) error {
+func Decline(db *sql.DB, orderID uuid.UUID, reason string, actor model.Actor) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
@@ -174,21 +399,19 @@ func Decline(db *sql.DB, orderID uuid.UUID, reason string) error {
 		return err
 	}
 
-	invoice, err := model.M.Invoice.GetForOrder(tx, order.ID)
-	if err != nil {
+	if _, err := model.M.OrderEvent.Create(tx, order.ID, order.Status, actor); err != nil {
 		return err
 	}
 
-	customerWallet, err := model.M.Wallet.GetForUser(tx, order.CustomerID)
-	if err != nil {
+	if _, err := escrow.Refund(tx, order.ID, order.CustomerID); err != nil {
 		return err
 	}
 
-	if _, err := model.M.Wallet.AddBalance(tx, customerWallet.ID, invoice.XMRPrice); err != nil {
+	if _, err := model.M.DeclineReason.Create(tx, reason, orderID); err != nil {
 		return err
 	}
 
-	if _, err := model.M.DeclineReason.Create(tx, reason, orderID); err != nil {
+	if err := restock(tx, order.ID); err != nil {
 		return err
 	}
 
@@ -221,7 +444,68 @@ func CompleteForgotten(db *sql.DB) error {
 		if err != nil {
 			return err
 		}
-		if err := Complete(db, id); err != nil {
+		// Customer may have reviewed or disputed the order in the meantime
+		if err := Complete(db, id, model.SystemActor); err != nil && !errors.Is(err, model.ErrIllegalTransition) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Takes the ordered grams from the stock of the products.
+// The vendor is notified when the stock of a product falls to its low stock limit.
+func takeStock(ec db.ExecContext, orderID uuid.UUID) error {
+	items, err := model.M.OrderItem.GetAllForOrder(ec, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		price, err := model.M.Price.Get(ec, item.PriceID)
+		if err != nil {
+			return err
+		}
+
+		grams := item.Count * price.Quantity
+		product, err := model.M.Product.TakeStock(ec, price.ProductID, grams)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrOutOfStock
+			}
+			return err
+		}
+
+		if !product.Stock.Valid {
+			continue
+		}
+
+		left := int(product.Stock.Int32)
+		if left <= product.LowStock && left+grams > product.LowStock {
+			_, err := model.M.Notification.Create(ec, product.VendorID, "Stock of %s is running low, %sg left.", product.Title, strconv.Itoa(left))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the grams of an order that wasn't delivered to the stock of the products
+func restock(ec db.ExecContext, orderID uuid.UUID) error {
+	items, err := model.M.OrderItem.GetAllForOrder(ec, orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		price, err := model.M.Price.Get(ec, item.PriceID)
+		if err != nil {
+			return err
+		}
+
+		if err := model.M.Product.Restock(ec, price.ProductID, item.Count*price.Quantity); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,71 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/google/uuid"
+	"net/url"
+	"sync"
+)
+
+var ErrInvalidCallbackToken = errors.New("Invalid callback token")
+
+var (
+	callbackKeyMu sync.RWMutex
+	callbackKey   []byte
+)
+
+// Sets the key of the tokens in deposit callback URLs. Keep it across restarts, callbacks of
+// invoices created under another key are rejected and their deposits wait for HandleDeposits.
+func SetCallbackKey(key []byte) {
+	callbackKeyMu.Lock()
+	defer callbackKeyMu.Unlock()
+	callbackKey = key
+}
+
+// Sets the key from the callback-secret flag, or a random one when no secret is set.
+// Reports whether the key is random.
+func SetCallbackSecret(secret string) (bool, error) {
+	if secret != "" {
+		SetCallbackKey([]byte(secret))
+		return false, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return false, err
+	}
+	SetCallbackKey(key)
+	return true, nil
+}
+
+func callbackToken(userID, invoiceID uuid.UUID) string {
+	callbackKeyMu.RLock()
+	defer callbackKeyMu.RUnlock()
+
+	mac := hmac.New(sha256.New, callbackKey)
+	mac.Write([]byte(userID.String() + ":" + invoiceID.String()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Checks the token of a deposit callback URL and returns the user and the invoice it was created for
+func VerifyDepositCallback(query url.Values) (uuid.UUID, uuid.UUID, error) {
+	userID, err := uuid.Parse(query.Get("user-id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, ErrInvalidCallbackToken
+	}
+
+	invoiceID, err := uuid.Parse(query.Get("invoice"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, ErrInvalidCallbackToken
+	}
+
+	if !hmac.Equal([]byte(query.Get("token")), []byte(callbackToken(userID, invoiceID))) {
+		return uuid.Nil, uuid.Nil, ErrInvalidCallbackToken
+	}
+
+	return userID, invoiceID, nil
+}
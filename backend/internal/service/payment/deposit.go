@@ -1,52 +1,115 @@
 package payment
 
 import (
+	mydb "LuomuTori/internal/db"
 	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/ledger"
 	"database/sql"
+	"errors"
 	"github.com/google/uuid"
-	moneropay "gitlab.com/moneropay/moneropay/v2/pkg/model"
 )
 
-func CreateInvoiceForDeposits(userID uuid.UUID) (*moneropay.ReceivePostResponse, error) {
-	return moneropayReceivePost(0, "deposit", moneropayDepositCallbackURL(userID))
+var (
+	ErrInvalidDeposit     = errors.New("Invalid deposit")
+	ErrUnconfirmedDeposit = errors.New("Deposit not confirmed by the wallet")
+	ErrStaleInvoice       = errors.New("Invoice is not the current one of the wallet")
+)
+
+// Confirmations after which the backend normally reports a deposit unlocked
+const DepositConfirmations = 10
+
+// Acts on a deposit callback of the current invoice of the wallet only after the backend confirms
+// the transaction on its address, and records what the backend reports instead of the callback body.
+func HandleCallbackDeposit(db *sql.DB, wb WalletBackend, userID, invoiceID uuid.UUID, t Incoming) error {
+	if t.TxHash == "" || t.Amount == 0 {
+		return ErrInvalidDeposit
+	}
+
+	wallet, err := model.M.Wallet.GetForUser(db, userID)
+	if err != nil {
+		return err
+	}
+	if wallet.InvoiceID != invoiceID {
+		return ErrStaleInvoice
+	}
+
+	data, err := wb.Received(wallet.Address)
+	if err != nil {
+		return err
+	}
+
+	for _, confirmed := range data.Transactions {
+		if confirmed.TxHash == t.TxHash && confirmed.Amount == t.Amount {
+			return recordDeposit(db, *wallet, confirmed)
+		}
+	}
+
+	return ErrUnconfirmedDeposit
 }
 
-func HandleDeposits(db *sql.DB) error {
+func HandleDeposits(db *sql.DB, wb WalletBackend) error {
 	wallets, err := model.M.Wallet.GetAll(db)
 	if err != nil {
 		return err
 	}
 
 	for _, w := range wallets {
-		data, err := moneropayReceiveGet(w.Address)
+		data, err := wb.Received(w.Address)
 		if err != nil {
 			return err
 		}
 
-		if data.Amount.Covered.Unlocked > 0 && data.Amount.Covered.Unlocked == data.Amount.Covered.Total {
-			tx, err := db.Begin()
-			if err != nil {
-				return err
-			}
-			defer tx.Rollback()
-
-			if _, err := model.M.Wallet.AddBalance(db, w.ID, data.Amount.Covered.Unlocked); err != nil {
+		for _, t := range data.Transactions {
+			if err := recordDeposit(db, w, t); err != nil {
 				return err
 			}
+		}
 
-			invoice, err := CreateInvoiceForDeposits(w.UserID)
+		// Everything sent to the address is credited, the next deposit goes to a new one
+		if data.Unlocked > 0 && data.Unlocked == data.Total {
+			invoiceID := uuid.New()
+			address, err := wb.NewDepositAddress(w.UserID, invoiceID)
 			if err != nil {
 				return err
 			}
 
-			if _, err = model.M.Wallet.UpdateAddress(db, w.ID, invoice.Address); err != nil {
-				return err
-			}
-
-			if err := tx.Commit(); err != nil {
+			if _, err = model.M.Wallet.UpdateAddress(db, w.ID, address, invoiceID); err != nil {
 				return err
 			}
 		}
 	}
 	return nil
 }
+
+// Records a transaction the backend reported for the wallet address and credits it once it's unlocked
+func recordDeposit(db *sql.DB, w model.Wallet, t Incoming) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deposit, err := model.M.Deposit.Record(tx, w.ID, w.Address, t.TxHash, t.Amount, t.Confirmations)
+	if err != nil {
+		return err
+	}
+
+	if !t.Locked {
+		if err := creditDeposit(tx, w.UserID, deposit); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Adds the deposit to the balance of the user unless it was credited already.
+// Call this inside a database transaction.
+func creditDeposit(tx mydb.ExecContext, userID uuid.UUID, deposit *model.Deposit) error {
+	first, err := model.M.Deposit.MarkCredited(tx, deposit.ID)
+	if err != nil || !first {
+		return err
+	}
+
+	return ledger.Transfer(tx, model.LedgerDeposit, deposit.ID, ledger.Deposits, ledger.To(ledger.User(userID), deposit.Amount))
+}
@@ -0,0 +1,108 @@
+package payment
+
+import (
+	"LuomuTori/internal/log"
+	"LuomuTori/internal/model"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"os"
+	"testing"
+)
+
+// Migrated database of the tests, emptied of users. Set TEST_DSN to run them. Packages share
+// the database, so run them with -p 1.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DSN not set")
+	}
+	log.Init()
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("TRUNCATE users CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// User with a wallet on a deposit address of the backend
+func testWallet(t *testing.T, db *sql.DB, wb WalletBackend) *model.Wallet {
+	u, err := model.M.User.Create(db, "user-"+uuid.NewString(), []byte("hash"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invoiceID := uuid.New()
+	address, err := wb.NewDepositAddress(u.ID, invoiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := model.M.Wallet.Create(db, u.ID, address, invoiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestHandleDeposits(t *testing.T) {
+	db := testDB(t)
+	fake := NewFakeWallet()
+	w := testWallet(t, db, fake)
+
+	txHash, err := fake.Deposit(w.Address, 2*XMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := HandleDeposits(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := model.M.Deposit.GetPendingForWallet(db, w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].TxHash != txHash || pending[0].Amount != 2*XMR {
+		t.Fatalf("Locked deposit should wait to be credited, got %+v\n", pending)
+	}
+
+	// Callbacks are checked against the wallet
+	forged := Incoming{TxHash: txHash, Amount: 200 * XMR}
+	if err := HandleCallbackDeposit(db, fake, w.UserID, w.InvoiceID, forged); !errors.Is(err, ErrUnconfirmedDeposit) {
+		t.Fatalf("Callback with another amount should not be confirmed, got %v\n", err)
+	}
+	valid := Incoming{TxHash: txHash, Amount: 2 * XMR}
+	if err := HandleCallbackDeposit(db, fake, w.UserID, uuid.New(), valid); !errors.Is(err, ErrStaleInvoice) {
+		t.Fatalf("Callback of another invoice should be rejected, got %v\n", err)
+	}
+
+	// Both the callback and polling see the unlocked deposit
+	fake.Confirm(DepositConfirmations)
+	if err := HandleCallbackDeposit(db, fake, w.UserID, w.InvoiceID, valid); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleDeposits(db, fake); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := model.M.Wallet.Get(db, w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Balance != 2*XMR {
+		t.Fatalf("Deposit should be credited once, got balance %d\n", after.Balance)
+	}
+	if after.Address == w.Address || after.InvoiceID == w.InvoiceID {
+		t.Fatalf("Credited address should be replaced with a new invoice\n")
+	}
+	if pending, _ := model.M.Deposit.GetPendingForWallet(db, w.ID); len(pending) != 0 {
+		t.Fatalf("Nothing should wait to be credited, got %+v\n", pending)
+	}
+}
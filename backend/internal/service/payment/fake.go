@@ -0,0 +1,220 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/moneropay/go-monero/walletrpc"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFakeUnreachable = errors.New("Wallet unreachable")
+	ErrFakeUnknown     = errors.New("Unknown address or transaction")
+)
+
+// In-memory WalletBackend for tests and development. Nothing happens on its own, deposits,
+// confirmations, unlocks and failed transfers are simulated by calling its methods.
+// Addresses and tx hashes are numbered, so every run gives the same ones.
+type FakeWallet struct {
+	mu sync.Mutex
+	// Transfer refuses payouts like a wallet without enough unlocked funds
+	RejectTransfers bool
+	// Every call fails like when the wallet is down
+	Unreachable bool
+	// Transfer returns the payout of a retried idempotency key like wallet-rpc does.
+	// Off by default, a retry pays again like with moneropay.
+	Idempotent bool
+
+	n        int
+	incoming map[string][]*Incoming
+	payouts  []*FakePayout
+}
+
+type FakePayout struct {
+	Destinations   []walletrpc.Destination
+	IdempotencyKey uuid.UUID
+	TxHash         string
+	Confirmations  uint64
+	Failed         bool
+}
+
+func NewFakeWallet() *FakeWallet {
+	return &FakeWallet{incoming: make(map[string][]*Incoming)}
+}
+
+func (f *FakeWallet) NewDepositAddress(userID, invoiceID uuid.UUID) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Unreachable {
+		return "", ErrFakeUnreachable
+	}
+
+	f.n++
+	address := fmt.Sprintf("4%094d", f.n)
+	f.incoming[address] = nil
+	return address, nil
+}
+
+func (f *FakeWallet) Received(address string) (*Received, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Unreachable {
+		return nil, ErrFakeUnreachable
+	}
+
+	ts, ok := f.incoming[address]
+	if !ok {
+		return nil, ErrFakeUnknown
+	}
+
+	received := &Received{Transactions: make([]Incoming, 0, len(ts))}
+	for _, t := range ts {
+		received.Total += t.Amount
+		if !t.Locked {
+			received.Unlocked += t.Amount
+		}
+		received.Transactions = append(received.Transactions, *t)
+	}
+
+	return received, nil
+}
+
+// With Idempotent a retry with the key of an earlier payout returns that payout instead of paying again
+func (f *FakeWallet) Transfer(destinations []walletrpc.Destination, idempotencyKey uuid.UUID, since time.Time) (*Transfer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Unreachable {
+		return nil, ErrFakeUnreachable
+	}
+	if f.RejectTransfers {
+		return nil, fmt.Errorf("%w: %w", ErrTransferRejected, ErrWalletOutOfFunds)
+	}
+
+	for _, p := range f.payouts {
+		if f.Idempotent && p.IdempotencyKey == idempotencyKey {
+			return &Transfer{TxHash: p.TxHash, TxHashList: []string{p.TxHash}}, nil
+		}
+	}
+
+	p := &FakePayout{
+		Destinations:   destinations,
+		IdempotencyKey: idempotencyKey,
+		TxHash:         f.nextTxHash(),
+	}
+	f.payouts = append(f.payouts, p)
+
+	return &Transfer{TxHash: p.TxHash, TxHashList: []string{p.TxHash}}, nil
+}
+
+func (f *FakeWallet) IdempotentTransfers() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Idempotent
+}
+
+func (f *FakeWallet) TransferStatus(txHash string) (*TransferStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Unreachable {
+		return nil, ErrFakeUnreachable
+	}
+
+	for _, p := range f.payouts {
+		if p.TxHash == txHash {
+			return &TransferStatus{Failed: p.Failed, Confirmations: p.Confirmations}, nil
+		}
+	}
+
+	return nil, ErrFakeUnknown
+}
+
+// Receives a locked transaction to the address and returns its hash
+func (f *FakeWallet) Deposit(address string, amount uint64) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.incoming[address]; !ok {
+		return "", ErrFakeUnknown
+	}
+
+	t := &Incoming{TxHash: f.nextTxHash(), Amount: amount, Locked: true}
+	f.incoming[address] = append(f.incoming[address], t)
+	return t.TxHash, nil
+}
+
+// Mines blocks on top of every transaction. Deposits unlock at DepositConfirmations.
+func (f *FakeWallet) Confirm(blocks uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ts := range f.incoming {
+		for _, t := range ts {
+			t.Confirmations += blocks
+			if t.Confirmations >= DepositConfirmations {
+				t.Locked = false
+			}
+		}
+	}
+
+	for _, p := range f.payouts {
+		if !p.Failed {
+			p.Confirmations += blocks
+		}
+	}
+}
+
+// Unlocks a deposit before it has enough confirmations, like one without an unlock time would be
+func (f *FakeWallet) Unlock(txHash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ts := range f.incoming {
+		for _, t := range ts {
+			if t.TxHash == txHash {
+				t.Locked = false
+				return nil
+			}
+		}
+	}
+
+	return ErrFakeUnknown
+}
+
+// Fails a payout like a transaction dropped from the pool
+func (f *FakeWallet) FailTransfer(txHash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, p := range f.payouts {
+		if p.TxHash == txHash {
+			p.Failed = true
+			p.Confirmations = 0
+			return nil
+		}
+	}
+
+	return ErrFakeUnknown
+}
+
+// Payouts made so far, oldest first
+func (f *FakeWallet) Payouts() []FakePayout {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payouts := make([]FakePayout, 0, len(f.payouts))
+	for _, p := range f.payouts {
+		payouts = append(payouts, *p)
+	}
+	return payouts
+}
+
+func (f *FakeWallet) nextTxHash() string {
+	f.n++
+	return fmt.Sprintf("%064x", f.n)
+}
@@ -0,0 +1,210 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"gitlab.com/moneropay/go-monero/walletrpc"
+	moneropay "gitlab.com/moneropay/moneropay/v2/pkg/model"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const DepositRoute = "/deposit"
+
+// WalletBackend of a moneropay instance. Moneropay calls back to DepositRoute at CallbackAddr
+// when a deposit address receives a transaction.
+type Moneropay struct {
+	URL          string
+	CallbackAddr string
+	Client       *http.Client
+}
+
+func NewMoneropay(url, callbackAddr string) *Moneropay {
+	return &Moneropay{
+		URL:          url,
+		CallbackAddr: callbackAddr,
+		Client:       http.DefaultClient,
+	}
+}
+
+func (m *Moneropay) NewDepositAddress(userID, invoiceID uuid.UUID) (string, error) {
+	req := moneropay.ReceivePostRequest{
+		Amount:      0,
+		Description: "deposit",
+		CallbackUrl: m.depositCallbackURL(userID, invoiceID),
+	}
+
+	invoice := new(moneropay.ReceivePostResponse)
+	if err := m.post("/receive", &req, nil, invoice); err != nil {
+		return "", err
+	}
+
+	return invoice.Address, nil
+}
+
+func (m *Moneropay) Received(address string) (*Received, error) {
+	data := new(moneropay.ReceiveGetResponse)
+	if err := m.get("/receive/"+url.PathEscape(address), data); err != nil {
+		return nil, err
+	}
+
+	received := &Received{
+		Total:        data.Amount.Covered.Total,
+		Unlocked:     data.Amount.Covered.Unlocked,
+		Transactions: make([]Incoming, 0, len(data.Transactions)),
+	}
+	for _, t := range data.Transactions {
+		received.Transactions = append(received.Transactions, incoming(t))
+	}
+
+	return received, nil
+}
+
+// Only an error of the wallet with a code in refusalCodes is a rejection. Moneropay answers timeouts,
+// lost daemon connections and failed relays with error statuses too, those may have sent the transfer.
+// The idempotency key is sent for proxies that deduplicate retries, moneropay itself ignores it.
+func (m *Moneropay) Transfer(destinations []walletrpc.Destination, idempotencyKey uuid.UUID, since time.Time) (*Transfer, error) {
+	req := moneropay.TransferPostRequest{
+		Destinations: destinations,
+	}
+	header := http.Header{"Idempotency-Key": {idempotencyKey.String()}}
+
+	data := new(moneropay.TransferPostResponse)
+	if err := m.post("/transfer", &req, header, data); err != nil {
+		var rerr *responseError
+		if errors.As(err, &rerr) && rerr.Code != nil {
+			if _, ok := refusalCodes[*rerr.Code]; ok {
+				return nil, transferRefused(*rerr.Code, err)
+			}
+		}
+		return nil, err
+	}
+
+	return &Transfer{TxHash: data.TxHash, TxHashList: data.TxHashList}, nil
+}
+
+// Moneropay forgets the key, a retry pays again. It also can't list the transfers of the wallet,
+// so interrupted withdrawals are left for staff to look up in the wallet and resolve.
+func (m *Moneropay) IdempotentTransfers() bool {
+	return false
+}
+
+func (m *Moneropay) TransferStatus(txHash string) (*TransferStatus, error) {
+	data := new(moneropay.TransferGetResponse)
+	if err := m.get("/transfer/"+url.PathEscape(txHash), data); err != nil {
+		return nil, err
+	}
+
+	return &TransferStatus{Failed: data.State == "failed", Confirmations: data.Confirmations}, nil
+}
+
+// Transaction of a moneropay callback or receive response
+func incoming(t moneropay.TransactionData) Incoming {
+	return Incoming{
+		TxHash:        t.TxHash,
+		Amount:        t.Amount,
+		Confirmations: t.Confirmations,
+		Locked:        t.Locked,
+	}
+}
+
+// Reads the transaction out of the body of a moneropay deposit callback
+func DecodeMoneropayCallback(r io.Reader) (Incoming, error) {
+	var data moneropay.CallbackResponse
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return Incoming{}, err
+	}
+	return incoming(data.Transaction), nil
+}
+
+// The invoice id is stored with the address, so a leaked URL is good only until the address changes
+func (m *Moneropay) depositCallbackURL(userID, invoiceID uuid.UUID) string {
+	query := url.Values{
+		"user-id": {userID.String()},
+		"invoice": {invoiceID.String()},
+		"token":   {callbackToken(userID, invoiceID)},
+	}
+	return "http://" + m.CallbackAddr + DepositRoute + "?" + query.Encode()
+}
+
+func (m *Moneropay) get(path string, data any) error {
+	resp, err := m.Client.Get(m.URL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newResponseError(resp)
+	}
+
+	return decodeBody(resp, data)
+}
+
+func (m *Moneropay) post(path string, body any, header http.Header, data any) error {
+	reqBytes, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.URL+path, bytes.NewReader(reqBytes))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newResponseError(resp)
+	}
+
+	return decodeBody(resp, data)
+}
+
+// Moneropay answered with an error status. Code is that of the wallet when the wallet failed.
+type responseError struct {
+	Status  string
+	Code    *int
+	Message string
+}
+
+func newResponseError(resp *http.Response) *responseError {
+	e := &responseError{Status: resp.Status}
+
+	// Errors of moneropay have a body, those of proxies in front of it may not
+	var data moneropay.ErrorResponse
+	if err := decodeBody(resp, &data); err == nil {
+		e.Code = data.Code
+		e.Message = data.Message
+	}
+
+	return e
+}
+
+func (e *responseError) Error() string {
+	if e.Message != "" {
+		return "Invalid response: " + e.Status + ": " + e.Message
+	}
+	return "Invalid response: " + e.Status
+}
+
+func decodeBody(resp *http.Response, data any) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, data)
+}
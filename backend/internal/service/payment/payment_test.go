@@ -1,16 +1,27 @@
 package payment
 
 import (
+	"LuomuTori/internal/log"
+	"LuomuTori/internal/model"
+	"errors"
+	"github.com/google/uuid"
 	"gitlab.com/moneropay/go-monero/walletrpc"
 	"math"
+	"net/url"
 	"testing"
+	"time"
 )
 
 func TestConversions(t *testing.T) {
+	SetRateProviders(StaticProvider{Prices: map[model.Currency]float64{model.CurrencyEUR: 152.37, model.CurrencyUSD: 165.2}})
 	if err := UpdateXMRPrice(); err != nil {
 		t.Fatalf("Failed to update XMR price\n")
 	}
 
+	if price := XMRPrice(); price != 152.37 {
+		t.Fatalf("Rate lost precision %f\n", price)
+	}
+
 	if err := math.Abs(walletrpc.XMRToFloat64(Fiat2XMR(XMRPrice())) - 1.0); err != 0 {
 		t.Fatalf("err is not 0, but %f\n", err)
 	}
@@ -19,7 +30,124 @@ func TestConversions(t *testing.T) {
 		t.Fatalf("Price of 1e12 piconeros should equal price of one XMR %f\n", price)
 	}
 
-	if TakeCut(100) != 95 {
+	if xmr := Fiat2XMRIn(165.2, model.CurrencyUSD); xmr != XMR {
+		t.Fatalf("Price of one XMR in USD should convert to 1e12 piconeros, got %d\n", xmr)
+	}
+
+	if eur := ConvertFiat(165.2, model.CurrencyUSD, model.CurrencyEUR); math.Abs(eur-152.37) > 1e-9 {
+		t.Fatalf("USD should convert to EUR through the XMR rates, got %f\n", eur)
+	}
+
+	if TakeCut(100, 500) != 95 {
 		t.Fatalf("Failed to take cut\n")
 	}
+	if cut := TakeCut(100000*XMR, 250); cut != 97500*XMR {
+		t.Fatalf("Cut of a large amount should not overflow, got %d\n", cut)
+	}
+}
+
+type oldProvider struct{}
+
+func (oldProvider) Name() string { return "old" }
+
+func (oldProvider) Rate() (Rate, error) {
+	return Rate{Prices: eur(1000), At: time.Now().Add(-MaxRateAge - time.Minute)}, nil
+}
+
+func eur(price float64) map[model.Currency]float64 {
+	return map[model.Currency]float64{model.CurrencyEUR: price}
+}
+
+func TestRateAggregation(t *testing.T) {
+	log.Init()
+
+	if m := Median([]float64{3, 1, 2}); m != 2 {
+		t.Fatalf("Median of odd count should be the middle value, got %f\n", m)
+	}
+
+	if m := Median([]float64{4, 1, 3, 2}); m != 2.5 {
+		t.Fatalf("Median of even count should average the middle values, got %f\n", m)
+	}
+
+	SetRateProviders(StaticProvider{Prices: eur(150)}, StaticProvider{Prices: eur(160)}, StaticProvider{Prices: eur(500)}, oldProvider{})
+	if err := UpdateXMRPrice(); err != nil {
+		t.Fatal(err)
+	}
+
+	if price := XMRPrice(); price != 160 {
+		t.Fatalf("Stale rate or outlier affected the price %f\n", price)
+	}
+
+	if err := CheckRate(model.CurrencyEUR); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckRate(model.CurrencyUSD); err != ErrStaleRate {
+		t.Fatalf("Currency without a rate should be stale, got %v\n", err)
+	}
+
+	SetRateProviders(oldProvider{})
+	if err := UpdateXMRPrice(); err != ErrNoRate {
+		t.Fatalf("Expected ErrNoRate, got %v\n", err)
+	}
+
+	if price := XMRPrice(); price != 160 {
+		t.Fatalf("Failed update should keep the previous rate %f\n", price)
+	}
+
+	latestRate.Store(&rate{Prices: eur(160), UpdatedAt: time.Now().Add(-MaxRateAge - time.Minute)})
+	if err := CheckRate(model.CurrencyEUR); err != ErrStaleRate {
+		t.Fatalf("Expected ErrStaleRate, got %v\n", err)
+	}
+}
+
+func TestDepositCallbackToken(t *testing.T) {
+	SetCallbackKey([]byte("secret"))
+	defer SetCallbackKey(nil)
+
+	mp := NewMoneropay("http://localhost:5000", "localhost:4420")
+	userID, invoiceID := uuid.New(), uuid.New()
+	callback, err := url.Parse(mp.depositCallbackURL(userID, invoiceID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotUser, gotInvoice, err := VerifyDepositCallback(callback.Query())
+	if err != nil {
+		t.Fatalf("Callback URL should verify, got %v\n", err)
+	}
+	if gotUser != userID || gotInvoice != invoiceID {
+		t.Fatalf("Expected user %s and invoice %s, got %s and %s\n", userID, invoiceID, gotUser, gotInvoice)
+	}
+
+	other, _ := url.Parse(mp.depositCallbackURL(userID, uuid.New()))
+	if callback.Query().Get("token") == other.Query().Get("token") {
+		t.Fatalf("Each invoice should get a token of its own\n")
+	}
+
+	forged := callback.Query()
+	forged.Set("user-id", uuid.NewString())
+	if _, _, err := VerifyDepositCallback(forged); !errors.Is(err, ErrInvalidCallbackToken) {
+		t.Fatalf("Token of another user should be rejected, got %v\n", err)
+	}
+
+	SetCallbackKey([]byte("another secret"))
+	if _, _, err := VerifyDepositCallback(callback.Query()); !errors.Is(err, ErrInvalidCallbackToken) {
+		t.Fatalf("Token made with another key should be rejected, got %v\n", err)
+	}
+
+	if _, _, err := VerifyDepositCallback(url.Values{"user-id": {userID.String()}}); !errors.Is(err, ErrInvalidCallbackToken) {
+		t.Fatalf("Callback without a token should be rejected, got %v\n", err)
+	}
+
+	// Without a secret the key must not be empty, anyone could sign with it
+	if random, err := SetCallbackSecret(""); err != nil || !random {
+		t.Fatalf("Expected a random key, got %v %v\n", random, err)
+	}
+	SetCallbackKey(nil)
+	unkeyed, _ := url.Parse(mp.depositCallbackURL(userID, invoiceID))
+	SetCallbackSecret("")
+	if _, _, err := VerifyDepositCallback(unkeyed.Query()); !errors.Is(err, ErrInvalidCallbackToken) {
+		t.Fatalf("Token made without a key should be rejected, got %v\n", err)
+	}
 }
@@ -2,75 +2,164 @@ package payment
 
 import (
 	"LuomuTori/internal/log"
-	"encoding/json"
+	"LuomuTori/internal/model"
+	"errors"
 	"fmt"
-	"io"
 	"math"
-	"net/http"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"gitlab.com/moneropay/go-monero/walletrpc"
 )
 
-var url = "https://min-api.cryptocompare.com/data/price?fsym=XMR&tsyms=USD,EUR"
+var (
+	ErrStaleRate = errors.New("Exchange rate is out of date")
+	ErrNoRate    = errors.New("No exchange rate provider returned a fresh rate")
+)
+
+// How old the rate can be before prices in XMR are no longer quoted
+var MaxRateAge = 2 * time.Hour
+
+type rate struct {
+	Prices    map[model.Currency]float64
+	UpdatedAt time.Time
+}
+
+var latestRate atomic.Pointer[rate]
 
-var latestXMRPrice atomic.Int32
+var (
+	providersMu sync.Mutex
+	providers   []RateProvider
+)
 
-type prices struct {
-	USD float64
-	EUR float64
+func SetRateProviders(ps ...RateProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers = ps
 }
 
-func updateXMRPrice() (*prices, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Invalid response status: %s\n", resp.Status)
+// Asks every provider for the rates and stores the median of the fresh ones for each currency.
+// On failure the previous rates are kept, so prices keep working until they go stale.
+func UpdateXMRPrice() error {
+	providersMu.Lock()
+	ps := providers
+	providersMu.Unlock()
+
+	rates := make(map[model.Currency][]float64)
+	oldest := time.Now()
+	for _, p := range ps {
+		r, err := p.Rate()
+		if err != nil {
+			log.Error.Printf("Rate provider %s failed: %s\n", p.Name(), err.Error())
+			continue
+		}
+		if time.Since(r.At) > MaxRateAge {
+			log.Error.Printf("Rate provider %s returned a rate from %s\n", p.Name(), r.At)
+			continue
+		}
+
+		used := false
+		for currency, price := range r.Prices {
+			if !model.ValidCurrency(currency) {
+				continue
+			}
+			if price <= 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+				log.Error.Printf("Rate provider %s returned invalid %s rate %f\n", p.Name(), currency, price)
+				continue
+			}
+			rates[currency] = append(rates[currency], price)
+			used = true
+		}
+
+		if used && r.At.Before(oldest) {
+			oldest = r.At
+		}
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if len(rates) == 0 {
+		return ErrNoRate
 	}
 
-	prices := &prices{}
-	if err := json.Unmarshal(body, &prices); err != nil {
-		return nil, err
+	prices := make(map[model.Currency]float64, len(rates))
+	for currency, values := range rates {
+		prices[currency] = Median(values)
 	}
 
-	return prices, nil
+	latestRate.Store(&rate{Prices: prices, UpdatedAt: oldest})
+	return nil
 }
 
-func UpdateXMRPrice() error {
-	var err error = nil
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
 
-	for i := 0; i < 5; i++ {
-		var prices *prices = nil
-		if prices, err = updateXMRPrice(); err == nil {
-			latestXMRPrice.Store(int32(prices.EUR))
-			return nil
-		}
-		log.Error.Printf("Failed to update XMR price (try %d): %s\n", i+1, err.Error())
-		time.Sleep(time.Minute)
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
 	}
+	return sorted[mid]
+}
 
-	return err
+// Returns ErrStaleRate if there is no rate for the currency or it's older than MaxRateAge
+func CheckRate(currency model.Currency) error {
+	r := latestRate.Load()
+	if r == nil || r.Prices[currency] == 0 || time.Since(r.UpdatedAt) > MaxRateAge {
+		return ErrStaleRate
+	}
+	return nil
 }
 
 // How much 1XMR is in Fiat (EUR)
 func XMRPrice() float64 {
-	return float64(latestXMRPrice.Load())
+	return XMRPriceIn(model.CurrencyEUR)
+}
+
+// How much 1XMR is in the currency, 0 if the rate is unknown
+func XMRPriceIn(currency model.Currency) float64 {
+	r := latestRate.Load()
+	if r == nil {
+		return 0
+	}
+	return r.Prices[currency]
 }
 
 func Fiat2XMR(fiat float64) uint64 {
-	price := XMRPrice()
+	return Fiat2XMRIn(fiat, model.CurrencyEUR)
+}
+
+func Fiat2XMRIn(fiat float64, currency model.Currency) uint64 {
+	price := XMRPriceIn(currency)
+	if price == 0 {
+		return 0
+	}
 	return uint64(XMRf * math.Abs(fiat/price))
 }
 
 func XMR2Fiat(xmr uint64) float64 {
-	return walletrpc.XMRToFloat64(xmr) * XMRPrice()
+	return XMR2FiatIn(xmr, model.CurrencyEUR)
+}
+
+func XMR2FiatIn(xmr uint64, currency model.Currency) float64 {
+	return walletrpc.XMRToFloat64(xmr) * XMRPriceIn(currency)
+}
+
+// Converts between fiat currencies through their XMR rates, 0 if either rate is unknown
+func ConvertFiat(amount float64, from, to model.Currency) float64 {
+	if from == to {
+		return amount
+	}
+
+	fromPrice := XMRPriceIn(from)
+	if fromPrice == 0 {
+		return 0
+	}
+	return amount / fromPrice * XMRPriceIn(to)
 }
 
 var XMR2Float = walletrpc.XMRToFloat64
@@ -79,6 +168,27 @@ var XMR2Decimal = walletrpc.XMRToDecimal
 const XMR uint64 = 1e12
 const XMRf float64 = float64(XMR)
 
-func TakeCut(amount uint64) uint64 {
-	return uint64(float64(amount) * 0.95)
+// Amount left after taking a commission given in basis points. The cut is split so that
+// amount*bps can't overflow.
+func TakeCut(amount uint64, commissionBps uint) uint64 {
+	bps := uint64(commissionBps)
+	return amount - (amount/10000*bps + amount%10000*bps/10000)
+}
+
+func FmtFiat(amount float64, currency model.Currency) string {
+	return fmt.Sprintf("%.2f %s", amount, currency.Symbol())
+}
+
+// Price of a listing in its own currency, followed by the converted amount when the display currency differs
+func DisplayPrice(amount int, from, to model.Currency) string {
+	price := fmt.Sprintf("%d %s", amount, from.Symbol())
+	if from == to {
+		return price
+	}
+
+	converted := ConvertFiat(float64(amount), from, to)
+	if converted == 0 {
+		return price
+	}
+	return fmt.Sprintf("%s (≈ %s)", price, FmtFiat(converted, to))
 }
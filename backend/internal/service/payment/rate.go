@@ -0,0 +1,151 @@
+package payment
+
+import (
+	"LuomuTori/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cryptoCompareURL = "https://min-api.cryptocompare.com/data/price?fsym=XMR&tsyms="
+
+// Rate is the price of one XMR in each currency and when it was observed
+type Rate struct {
+	Prices map[model.Currency]float64
+	At     time.Time
+}
+
+type RateProvider interface {
+	Name() string
+	Rate() (Rate, error)
+}
+
+type CryptoCompare struct {
+	URL string
+}
+
+func (c CryptoCompare) Name() string {
+	return "cryptocompare"
+}
+
+func (c CryptoCompare) Rate() (Rate, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(c.URL)
+	if err != nil {
+		return Rate{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Rate{}, fmt.Errorf("Invalid response status: %s\n", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	prices := make(map[model.Currency]float64)
+	if err := json.Unmarshal(body, &prices); err != nil {
+		return Rate{}, err
+	}
+
+	return Rate{Prices: prices, At: time.Now()}, nil
+}
+
+// StaticProvider always returns the same rates. Meant for tests and development.
+type StaticProvider struct {
+	Prices map[model.Currency]float64
+}
+
+func (s StaticProvider) Name() string {
+	return "static"
+}
+
+func (s StaticProvider) Rate() (Rate, error) {
+	return Rate{Prices: s.Prices, At: time.Now()}, nil
+}
+
+// FileProvider reads the rates from a JSON file like {"EUR": 150.25, "USD": 162.1} for deployments without internet access.
+// The rate is as old as the file, so a forgotten file goes stale instead of being used forever.
+type FileProvider struct {
+	Path string
+}
+
+func (f FileProvider) Name() string {
+	return "file"
+}
+
+func (f FileProvider) Rate() (Rate, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	body, err := os.ReadFile(f.Path)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	prices := make(map[model.Currency]float64)
+	if err := json.Unmarshal(body, &prices); err != nil {
+		return Rate{}, err
+	}
+
+	return Rate{Prices: prices, At: info.ModTime()}, nil
+}
+
+// Builds providers from a comma separated list of names: cryptocompare, file and static.
+// Static rates are given like "EUR=150.25,USD=162.1".
+func NewRateProviders(names, file, static string) ([]RateProvider, error) {
+	ps := make([]RateProvider, 0)
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "cryptocompare":
+			symbols := make([]string, 0, len(model.Currencies))
+			for _, c := range model.Currencies {
+				symbols = append(symbols, string(c))
+			}
+			ps = append(ps, CryptoCompare{URL: cryptoCompareURL + strings.Join(symbols, ",")})
+		case "file":
+			ps = append(ps, FileProvider{Path: file})
+		case "static":
+			prices, err := parseStaticRates(static)
+			if err != nil {
+				return nil, err
+			}
+			ps = append(ps, StaticProvider{Prices: prices})
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown rate provider: %s", name)
+		}
+	}
+
+	if len(ps) == 0 {
+		return nil, errors.New("no rate providers configured")
+	}
+	return ps, nil
+}
+
+func parseStaticRates(static string) (map[model.Currency]float64, error) {
+	prices := make(map[model.Currency]float64)
+	for _, pair := range strings.Split(static, ",") {
+		currency, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid static rate: %s", pair)
+		}
+
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static rate: %s", pair)
+		}
+		prices[model.Currency(strings.ToUpper(currency))] = price
+	}
+	return prices, nil
+}
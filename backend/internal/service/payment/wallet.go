@@ -0,0 +1,90 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/moneropay/go-monero/walletrpc"
+	"time"
+)
+
+var (
+	// The backend answered that it refused the transfer, nothing was sent.
+	// Any other error of Transfer leaves it open whether the transfer was made.
+	ErrTransferRejected = errors.New("Transfer rejected")
+	// Comes with ErrTransferRejected when the wallet has too little unlocked XMR for the transfer
+	ErrWalletOutOfFunds = errors.New("Not enough unlocked funds in the wallet")
+)
+
+// Codes of monero-wallet-rpc errors after which the transfer surely wasn't made
+var refusalCodes = map[int]error{
+	-2:  nil,                 // WRONG_ADDRESS
+	-16: nil,                 // TX_NOT_POSSIBLE
+	-17: ErrWalletOutOfFunds, // NOT_ENOUGH_MONEY
+	-18: nil,                 // TX_TOO_LARGE
+	-19: nil,                 // NOT_ENOUGH_OUTS_TO_MIX
+	-20: nil,                 // ZERO_DESTINATION
+	-37: ErrWalletOutOfFunds, // NOT_ENOUGH_UNLOCKED_MONEY
+}
+
+// Wraps err of a transfer the wallet refused with the code
+func transferRefused(code int, err error) error {
+	if reason := refusalCodes[code]; reason != nil {
+		return fmt.Errorf("%w: %w: %v", ErrTransferRejected, reason, err)
+	}
+	return fmt.Errorf("%w: %v", ErrTransferRejected, err)
+}
+
+// Holds the XMR of the store. Deposits come to addresses of the backend and withdrawals are paid
+// from it, so everything that moves XMR in or out of the store goes through it.
+type WalletBackend interface {
+	// New address for the deposits of the user. Callbacks about it carry the invoice id.
+	NewDepositAddress(userID, invoiceID uuid.UUID) (string, error)
+	// Transactions received to a deposit address
+	Received(address string) (*Received, error)
+	// Pays to the destinations. Calls with the same idempotency key are retries of the same payout,
+	// which was requested at since.
+	Transfer(destinations []walletrpc.Destination, idempotencyKey uuid.UUID, since time.Time) (*Transfer, error)
+	// State of a payout made by Transfer
+	TransferStatus(txHash string) (*TransferStatus, error)
+	// Whether Transfer with the key of an earlier payout returns that payout instead of paying again
+	IdempotentTransfers() bool
+}
+
+// Builds the backend named by the wallet-backend flag: moneropay or wallet-rpc
+func NewWalletBackend(name, moneropayURL, callbackAddr, walletRPCURL string) (WalletBackend, error) {
+	switch name {
+	case "moneropay":
+		return NewMoneropay(moneropayURL, callbackAddr), nil
+	case "wallet-rpc":
+		return NewWalletRPC(walletRPCURL), nil
+	default:
+		return nil, fmt.Errorf("unknown wallet backend: %s", name)
+	}
+}
+
+type Received struct {
+	// Total includes locked transactions
+	Total        uint64
+	Unlocked     uint64
+	Transactions []Incoming
+}
+
+// Locked transactions can't be spent yet and are not credited
+type Incoming struct {
+	TxHash        string
+	Amount        uint64
+	Confirmations uint64
+	Locked        bool
+}
+
+// A transfer split into several transactions is followed by the first one, TxHash
+type Transfer struct {
+	TxHash     string
+	TxHashList []string
+}
+
+type TransferStatus struct {
+	Failed        bool
+	Confirmations uint64
+}
@@ -0,0 +1,397 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/moneropay/go-monero/pkg/json2"
+	"gitlab.com/moneropay/go-monero/walletrpc"
+	moneropay "gitlab.com/moneropay/moneropay/v2/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFakeWalletDeposits(t *testing.T) {
+	var wb WalletBackend = NewFakeWallet()
+	fake := wb.(*FakeWallet)
+
+	address, err := wb.NewDepositAddress(uuid.New(), uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(address) != 95 {
+		t.Fatalf("Address should look like a monero address, got %d characters\n", len(address))
+	}
+
+	first, _ := fake.Deposit(address, 5)
+	second, _ := fake.Deposit(address, 7)
+
+	received, err := wb.Received(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Total != 12 || received.Unlocked != 0 || len(received.Transactions) != 2 {
+		t.Fatalf("Expected two locked deposits of 12 in total, got %+v\n", received)
+	}
+
+	fake.Confirm(DepositConfirmations - 1)
+	if err := fake.Unlock(second); err != nil {
+		t.Fatal(err)
+	}
+	received, _ = wb.Received(address)
+	if received.Unlocked != 7 {
+		t.Fatalf("Only the unlocked deposit should count, got %d\n", received.Unlocked)
+	}
+
+	fake.Confirm(1)
+	received, _ = wb.Received(address)
+	if received.Unlocked != received.Total {
+		t.Fatalf("Deposits should unlock at %d confirmations, got %+v\n", DepositConfirmations, received)
+	}
+	if received.Transactions[0].TxHash != first || received.Transactions[0].Confirmations != DepositConfirmations {
+		t.Fatalf("Unexpected first deposit %+v\n", received.Transactions[0])
+	}
+
+	if _, err := wb.Received("4unknown"); !errors.Is(err, ErrFakeUnknown) {
+		t.Fatalf("Expected ErrFakeUnknown, got %v\n", err)
+	}
+}
+
+func TestFakeWalletTransfers(t *testing.T) {
+	var wb WalletBackend = NewFakeWallet()
+	fake := wb.(*FakeWallet)
+	dsts := []walletrpc.Destination{{Amount: 3, Address: strings.Repeat("4", 95)}}
+	key := uuid.New()
+
+	fake.RejectTransfers = true
+	if _, err := wb.Transfer(dsts, key, time.Now()); !errors.Is(err, ErrTransferRejected) {
+		t.Fatalf("Expected ErrTransferRejected, got %v\n", err)
+	}
+	fake.RejectTransfers = false
+
+	sent, err := wb.Transfer(dsts, key, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wb.IdempotentTransfers() {
+		t.Fatalf("Fake should pay retries again by default, like moneropay\n")
+	}
+	if again, _ := wb.Transfer(dsts, key, time.Now()); again == nil || again.TxHash == sent.TxHash || len(fake.Payouts()) != 2 {
+		t.Fatalf("Retry should pay again, got %d payouts\n", len(fake.Payouts()))
+	}
+
+	fake.Idempotent = true
+	retry, err := wb.Transfer(dsts, key, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.TxHash != sent.TxHash || len(fake.Payouts()) != 2 {
+		t.Fatalf("Retry with the same key should not pay again, got %d payouts\n", len(fake.Payouts()))
+	}
+
+	fake.Confirm(4)
+	status, err := wb.TransferStatus(sent.TxHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Failed || status.Confirmations != 4 {
+		t.Fatalf("Expected 4 confirmations, got %+v\n", status)
+	}
+
+	if err := fake.FailTransfer(sent.TxHash); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := wb.TransferStatus(sent.TxHash); !status.Failed {
+		t.Fatalf("Transfer should have failed\n")
+	}
+
+	fake.Unreachable = true
+	if _, err := wb.Transfer(dsts, uuid.New(), time.Now()); !errors.Is(err, ErrFakeUnreachable) || errors.Is(err, ErrTransferRejected) {
+		t.Fatalf("Unreachable wallet should not look like a rejection, got %v\n", err)
+	}
+}
+
+func TestMoneropayTransfer(t *testing.T) {
+	key := uuid.New()
+	var failure *moneropay.ErrorResponse
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/transfer" || r.Header.Get("Idempotency-Key") != key.String() {
+			t.Errorf("Unexpected request %s %s with key %q\n", r.Method, r.URL.Path, r.Header.Get("Idempotency-Key"))
+		}
+		if failure != nil {
+			w.WriteHeader(failure.Status)
+			json.NewEncoder(w).Encode(failure)
+			return
+		}
+		json.NewEncoder(w).Encode(moneropay.TransferPostResponse{TxHash: "abc", TxHashList: []string{"abc", "def"}})
+	}))
+	defer srv.Close()
+
+	mp := NewMoneropay(srv.URL, "localhost:4420")
+	dsts := []walletrpc.Destination{{Amount: 3, Address: strings.Repeat("4", 95)}}
+
+	transfer, err := mp.Transfer(dsts, key, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.TxHash != "abc" || len(transfer.TxHashList) != 2 {
+		t.Fatalf("Unexpected transfer %+v\n", transfer)
+	}
+
+	code := -17
+	failure = &moneropay.ErrorResponse{Status: http.StatusInternalServerError, Code: &code, Message: "not enough money"}
+	if _, err := mp.Transfer(dsts, key, time.Now()); !errors.Is(err, ErrTransferRejected) || !errors.Is(err, ErrWalletOutOfFunds) {
+		t.Fatalf("Wallet without funds should be a rejection, got %v\n", err)
+	}
+
+	code = -2
+	if _, err := mp.Transfer(dsts, key, time.Now()); !errors.Is(err, ErrTransferRejected) || errors.Is(err, ErrWalletOutOfFunds) {
+		t.Fatalf("Wrong address should be a rejection, got %v\n", err)
+	}
+
+	// The wallet may have relayed the transaction before losing the daemon
+	code = -38
+	if _, err := mp.Transfer(dsts, key, time.Now()); err == nil || errors.Is(err, ErrTransferRejected) {
+		t.Fatalf("Lost daemon connection should not look like a rejection, got %v\n", err)
+	}
+
+	failure = &moneropay.ErrorResponse{Status: http.StatusGatewayTimeout, Message: "context deadline exceeded"}
+	if _, err := mp.Transfer(dsts, key, time.Now()); err == nil || errors.Is(err, ErrTransferRejected) {
+		t.Fatalf("Timeout should not look like a rejection, got %v\n", err)
+	}
+
+	srv.Close()
+	if _, err := mp.Transfer(dsts, key, time.Now()); err == nil || errors.Is(err, ErrTransferRejected) {
+		t.Fatalf("Unreachable moneropay should not look like a rejection, got %v\n", err)
+	}
+}
+
+func TestMoneropayReceived(t *testing.T) {
+	address := strings.Repeat("8", 95)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/receive/"+address {
+			http.NotFound(w, r)
+			return
+		}
+		var data moneropay.ReceiveGetResponse
+		data.Amount.Covered.Total = 12
+		data.Amount.Covered.Unlocked = 5
+		data.Transactions = []moneropay.TransactionData{
+			{TxHash: "a", Amount: 5, Confirmations: 11},
+			{TxHash: "b", Amount: 7, Confirmations: 2, Locked: true},
+		}
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer srv.Close()
+
+	received, err := NewMoneropay(srv.URL, "localhost:4420").Received(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Total != 12 || received.Unlocked != 5 || len(received.Transactions) != 2 {
+		t.Fatalf("Unexpected response %+v\n", received)
+	}
+	if b := received.Transactions[1]; b.TxHash != "b" || !b.Locked || b.Confirmations != 2 {
+		t.Fatalf("Unexpected transaction %+v\n", b)
+	}
+
+	if _, err := NewMoneropay(srv.URL, "localhost:4420").Received("4other"); err == nil {
+		t.Fatalf("Unknown address should fail\n")
+	}
+}
+
+// JSON-RPC server answering each method with its handler, nil result for unknown methods
+func walletRPCStub(t *testing.T, handlers map[string]func(params json.RawMessage) (any, *json2.Error)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Invalid request: %v\n", err)
+			return
+		}
+
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		if handle, ok := handlers[req.Method]; !ok {
+			t.Errorf("Unexpected method %s\n", req.Method)
+			resp["error"] = json2.Error{Code: json2.E_NO_METHOD, Message: "Method not found"}
+		} else if result, rpcErr := handle(req.Params); rpcErr != nil {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestWalletRPCReceived(t *testing.T) {
+	address := strings.Repeat("8", 95)
+
+	srv := walletRPCStub(t, map[string]func(json.RawMessage) (any, *json2.Error){
+		"create_address": func(json.RawMessage) (any, *json2.Error) {
+			return walletrpc.CreateAddressResponse{Address: address, AddressIndex: 3}, nil
+		},
+		"get_address_index": func(params json.RawMessage) (any, *json2.Error) {
+			if !strings.Contains(string(params), address) {
+				return nil, &json2.Error{Code: -2, Message: "Address doesn't belong to the wallet"}
+			}
+			return walletrpc.GetAddressIndexResponse{Index: walletrpc.SubaddressIndex{Major: 0, Minor: 3}}, nil
+		},
+		"get_transfers": func(params json.RawMessage) (any, *json2.Error) {
+			var req walletrpc.GetTransfersRequest
+			json.Unmarshal(params, &req)
+			if !req.In || !req.Pool || len(req.SubaddrIndices) != 1 || req.SubaddrIndices[0] != 3 {
+				t.Errorf("Unexpected get_transfers %s\n", params)
+			}
+			return walletrpc.GetTransfersResponse{
+				In: []walletrpc.Transfer{
+					{Txid: "a", Amount: 5, Confirmations: 11, Height: 100},
+					{Txid: "b", Amount: 7, Confirmations: 2, Height: 109},
+					{Txid: "c", Amount: 1, Confirmations: 12, Height: 99, UnlockTime: 200},
+					{Txid: "a", Amount: 2, Confirmations: 11, Height: 100},
+				},
+				Pool: []walletrpc.Transfer{{Txid: "d", Amount: 4}},
+			}, nil
+		},
+	})
+	defer srv.Close()
+
+	wb := NewWalletRPC(srv.URL)
+	if got, err := wb.NewDepositAddress(uuid.New(), uuid.New()); err != nil || got != address {
+		t.Fatalf("Expected the new subaddress, got %q %v\n", got, err)
+	}
+
+	received, err := wb.Received(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received.Total != 19 || received.Unlocked != 7 || len(received.Transactions) != 4 {
+		t.Fatalf("Unexpected response %+v\n", received)
+	}
+	if a := received.Transactions[0]; a.TxHash != "a" || a.Amount != 7 || a.Locked {
+		t.Fatalf("Outputs of a transaction should be one unlocked deposit, got %+v\n", a)
+	}
+	if b := received.Transactions[1]; !b.Locked || b.Confirmations != 2 {
+		t.Fatalf("Unconfirmed deposit should be locked, got %+v\n", b)
+	}
+	if c := received.Transactions[2]; !c.Locked {
+		t.Fatalf("Deposit before its unlock time should be locked, got %+v\n", c)
+	}
+	if d := received.Transactions[3]; d.TxHash != "d" || !d.Locked {
+		t.Fatalf("Deposit in the pool should be locked, got %+v\n", d)
+	}
+
+	if _, err := wb.Received("4other"); err == nil {
+		t.Fatalf("Unknown address should fail\n")
+	}
+}
+
+func TestWalletRPCTransfer(t *testing.T) {
+	var (
+		notes   = make(map[string]string)
+		relayed []string
+		reject  bool
+		n       int
+	)
+
+	srv := walletRPCStub(t, map[string]func(json.RawMessage) (any, *json2.Error){
+		"get_height": func(json.RawMessage) (any, *json2.Error) {
+			return walletrpc.GetHeightResponse{Height: 1000}, nil
+		},
+		"get_transfers": func(params json.RawMessage) (any, *json2.Error) {
+			// An hour ago is at most 61 blocks back
+			var req walletrpc.GetTransfersRequest
+			json.Unmarshal(params, &req)
+			if !req.FilterByHeight || req.MinHeight != 939 {
+				t.Errorf("Only the blocks since the withdrawal should be searched, got %s\n", params)
+			}
+
+			var resp walletrpc.GetTransfersResponse
+			for _, hash := range relayed {
+				resp.Pending = append(resp.Pending, walletrpc.Transfer{Txid: hash, Note: notes[hash]})
+			}
+			return resp, nil
+		},
+		"transfer": func(params json.RawMessage) (any, *json2.Error) {
+			var req walletrpc.TransferRequest
+			json.Unmarshal(params, &req)
+			if !req.DoNotRelay || !req.GetTxMetadata {
+				t.Errorf("Transfer should be relayed only after its note is set, got %s\n", params)
+			}
+			if reject {
+				return nil, &json2.Error{Code: -37, Message: "not enough unlocked money"}
+			}
+			n++
+			hash := fmt.Sprintf("%064x", n)
+			return walletrpc.TransferResponse{TxHash: hash, TxMetadata: "meta" + hash}, nil
+		},
+		"set_tx_notes": func(params json.RawMessage) (any, *json2.Error) {
+			var req walletrpc.SetTxNotesRequest
+			json.Unmarshal(params, &req)
+			notes[req.Txids[0]] = req.Notes[0]
+			return struct{}{}, nil
+		},
+		"relay_tx": func(params json.RawMessage) (any, *json2.Error) {
+			var req walletrpc.RelayTxRequest
+			json.Unmarshal(params, &req)
+			hash := strings.TrimPrefix(req.Hex, "meta")
+			relayed = append(relayed, hash)
+			return walletrpc.RelayTxResponse{TxHash: hash}, nil
+		},
+		"get_transfer_by_txid": func(params json.RawMessage) (any, *json2.Error) {
+			var req walletrpc.GetTransferByTxidRequest
+			json.Unmarshal(params, &req)
+			return walletrpc.GetTransferByTxidResponse{
+				Transfer: walletrpc.TransferByTxid{Txid: req.Txid, Type: "failed"},
+			}, nil
+		},
+	})
+	defer srv.Close()
+
+	wb := NewWalletRPC(srv.URL)
+	dsts := []walletrpc.Destination{{Amount: 3, Address: strings.Repeat("4", 95)}}
+	key := uuid.New()
+	since := time.Now().Add(-time.Hour)
+
+	reject = true
+	if _, err := wb.Transfer(dsts, key, since); !errors.Is(err, ErrTransferRejected) || !errors.Is(err, ErrWalletOutOfFunds) {
+		t.Fatalf("Refused transfer should be a rejection, got %v\n", err)
+	}
+	reject = false
+
+	sent, err := wb.Transfer(dsts, key, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry, err := wb.Transfer(dsts, key, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.TxHash != sent.TxHash || len(relayed) != 1 {
+		t.Fatalf("Retry with the same key should not pay again, got %d payouts\n", len(relayed))
+	}
+	if other, _ := wb.Transfer(dsts, uuid.New(), since); other == nil || other.TxHash == sent.TxHash {
+		t.Fatalf("Another key should pay again, got %+v\n", other)
+	}
+
+	status, err := wb.TransferStatus(sent.TxHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Failed {
+		t.Fatalf("Transfer should have failed, got %+v\n", status)
+	}
+
+	srv.Close()
+	if _, err := wb.TransferStatus(sent.TxHash); err == nil {
+		t.Fatalf("Unreachable wallet should fail\n")
+	}
+}
@@ -0,0 +1,210 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gitlab.com/moneropay/go-monero/pkg/json2"
+	"gitlab.com/moneropay/go-monero/walletrpc"
+	"time"
+)
+
+// Unlock times below this are block heights, the rest are unix timestamps
+const unlockTimeIsTimestamp = 500000000
+
+// Monero aims for a block every two minutes. Heights of past times are estimated with half of
+// that, so that a run of fast blocks doesn't put a transfer below the estimate.
+const minBlockTime = time.Minute
+
+// WalletBackend talking to monero-wallet-rpc directly. Every deposit address is a subaddress of
+// the account and deposits are found by polling, the wallet makes no callbacks. Run the wallet
+// with --disable-rpc-login, the client doesn't do digest authentication.
+type WalletRPC struct {
+	Client       *walletrpc.Client
+	AccountIndex uint64
+}
+
+func NewWalletRPC(url string) *WalletRPC {
+	return &WalletRPC{
+		Client: walletrpc.New(walletrpc.Config{Address: url}),
+	}
+}
+
+// The wallet makes no callbacks, so the invoice id goes unused
+func (w *WalletRPC) NewDepositAddress(userID, invoiceID uuid.UUID) (string, error) {
+	resp, err := w.Client.CreateAddress(context.Background(), &walletrpc.CreateAddressRequest{
+		AccountIndex: w.AccountIndex,
+		Label:        "deposit " + userID.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Address, nil
+}
+
+func (w *WalletRPC) Received(address string) (*Received, error) {
+	ctx := context.Background()
+
+	index, err := w.Client.GetAddressIndex(ctx, &walletrpc.GetAddressIndexRequest{Address: address})
+	if err != nil {
+		return nil, err
+	}
+	if index.Index.Major != w.AccountIndex {
+		return nil, fmt.Errorf("address %s belongs to account %d", address, index.Index.Major)
+	}
+
+	resp, err := w.Client.GetTransfers(ctx, &walletrpc.GetTransfersRequest{
+		In:             true,
+		Pool:           true,
+		AccountIndex:   w.AccountIndex,
+		SubaddrIndices: []uint64{index.Index.Minor},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	received := &Received{Transactions: make([]Incoming, 0, len(resp.In)+len(resp.Pool))}
+	for _, t := range append(resp.In, resp.Pool...) {
+		received.Total += t.Amount
+		in := Incoming{
+			TxHash:        t.Txid,
+			Amount:        t.Amount,
+			Confirmations: t.Confirmations,
+			Locked:        locked(t),
+		}
+		if !in.Locked {
+			received.Unlocked += t.Amount
+		}
+
+		// Several outputs of a transaction to the same address are one deposit
+		merged := false
+		for i := range received.Transactions {
+			if received.Transactions[i].TxHash == in.TxHash {
+				received.Transactions[i].Amount += in.Amount
+				received.Transactions[i].Locked = received.Transactions[i].Locked || in.Locked
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			received.Transactions = append(received.Transactions, in)
+		}
+	}
+
+	return received, nil
+}
+
+// Wallet-rpc has no idempotency keys, so the key is kept in the note of the transaction. The
+// transaction is created unrelayed and relayed only after the note is set, so a retry finds every
+// payout that may have reached the network. Errors before the relay mean nothing was sent.
+func (w *WalletRPC) Transfer(destinations []walletrpc.Destination, idempotencyKey uuid.UUID, since time.Time) (*Transfer, error) {
+	ctx := context.Background()
+	note := transferNote(idempotencyKey)
+
+	earlier, err := w.findTransfer(ctx, note, since)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransferRejected, err)
+	}
+	if earlier != nil {
+		return earlier, nil
+	}
+
+	resp, err := w.Client.Transfer(ctx, &walletrpc.TransferRequest{
+		Destinations:  destinations,
+		AccountIndex:  w.AccountIndex,
+		Priority:      walletrpc.PriorityDefault,
+		DoNotRelay:    true,
+		GetTxMetadata: true,
+	})
+	if err != nil {
+		var rpcErr *json2.Error
+		if errors.As(err, &rpcErr) {
+			return nil, transferRefused(int(rpcErr.Code), err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrTransferRejected, err)
+	}
+
+	err = w.Client.SetTxNotes(ctx, &walletrpc.SetTxNotesRequest{Txids: []string{resp.TxHash}, Notes: []string{note}})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTransferRejected, err)
+	}
+
+	if _, err := w.Client.RelayTx(ctx, &walletrpc.RelayTxRequest{Hex: resp.TxMetadata}); err != nil {
+		if errors.As(err, new(*json2.Error)) {
+			return nil, fmt.Errorf("%w: %v", ErrTransferRejected, err)
+		}
+		return nil, err
+	}
+
+	return &Transfer{TxHash: resp.TxHash, TxHashList: []string{resp.TxHash}}, nil
+}
+
+func (w *WalletRPC) IdempotentTransfers() bool {
+	return true
+}
+
+func (w *WalletRPC) TransferStatus(txHash string) (*TransferStatus, error) {
+	resp, err := w.Client.GetTransferByTxid(context.Background(), &walletrpc.GetTransferByTxidRequest{
+		Txid:         txHash,
+		AccountIndex: w.AccountIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TransferStatus{Failed: resp.Transfer.Type == "failed", Confirmations: resp.Transfer.Confirmations}, nil
+}
+
+// Outgoing transaction with the note made after since, nil if there is none. Only the blocks
+// since then are looked at, the history of the wallet only grows.
+func (w *WalletRPC) findTransfer(ctx context.Context, note string, since time.Time) (*Transfer, error) {
+	height, err := w.Client.GetHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var minHeight uint64
+	if blocks := uint64(time.Since(since)/minBlockTime) + 1; blocks < height.Height {
+		minHeight = height.Height - blocks
+	}
+
+	resp, err := w.Client.GetTransfers(ctx, &walletrpc.GetTransfersRequest{
+		Out:            true,
+		Pending:        true,
+		Failed:         true,
+		AccountIndex:   w.AccountIndex,
+		FilterByHeight: true,
+		MinHeight:      minHeight,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ts := range [][]walletrpc.Transfer{resp.Out, resp.Pending, resp.Failed} {
+		for _, t := range ts {
+			if t.Note == note {
+				return &Transfer{TxHash: t.Txid, TxHashList: []string{t.Txid}}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func transferNote(idempotencyKey uuid.UUID) string {
+	return "withdrawal " + idempotencyKey.String()
+}
+
+// Same rule as moneropay: spendable after DepositConfirmations unless the sender set a later unlock time
+func locked(t walletrpc.Transfer) bool {
+	if t.Confirmations < DepositConfirmations {
+		return true
+	}
+	if t.UnlockTime >= unlockTimeIsTimestamp {
+		return uint64(time.Now().Unix()) < t.UnlockTime
+	}
+	// Height of the chain is that of the block with the transaction plus the blocks on top of it
+	return t.Height+t.Confirmations < t.UnlockTime
+}
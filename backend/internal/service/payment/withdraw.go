@@ -1,26 +1,57 @@
 package payment
 
 import (
+	mydb "LuomuTori/internal/db"
 	"LuomuTori/internal/log"
 	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/fee"
+	"LuomuTori/internal/service/ledger"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"gitlab.com/moneropay/go-monero/walletrpc"
-	"time"
+	"regexp"
 )
 
 var (
 	ErrNotEnoughBalanceToWithdraw = errors.New("Not enough balance to withdraw")
+	ErrFundsFrozen                = errors.New("Funds are frozen")
+	ErrWithdrawalNotUnknown       = errors.New("Withdrawal is not waiting to be resolved")
+	ErrInvalidTxHash              = errors.New("Invalid transaction hash")
+	ErrTxFailed                   = errors.New("Transaction failed, resolve without a hash to send it again")
 )
 
+// Confirmations after which a withdrawal is final
+const withdrawalConfirmations = 10
+
+var txHashRx = regexp.MustCompile("^[0-9a-f]{64}$")
+
 func WithdrawFunds(db *sql.DB, userID uuid.UUID, destinationAddress string, amount uint64) (uint64, error) {
+	if err := CheckRate(model.CurrencyEUR); err != nil {
+		return 0, err
+	}
+
+	frozen, err := model.M.Ban.FundsFrozen(db, userID)
+	if err != nil {
+		return 0, err
+	}
+	if frozen {
+		return 0, ErrFundsFrozen
+	}
+
 	wallet, err := model.M.Wallet.GetForUser(db, userID)
 	if err != nil {
 		return 0, err
 	}
 
-	minAmount := Fiat2XMR(10)
+	schedule, err := fee.Current(db)
+	if err != nil {
+		return 0, err
+	}
+
+	ourFee := Fiat2XMR(float64(schedule.WithdrawalFee))
+	minAmount := Fiat2XMR(float64(schedule.WithdrawalMin))
 	if amount < minAmount || wallet.Balance < amount {
 		return 0, ErrNotEnoughBalanceToWithdraw
 	}
@@ -31,13 +62,18 @@ func WithdrawFunds(db *sql.DB, userID uuid.UUID, destinationAddress string, amou
 	}
 	defer tx.Rollback()
 
-	_, err = model.M.Wallet.ReduceBalance(tx, wallet.ID, amount)
+	withdrawal, err := model.M.Withdrawal.Create(tx, userID, destinationAddress, amount-ourFee, model.WithdrawalPending)
 	if err != nil {
 		return 0, err
 	}
 
-	ourFee := Fiat2XMR(1)
-	if _, err := model.M.Withdrawal.Create(tx, destinationAddress, amount-ourFee, model.WithdrawalPending); err != nil {
+	err = ledger.Transfer(tx, model.LedgerWithdrawal, withdrawal.ID, ledger.User(userID),
+		ledger.To(ledger.Withdrawals, amount-ourFee),
+		ledger.To(ledger.Fees, ourFee))
+	if err != nil {
+		if errors.Is(err, ledger.ErrNotEnoughBalance) {
+			return 0, ErrNotEnoughBalanceToWithdraw
+		}
 		return 0, err
 	}
 
@@ -48,135 +84,189 @@ func WithdrawFunds(db *sql.DB, userID uuid.UUID, destinationAddress string, amou
 	return amount, nil
 }
 
-func HandleWithdrawals(db *sql.DB) error {
-	if err := transferWithdrawals(db); err != nil {
+func HandleWithdrawals(db *sql.DB, wb WalletBackend) error {
+	if err := transferWithdrawals(db, wb); err != nil {
 		return err
 	}
 
-	if err := handleTransactions(db); err != nil {
+	if err := refreshWithdrawals(db, wb); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func transferWithdrawals(db *sql.DB) error {
-	ws, err := model.M.Withdrawal.GetAllWithStatus(db, model.WithdrawalPending)
+// Resolves withdrawals left processing by a crash in the middle of a transfer. Run it on startup
+// before the withdrawals job. When the backend finds transfers by their idempotency key, they are
+// just queued again with the same key. Otherwise a withdrawal without a tx hash can't be told apart
+// from one that was never sent, so those are marked unknown for staff instead of being sent again.
+func RecoverWithdrawals(db *sql.DB, wb WalletBackend) error {
+	ws, err := model.M.Withdrawal.GetAllWithStatus(db, model.WithdrawalProcessing)
 	if err != nil {
 		return err
 	}
-	if len(ws) == 0 {
-		return nil
-	}
 
-	dsts := []walletrpc.Destination{}
 	for _, w := range ws {
-		dsts = append(dsts, walletrpc.Destination{
-			Amount:  w.Amount,
-			Address: w.DestAddress,
-		})
-	}
-
-	// Set withdrawal statuses to processing
-	{
-		tx, err := db.Begin()
-		if err != nil {
-			return err
-		}
-		defer tx.Rollback()
-
-		for _, w := range ws {
-			if _, err := model.M.Withdrawal.UpdateStatus(tx, w.ID, model.WithdrawalProcessing); err != nil {
+		if wb.IdempotentTransfers() {
+			log.Info.Printf("Transfer of withdrawal %s was interrupted, retrying with the same key\n", w.ID)
+			if _, err := model.M.Withdrawal.UpdateStatus(db, w.ID, model.WithdrawalProcessing, model.WithdrawalPending); err != nil {
 				return err
 			}
+			continue
 		}
 
-		if err := tx.Commit(); err != nil {
+		log.Error.Printf("Transfer of withdrawal %s was interrupted. Check the wallet for a transfer of %s XMR to %s and resolve it.\n",
+			w.ID, XMR2Decimal(w.Amount), w.DestAddress)
+
+		if _, err := model.M.Withdrawal.UpdateStatus(db, w.ID, model.WithdrawalProcessing, model.WithdrawalUnknown); err != nil {
 			return err
 		}
 	}
 
-	// Make transaction
-	data, err := moneropayTransferPost(dsts)
-	if err != nil {
-		return err
-	}
+	return refreshWithdrawals(db, wb)
+}
 
-	tx, err := db.Begin()
+// Sends each pending withdrawal in a transfer of its own. A wallet out of funds would refuse the rest
+// too and an unreachable one would fail them, so the run stops there. Other refusals concern only the
+// withdrawal and are left for staff.
+func transferWithdrawals(db *sql.DB, wb WalletBackend) error {
+	ws, err := model.M.Withdrawal.GetAllWithStatus(db, model.WithdrawalPending)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
 	for _, w := range ws {
-		if err := model.M.Withdrawal.Delete(tx, w.ID); err != nil {
-			log.Error.Printf("Failed to delete withdrawal. ID: %s\n", w.ID)
+		err := transferWithdrawal(db, wb, w)
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrWalletOutOfFunds):
+			log.Error.Printf("Transfer of withdrawal %s was rejected, retrying on the next run: %s\n", w.ID, err.Error())
+			return nil
+		case errors.Is(err, ErrTransferRejected):
+			log.Error.Printf("Transfer of withdrawal %s was rejected, resolve it: %s\n", w.ID, err.Error())
+		default:
 			return err
 		}
 	}
 
-	for _, hash := range data.TxHashList {
-		if _, err := model.M.Transaction.Create(tx, hash); err != nil {
-			log.Error.Printf("Failed to create transaction. TxHash: %s\n", hash)
+	return nil
+}
+
+// The withdrawal is processing during the transfer call, so a crash before the tx hash is saved
+// leaves it for RecoverWithdrawals instead of sending it again on the next run. A failed call
+// settles it right away: it's sent again when nothing was sent or the backend can tell a retry
+// apart, otherwise staff resolves it.
+func transferWithdrawal(db *sql.DB, wb WalletBackend, w model.Withdrawal) error {
+	claimed, err := model.M.Withdrawal.UpdateStatus(db, w.ID, model.WithdrawalPending, model.WithdrawalProcessing)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	dsts := []walletrpc.Destination{{
+		Amount:  w.Amount,
+		Address: w.DestAddress,
+	}}
+
+	data, err := wb.Transfer(dsts, w.IdempotencyKey, w.CreatedAt)
+	if err != nil {
+		next := model.WithdrawalUnknown
+		if errors.Is(err, ErrWalletOutOfFunds) || !errors.Is(err, ErrTransferRejected) && wb.IdempotentTransfers() {
+			next = model.WithdrawalPending
+		} else if !errors.Is(err, ErrTransferRejected) {
+			log.Error.Printf("Transfer of withdrawal %s failed. Check the wallet for a transfer of %s XMR to %s and resolve it.\n",
+				w.ID, XMR2Decimal(w.Amount), w.DestAddress)
+		}
+
+		if _, err := model.M.Withdrawal.UpdateStatus(db, w.ID, model.WithdrawalProcessing, next); err != nil {
 			return err
 		}
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
+	// A transfer split into several transactions is followed by its first one
+	if err := model.M.Withdrawal.SetSent(db, w.ID, data.TxHash); err != nil {
+		log.Error.Printf("Failed to save withdrawal %s as sent. TxHashes: %v\n", w.ID, data.TxHashList)
 		return err
 	}
 
+	log.Info.Printf("Withdrawal %s sent in tx %s\n", w.ID, data.TxHash)
 	return nil
 }
 
-// Deletes confirmed transactions and redos failed transactions
-func handleTransactions(db *sql.DB) error {
-	threshold := time.Now().Add(-time.Minute * 10)
-	txs, err := model.M.Transaction.GetAllAfter(db, threshold)
+// Updates the confirmations of sent withdrawals and queues failed transfers again. A withdrawal
+// the backend can't tell about is left as it is for the next run.
+func refreshWithdrawals(db *sql.DB, wb WalletBackend) error {
+	ws, err := model.M.Withdrawal.GetAllWithStatus(db, model.WithdrawalSent)
 	if err != nil {
 		return err
 	}
 
-	for _, tx := range txs {
-		data, err := moneropayTransferGet(tx.Hash)
+	for _, w := range ws {
+		status, err := wb.TransferStatus(w.TxHash)
 		if err != nil {
-			return err
+			log.Error.Printf("Failed to get the status of tx %s of withdrawal %s: %s\n", w.TxHash, w.ID, err.Error())
+			continue
 		}
 
-		if data.Confirmations >= 10 {
-			log.Info.Printf("tx %s succeeded\n", data.TxHash)
-			if err := model.M.Transaction.Delete(db, tx.ID); err != nil {
+		if status.Failed {
+			log.Error.Printf("tx %s of withdrawal %s failed, retrying\n", w.TxHash, w.ID)
+			if err := model.M.Withdrawal.Requeue(db, w.ID); err != nil {
 				return err
 			}
-		} else if data.State == "failed" {
-			log.Error.Printf("tx %s failed\n", data.TxHash)
+			continue
+		}
 
-			if err := model.M.Transaction.Delete(db, tx.ID); err != nil {
-				return err
-			}
+		next := model.WithdrawalSent
+		if status.Confirmations >= withdrawalConfirmations {
+			log.Info.Printf("tx %s of withdrawal %s succeeded\n", w.TxHash, w.ID)
+			next = model.WithdrawalConfirmed
+		}
 
-			resp, err := moneropayTransferPost(data.Destinations)
-			if err != nil {
-				return err
-			}
+		if err := model.M.Withdrawal.SetConfirmations(db, w.ID, next, status.Confirmations); err != nil {
+			return err
+		}
+	}
 
-			dbtx, err := db.Begin()
-			if err != nil {
-				return err
-			}
-			defer dbtx.Rollback()
+	return nil
+}
 
-			for _, txHash := range resp.TxHashList {
-				if _, err := model.M.Transaction.Create(dbtx, txHash); err != nil {
-					return err
-				}
-			}
+// Settles a withdrawal of unknown outcome after staff checked the wallet. With the hash of the
+// transfer it's followed as sent, without one it's queued to be transferred again. The backend
+// must know the transfer, a mistyped hash would leave the withdrawal sent forever.
+// Call this inside a database transaction.
+func ResolveWithdrawal(tx mydb.ExecContext, wb WalletBackend, id uuid.UUID, txHash string) (*model.Withdrawal, error) {
+	w, err := model.M.Withdrawal.Get(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if w.Status != model.WithdrawalUnknown {
+		return nil, ErrWithdrawalNotUnknown
+	}
 
-			if err := dbtx.Commit(); err != nil {
-				return err
-			}
+	if txHash == "" {
+		if err := model.M.Withdrawal.Requeue(tx, id); err != nil {
+			return nil, err
 		}
+		return model.M.Withdrawal.Get(tx, id)
 	}
 
-	return nil
+	if !txHashRx.MatchString(txHash) {
+		return nil, ErrInvalidTxHash
+	}
+	status, err := wb.TransferStatus(txHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTxHash, err)
+	}
+	if status.Failed {
+		return nil, ErrTxFailed
+	}
+
+	if err := model.M.Withdrawal.SetSent(tx, id, txHash); err != nil {
+		return nil, err
+	}
+
+	return model.M.Withdrawal.Get(tx, id)
 }
@@ -0,0 +1,164 @@
+package payment
+
+import (
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/ledger"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"gitlab.com/moneropay/go-monero/walletrpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Withdraws from a user with enough balance and returns the withdrawal
+func testWithdrawal(t *testing.T, db *sql.DB, wb WalletBackend, amount uint64) *model.Withdrawal {
+	w := testWallet(t, db, wb)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := ledger.Transfer(tx, model.LedgerDeposit, uuid.New(), ledger.Deposits, ledger.To(ledger.User(w.UserID), amount)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WithdrawFunds(db, w.UserID, strings.Repeat("4", 95), amount); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := model.M.Withdrawal.GetAllForUser(db, w.UserID)
+	if err != nil || len(ws) != 1 {
+		t.Fatalf("Expected a withdrawal, got %v %v\n", ws, err)
+	}
+	return &ws[0]
+}
+
+func withdrawalStatus(t *testing.T, db *sql.DB, id uuid.UUID) model.WithdrawalStatus {
+	w, err := model.M.Withdrawal.Get(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Status
+}
+
+func TestHandleWithdrawals(t *testing.T) {
+	db := testDB(t)
+	fake := NewFakeWallet()
+	latestRate.Store(&rate{Prices: eur(100), UpdatedAt: time.Now()})
+	defer latestRate.Store(nil)
+
+	w := testWithdrawal(t, db, fake, XMR)
+
+	fake.RejectTransfers = true
+	if err := HandleWithdrawals(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	if status := withdrawalStatus(t, db, w.ID); status != model.WithdrawalPending || len(fake.Payouts()) != 0 {
+		t.Fatalf("Withdrawal should wait for funds in the wallet, got %s\n", status)
+	}
+	fake.RejectTransfers = false
+
+	if err := HandleWithdrawals(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	payouts := fake.Payouts()
+	if len(payouts) != 1 || payouts[0].Destinations[0].Amount != w.Amount {
+		t.Fatalf("Expected a payout of %d, got %+v\n", w.Amount, payouts)
+	}
+	if status := withdrawalStatus(t, db, w.ID); status != model.WithdrawalSent {
+		t.Fatalf("Expected sent, got %s\n", status)
+	}
+
+	fake.Confirm(withdrawalConfirmations)
+	if err := HandleWithdrawals(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	if status := withdrawalStatus(t, db, w.ID); status != model.WithdrawalConfirmed {
+		t.Fatalf("Expected confirmed, got %s\n", status)
+	}
+}
+
+func TestHandleWithdrawalsUnknownOutcome(t *testing.T) {
+	db := testDB(t)
+	fake := NewFakeWallet()
+	latestRate.Store(&rate{Prices: eur(100), UpdatedAt: time.Now()})
+	defer latestRate.Store(nil)
+
+	w := testWithdrawal(t, db, fake, XMR)
+
+	// The fake can't tell a retry apart, so an unclear transfer is left for staff
+	fake.Unreachable = true
+	if err := HandleWithdrawals(db, fake); !errors.Is(err, ErrFakeUnreachable) {
+		t.Fatalf("Expected ErrFakeUnreachable, got %v\n", err)
+	}
+	fake.Unreachable = false
+	if err := HandleWithdrawals(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	if status := withdrawalStatus(t, db, w.ID); status != model.WithdrawalUnknown || len(fake.Payouts()) != 0 {
+		t.Fatalf("Withdrawal should be left for staff, got %s\n", status)
+	}
+
+	if _, err := ResolveWithdrawal(db, fake, w.ID, strings.Repeat("a", 64)); !errors.Is(err, ErrInvalidTxHash) {
+		t.Fatalf("Hash unknown to the wallet should be refused, got %v\n", err)
+	}
+	if _, err := ResolveWithdrawal(db, fake, w.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleWithdrawals(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	if status := withdrawalStatus(t, db, w.ID); status != model.WithdrawalSent || len(fake.Payouts()) != 1 {
+		t.Fatalf("Resolved withdrawal should be sent once, got %s\n", status)
+	}
+}
+
+func TestRecoverWithdrawals(t *testing.T) {
+	db := testDB(t)
+	fake := NewFakeWallet()
+	latestRate.Store(&rate{Prices: eur(100), UpdatedAt: time.Now()})
+	defer latestRate.Store(nil)
+
+	w := testWithdrawal(t, db, fake, XMR)
+
+	// Crashed after the transfer call, before the tx hash was saved
+	if _, err := model.M.Withdrawal.UpdateStatus(db, w.ID, model.WithdrawalPending, model.WithdrawalProcessing); err != nil {
+		t.Fatal(err)
+	}
+	sent, err := fake.Transfer([]walletrpc.Destination{{Amount: w.Amount, Address: w.DestAddress}}, w.IdempotencyKey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RecoverWithdrawals(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	if status := withdrawalStatus(t, db, w.ID); status != model.WithdrawalUnknown {
+		t.Fatalf("Interrupted withdrawal should be left for staff, got %s\n", status)
+	}
+
+	if _, err := ResolveWithdrawal(db, fake, w.ID, sent.TxHash); err != nil {
+		t.Fatal(err)
+	}
+	if status := withdrawalStatus(t, db, w.ID); status != model.WithdrawalSent || len(fake.Payouts()) != 1 {
+		t.Fatalf("Withdrawal should be followed as sent without paying again, got %s\n", status)
+	}
+
+	// A backend that finds transfers by their key just gets the transfer again
+	other := testWithdrawal(t, db, fake, XMR)
+	if _, err := model.M.Withdrawal.UpdateStatus(db, other.ID, model.WithdrawalPending, model.WithdrawalProcessing); err != nil {
+		t.Fatal(err)
+	}
+	fake.Idempotent = true
+	if err := RecoverWithdrawals(db, fake); err != nil {
+		t.Fatal(err)
+	}
+	if status := withdrawalStatus(t, db, other.ID); status != model.WithdrawalPending {
+		t.Fatalf("Interrupted withdrawal should be retried, got %s\n", status)
+	}
+}
@@ -13,24 +13,31 @@ func PublicKeyIsValid(key string) bool {
 }
 
 func SignatureIsValid(pubKey string, signature string) bool {
+	_, ok := VerifiedCleartext(pubKey, signature)
+	return ok
+}
+
+// Returns the text of a cleartext signed message if the signature is valid for pubKey.
+// Use this instead of SignatureIsValid when the signed text itself matters.
+func VerifiedCleartext(pubKey string, signature string) (string, bool) {
 	key, err := crypto.NewKeyFromArmored(pubKey)
 	if err != nil {
-		return false
+		return "", false
 	}
 	pgp := crypto.PGP()
 	verifier, err := pgp.Verify().VerificationKey(key).New()
 	if err != nil {
-		return false
+		return "", false
 	}
 	verifyResult, err := verifier.VerifyCleartext([]byte(signature))
 	if err != nil {
-		return false
+		return "", false
 	}
 	if sigErr := verifyResult.SignatureError(); sigErr != nil {
-		return false
+		return "", false
 	}
 
-	return true
+	return string(verifyResult.Cleartext()), true
 }
 
 func EncryptMessage(pubkey, message string) (string, error) {
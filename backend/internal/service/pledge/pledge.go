@@ -1,11 +1,15 @@
 package pledge
 
 import (
+	"LuomuTori/internal/config"
 	mydb "LuomuTori/internal/db"
+	"LuomuTori/internal/log"
 	"LuomuTori/internal/model"
-	"LuomuTori/internal/service/payment"
+	"LuomuTori/internal/service/fee"
+	"LuomuTori/internal/service/ledger"
 	"database/sql"
 	"github.com/google/uuid"
+	"time"
 
 	"errors"
 )
@@ -13,8 +17,80 @@ import (
 var (
 	ErrNotEnoughBalance    = errors.New("Not enough balance")
 	ErrUserIsAlreadyVendor = errors.New("User is already a vendor")
+	ErrNotActive           = errors.New("Pledge is not active")
+	ErrInvalidAmount       = errors.New("Amount must be positive")
+	ErrForfeitTooLarge     = errors.New("Forfeit is larger than the pledge")
+	ErrNotSelling          = errors.New("Vendor is not selling")
 )
 
+// Levels unlocked by the pledge. MinPledge and MaxOrder are multiples of the pledge of the fee schedule
+// the vendor pledged under,
+// MaxOrder of 0 doesn't limit the size of an order.
+var levels = []struct {
+	minPledge uint64
+	maxOrder  uint64
+}{
+	{minPledge: 1, maxOrder: 1},
+	{minPledge: 2, maxOrder: 3},
+	{minPledge: 5, maxOrder: 10},
+	{minPledge: 10, maxOrder: 0},
+}
+
+// Level 0 can't sell, which happens when a part of the pledge is forfeited.
+// Amounts are in piconeros.
+type Level struct {
+	Number    int
+	MinPledge uint64
+	MaxOrder  uint64
+}
+
+func (l Level) IsUnlimited() bool {
+	return l.Number > 0 && l.MaxOrder == 0
+}
+
+// Levels when the fee schedule requires base piconeros of pledge
+func Levels(base uint64) []Level {
+	ls := make([]Level, 0, len(levels))
+	for i, l := range levels {
+		ls = append(ls, Level{Number: i + 1, MinPledge: l.minPledge * base, MaxOrder: l.maxOrder * base})
+	}
+	return ls
+}
+
+// Returns ErrNotSelling when the schedule requires no pledge, every level would be unlimited
+func LevelOf(base, amount uint64) (Level, error) {
+	if base == 0 {
+		return Level{}, ErrNotSelling
+	}
+
+	level := Level{}
+	for _, l := range Levels(base) {
+		if amount >= l.MinPledge {
+			level = l
+		}
+	}
+	return level, nil
+}
+
+// Pledge amount of the fee schedule the pledge was made under, the base of its levels
+func LevelBase(ec mydb.ExecContext, p *model.VendorPledge) (uint64, error) {
+	schedule, err := model.M.FeeSchedule.Get(ec, p.FeeScheduleID)
+	if err != nil {
+		return 0, err
+	}
+	return schedule.PledgeAmount, nil
+}
+
+// Next level the vendor can top up to, false if at the highest level
+func NextLevel(base, amount uint64) (Level, bool) {
+	for _, l := range Levels(base) {
+		if amount < l.MinPledge {
+			return l, true
+		}
+	}
+	return Level{}, false
+}
+
 func Create(db *sql.DB, userID uuid.UUID, logoFilename string) (*model.VendorPledge, error) {
 	tx, err := db.Begin()
 	if err != nil {
@@ -22,32 +98,229 @@ func Create(db *sql.DB, userID uuid.UUID, logoFilename string) (*model.VendorPle
 	}
 	defer tx.Rollback()
 
-	wallet, err := model.M.Wallet.GetForUser(tx, userID)
+	schedule, err := fee.Current(tx)
 	if err != nil {
 		return nil, err
 	}
 
-	pledgeAmount := payment.XMR
+	pledgeAmount := schedule.PledgeAmount
 
-	// Check if this fails because of the balance >= $2 constraint
-	if _, err := model.M.Wallet.ReduceBalance(tx, wallet.ID, pledgeAmount); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+	// Retired vendors can pledge again
+	pledge, err := model.M.VendorPledge.GetForUpdate(tx, userID)
+	if err == nil {
+		if pledge.Status != model.PledgeRetired {
+			return nil, ErrUserIsAlreadyVendor
+		}
+		if err := model.M.VendorPledge.Reactivate(tx, pledge.ID, pledgeAmount, schedule.ID, logoFilename); err != nil {
+			return nil, err
+		}
+	} else if errors.Is(err, sql.ErrNoRows) {
+		pledge, err = model.M.VendorPledge.Create(tx, pledgeAmount, schedule.ID, logoFilename, userID)
+		if err != nil {
+			if mydb.ErrCode(err) == mydb.ErrCodeUniqueViolation {
+				return nil, ErrUserIsAlreadyVendor
+			}
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	if err := ledger.Transfer(tx, model.LedgerPledge, pledge.ID, ledger.User(userID), ledger.To(ledger.Pledge(userID), pledgeAmount)); err != nil {
+		if errors.Is(err, ledger.ErrNotEnoughBalance) {
 			return nil, ErrNotEnoughBalance
 		}
 		return nil, err
 	}
 
-	pledge, err := model.M.VendorPledge.Create(tx, pledgeAmount, logoFilename, userID)
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return model.M.VendorPledge.GetForUser(db, userID)
+}
+
+// Adds to the pledge from the wallet of the vendor, which can unlock a higher level
+func TopUp(db *sql.DB, userID uuid.UUID, amount uint64) (*model.VendorPledge, error) {
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
-		if mydb.ErrCode(err) == mydb.ErrCodeUniqueViolation {
-			return nil, ErrUserIsAlreadyVendor
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	pledge, err := model.M.VendorPledge.GetForUpdate(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !pledge.IsActive() {
+		return nil, ErrNotActive
+	}
+
+	if err := ledger.Transfer(tx, model.LedgerPledge, pledge.ID, ledger.User(userID), ledger.To(ledger.Pledge(userID), amount)); err != nil {
+		if errors.Is(err, ledger.ErrNotEnoughBalance) {
+			return nil, ErrNotEnoughBalance
 		}
 		return nil, err
 	}
 
+	pledge, err = model.M.VendorPledge.AddAmount(tx, pledge.ID, amount)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	return pledge, nil
 }
+
+// Stops the vendor from getting new orders.
+// The pledge is returned by RefundRetired once config.PledgeCooldown has passed and the vendor has no open orders.
+func RequestRetirement(db *sql.DB, userID uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pledge, err := model.M.VendorPledge.GetForUpdate(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !pledge.IsActive() {
+		return ErrNotActive
+	}
+
+	if err := model.M.VendorPledge.RequestRetirement(tx, pledge.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Returns the pledges of retiring vendors whose cooldown is over and who have no open orders or disputes
+func RefundRetired(db *sql.DB) error {
+	pledges, err := model.M.VendorPledge.GetAllRetiringBefore(db, time.Now().Add(-config.PledgeCooldown))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pledges {
+		open, err := model.M.Order.CountOpenForVendor(db, p.UserID)
+		if err != nil {
+			return err
+		}
+		if open > 0 {
+			continue
+		}
+
+		if err := refund(db, p.UserID); err != nil {
+			return err
+		}
+		log.Info.Printf("Returned the pledge of retired vendor %s\n", p.UserID)
+	}
+
+	return nil
+}
+
+func refund(db *sql.DB, userID uuid.UUID) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pledge, err := model.M.VendorPledge.GetForUpdate(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !pledge.IsRetiring() {
+		return nil
+	}
+
+	if err := ledger.Transfer(tx, model.LedgerPledgeRefund, pledge.ID, ledger.Pledge(userID), ledger.To(ledger.User(userID), pledge.Amount)); err != nil {
+		return err
+	}
+
+	if err := model.M.VendorPledge.Retire(tx, pledge.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Takes a part of the pledge of the vendor to compensate a buyer, or to the fees if recipientID isn't valid.
+// Call this inside a database transaction.
+func Forfeit(tx mydb.ExecContext, vendorID uuid.UUID, amount uint64, recipientID uuid.NullUUID, reason string) (*model.PledgeForfeit, error) {
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	pledge, err := model.M.VendorPledge.GetForUpdate(tx, vendorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := model.M.VendorPledge.ReduceAmount(tx, pledge.ID, amount); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrForfeitTooLarge
+		}
+		return nil, err
+	}
+
+	forfeit, err := model.M.VendorPledge.CreateForfeit(tx, pledge.ID, amount, recipientID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	to := ledger.Fees
+	if recipientID.Valid {
+		to = ledger.User(recipientID.UUID)
+	}
+
+	if err := ledger.Transfer(tx, model.LedgerPledgeForfeit, forfeit.ID, ledger.Pledge(vendorID), ledger.To(to, amount)); err != nil {
+		return nil, err
+	}
+
+	return forfeit, nil
+}
+
+// Largest order in piconeros the vendor can take, 0 if there is no limit.
+// Returns ErrNotSelling if the vendor is retiring, the pledge is under the first level or it was
+// made under a schedule that required no pledge.
+func OrderLimit(ec mydb.ExecContext, vendorID uuid.UUID) (uint64, error) {
+	pledge, err := model.M.VendorPledge.GetForUser(ec, vendorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotSelling
+		}
+		return 0, err
+	}
+
+	if !pledge.IsActive() {
+		return 0, ErrNotSelling
+	}
+
+	base, err := LevelBase(ec, pledge)
+	if err != nil {
+		return 0, err
+	}
+
+	level, err := LevelOf(base, pledge.Amount)
+	if err != nil {
+		return 0, err
+	}
+	if level.Number == 0 {
+		return 0, ErrNotSelling
+	}
+
+	return level.MaxOrder, nil
+}
@@ -0,0 +1,42 @@
+package pledge
+
+import (
+	"errors"
+	"testing"
+)
+
+const base = 1_000_000_000_000
+
+func TestLevelOf(t *testing.T) {
+	tests := []struct {
+		amount uint64
+		number int
+	}{
+		{amount: 0, number: 0},
+		{amount: base - 1, number: 0},
+		{amount: base, number: 1},
+		{amount: 3 * base, number: 2},
+		{amount: 10 * base, number: 4},
+	}
+
+	for _, tt := range tests {
+		level, err := LevelOf(base, tt.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if level.Number != tt.number {
+			t.Fatalf("Pledge of %d should be level %d, got %d\n", tt.amount, tt.number, level.Number)
+		}
+	}
+
+	if _, ok := NextLevel(base, 10*base); ok {
+		t.Fatalf("Highest level should have no next level\n")
+	}
+}
+
+func TestLevelOfFreePledge(t *testing.T) {
+	// Without a base every level would start at 0 and the top one is unlimited
+	if level, err := LevelOf(0, 0); !errors.Is(err, ErrNotSelling) || level.IsUnlimited() {
+		t.Fatalf("Free pledge should not sell, got %+v %v\n", level, err)
+	}
+}
@@ -1,9 +1,34 @@
 package product
 
 import (
+	mydb "LuomuTori/internal/db"
 	"LuomuTori/internal/model"
 	"database/sql"
+	"errors"
 	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidCurrency = errors.New("Invalid currency")
+	ErrInvalidStock    = errors.New("Stock can't be negative")
+	ErrNoSuchCategory  = errors.New("No such category")
+	ErrTooManyTags     = errors.New("Too many tags")
+	ErrInvalidTag      = errors.New("Tags must be at most 32 characters")
+	ErrNoPricing       = errors.New("Listing needs a pricing and a delivery method")
+	ErrNoSuchProduct   = errors.New("No such product")
+	ErrNotVendor       = errors.New("Only the vendor can edit the listing")
+	ErrNoImage         = errors.New("Listing needs an image")
+	ErrTooManyImages   = errors.New("Too many images")
+)
+
+const (
+	MaxTags      = 10
+	maxTagLength = 32
+	// Images of one version of a listing
+	MaxImages = 5
 )
 
 type Pricing struct {
@@ -16,31 +41,187 @@ type DeliveryMethod struct {
 	Price       int
 }
 
+// Stock of the product in grams. Untracked stock is unlimited.
+type Stock struct {
+	Tracked  bool
+	Amount   int
+	LowStock int
+}
+
+func (s Stock) valid() bool {
+	return s.Amount >= 0 && s.LowStock >= 0
+}
+
+func (s Stock) amount() sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(s.Amount), Valid: s.Tracked}
+}
+
 func Create(
 	db *sql.DB,
 	title string,
 	description string,
-	imageFile string,
+	imageFiles []string,
 	pricings []Pricing,
 	deliveryMethods []DeliveryMethod,
+	currency model.Currency,
+	stock Stock,
+	categoryID uuid.NullUUID,
+	tags string,
 	vendorID uuid.UUID) (*model.Product, error) {
 
+	if !model.ValidCurrency(currency) {
+		return nil, ErrInvalidCurrency
+	}
+
+	if !stock.valid() {
+		return nil, ErrInvalidStock
+	}
+
+	parsedTags, err := ParseTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if !forSale(pricings, deliveryMethods) {
+		return nil, ErrNoPricing
+	}
+
+	if len(imageFiles) == 0 {
+		return nil, ErrNoImage
+	}
+	if len(imageFiles) > MaxImages {
+		return nil, ErrTooManyImages
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if categoryID.Valid {
+		if _, err := model.M.Category.Get(tx, categoryID.UUID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrNoSuchCategory
+			}
+			return nil, err
+		}
+	}
+
+	product, err := model.M.Product.Create(tx, title, description, imageFiles[0], vendorID, currency, stock.amount(), stock.LowStock, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.M.ProductTag.Set(tx, product.ID, parsedTags); err != nil {
+		return nil, err
+	}
+
+	version, err := createVersion(tx, product, title, description, imageFiles, pricings, deliveryMethods)
+	if err != nil {
+		return nil, err
+	}
+	product.VersionID = version.ID
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// Replaces the listing with a new version. The images of the current version are kept if imageFiles is empty.
+// Pricings and delivery methods of old versions stay for the orders made with them but can't be ordered anymore.
+func Edit(
+	db *sql.DB,
+	productID uuid.UUID,
+	title string,
+	description string,
+	imageFiles []string,
+	pricings []Pricing,
+	deliveryMethods []DeliveryMethod,
+	vendorID uuid.UUID) (*model.ProductVersion, error) {
+
+	if !forSale(pricings, deliveryMethods) {
+		return nil, ErrNoPricing
+	}
+
+	if len(imageFiles) > MaxImages {
+		return nil, ErrTooManyImages
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	product, err := model.M.Product.Create(tx, title, description, imageFile, vendorID)
+	product, err := model.M.Product.GetForUpdate(tx, productID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoSuchProduct
+		}
+		return nil, err
+	}
+
+	// Deleted listings stay for the orders made with them but get no new versions
+	if product.IsDeleted() {
+		return nil, ErrNoSuchProduct
+	}
+
+	if product.VendorID != vendorID {
+		return nil, ErrNotVendor
+	}
+
+	if len(imageFiles) == 0 {
+		imageFiles, err = model.M.ProductImage.GetAllForVersion(tx, product.VersionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := createVersion(tx, product, title, description, imageFiles, pricings, deliveryMethods)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// Creates the next version of the product and makes it current.
+// Call this inside a database transaction.
+func createVersion(
+	tx mydb.ExecContext,
+	product *model.Product,
+	title string,
+	description string,
+	imageFiles []string,
+	pricings []Pricing,
+	deliveryMethods []DeliveryMethod) (*model.ProductVersion, error) {
+
+	if len(imageFiles) == 0 {
+		return nil, ErrNoImage
+	}
+
+	// The first image is the cover of the listing
+	version, err := model.M.ProductVersion.Create(tx, product.ID, title, description, imageFiles[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.M.ProductImage.Create(tx, version.ID, imageFiles); err != nil {
+		return nil, err
+	}
+
 	for _, pricing := range pricings {
 		if pricing.Quantity <= 0 {
 			continue
 		}
-		if _, err := model.M.Price.Create(tx, pricing.Quantity, pricing.Price, product.ID); err != nil {
+		if _, err := model.M.Price.Create(tx, pricing.Quantity, pricing.Price, product.ID, version.ID); err != nil {
 			return nil, err
 		}
 	}
@@ -49,14 +230,50 @@ func Create(
 		if len(dm.Description) == 0 {
 			continue
 		}
-		if _, err := model.M.DeliveryMethod.Create(tx, dm.Description, dm.Price, product.ID); err != nil {
+		if _, err := model.M.DeliveryMethod.Create(tx, dm.Description, dm.Price, product.ID, version.ID); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err := model.M.Product.SetVersion(tx, product.ID, version); err != nil {
 		return nil, err
 	}
 
-	return product, nil
+	return version, nil
+}
+
+// Whether the listing has something to order and a way to deliver it
+func forSale(pricings []Pricing, deliveryMethods []DeliveryMethod) bool {
+	hasPricing := slices.ContainsFunc(pricings, func(p Pricing) bool { return p.Quantity > 0 })
+	hasDelivery := slices.ContainsFunc(deliveryMethods, func(dm DeliveryMethod) bool { return len(dm.Description) > 0 })
+	return hasPricing && hasDelivery
+}
+
+func SetStock(db *sql.DB, productID uuid.UUID, stock Stock) error {
+	if !stock.valid() {
+		return ErrInvalidStock
+	}
+
+	return model.M.Product.SetStock(db, productID, stock.amount(), stock.LowStock)
+}
+
+// Splits comma separated tags, lower cases them and drops duplicates and empty ones
+func ParseTags(s string) ([]string, error) {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, ErrInvalidTag
+		}
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+
+	return tags, nil
 }
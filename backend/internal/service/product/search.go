@@ -0,0 +1,71 @@
+package product
+
+import (
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/payment"
+	"LuomuTori/internal/translate"
+	"github.com/google/uuid"
+	"strings"
+)
+
+const PageSize = 24
+
+// Product search as given by the user. Prices are whole units of the display currency
+// and bounds of 0 don't filter. Pages start from 1.
+type Search struct {
+	Text           string
+	CategoryID     uuid.NullUUID
+	Tag            string
+	VendorID       uuid.NullUUID
+	DeliveryMethod string
+	MinPrice       int
+	MaxPrice       int
+	MinRating      int
+	Sort           model.ProductSort
+	Page           int
+}
+
+// Builds the query of the search for a user with the language and display currency.
+// Price bounds are ignored while the XMR rate of the display currency is unknown.
+func NewQuery(s Search, lang string, currency model.Currency) model.ProductQuery {
+	q := model.ProductQuery{
+		Text:           s.Text,
+		Dictionary:     model.DictionaryEnglish,
+		CategoryID:     s.CategoryID,
+		Tag:            strings.ToLower(strings.Join(strings.Fields(s.Tag), " ")),
+		VendorID:       s.VendorID,
+		DeliveryMethod: s.DeliveryMethod,
+		MinRating:      s.MinRating,
+		Rates:          make(map[model.Currency]float64, len(model.Currencies)),
+		Sort:           s.Sort,
+		Limit:          PageSize,
+		Offset:         (max(s.Page, 1) - 1) * PageSize,
+	}
+
+	if lang == translate.Fi {
+		q.Dictionary = model.DictionaryFinnish
+	}
+
+	if !model.ValidProductSort(q.Sort) {
+		q.Sort = model.SortNewest
+		if q.Text != "" {
+			q.Sort = model.SortRelevance
+		}
+	}
+
+	for _, c := range model.Currencies {
+		q.Rates[c] = payment.XMRPriceIn(c)
+	}
+
+	if rate := q.Rates[currency]; rate > 0 {
+		q.MinXMR = float64(max(s.MinPrice, 0)) / rate
+		q.MaxXMR = float64(max(s.MaxPrice, 0)) / rate
+	}
+
+	return q
+}
+
+// Number of pages for total results, at least one
+func NumPages(total int) int {
+	return max(1, (total+PageSize-1)/PageSize)
+}
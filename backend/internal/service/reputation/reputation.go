@@ -0,0 +1,135 @@
+package reputation
+
+import (
+	mydb "LuomuTori/internal/db"
+	"LuomuTori/internal/log"
+	"LuomuTori/internal/model"
+	"database/sql"
+	"github.com/google/uuid"
+	"math"
+	"time"
+)
+
+// Share of each component in the score
+const (
+	reviewWeight   = 0.40
+	disputeWeight  = 0.25
+	declineWeight  = 0.10
+	deliveryWeight = 0.15
+	ageWeight      = 0.10
+)
+
+const (
+	maxGrade = 5.0
+	// Weight of a review halves every HalfLife
+	HalfLife = 180 * 24 * time.Hour
+	// Order value in piconeros whose review weighs about 1.7 times a review of a free order
+	referenceValue = 100_000_000_000
+	// Imaginary neutral reviews and clean orders, so that a single order doesn't make or break a new vendor
+	priorReviews = 2.0
+	priorGrade   = 3.0
+	priorOrders  = 5.0
+	// Deliveries within a day are perfect, a week or more scores zero
+	fastDeliveryHours = 24.0
+	slowDeliveryHours = 7 * 24.0
+	// Accounts of a year or older get the full age score
+	matureAgeDays = 365.0
+)
+
+// Computes the reputation of a vendor at now from their reviewed orders and order history
+func Compute(vendorID uuid.UUID, graded []model.GradedOrder, stats model.VendorStats, now time.Time) *model.Reputation {
+	r := &model.Reputation{
+		VendorID:         vendorID,
+		NumReviews:       len(graded),
+		NumOrders:        stats.NumOrders,
+		NumDisputes:      stats.NumDisputes,
+		NumDisputesLost:  stats.NumDisputesLost,
+		NumDeclined:      stats.NumDeclined,
+		AvgDeliveryHours: stats.AvgDeliveryHours,
+		AccountAgeDays:   int(now.Sub(stats.AccountCreatedAt).Hours() / 24),
+	}
+
+	var weights, weightedSum float64
+	for _, g := range graded {
+		w := reviewWeightOf(g, now)
+		weights += w
+		weightedSum += w * float64(g.Grade)
+	}
+	if weights > 0 {
+		r.WeightedGrade = weightedSum / weights
+	}
+	r.ReviewScore = (weightedSum + priorReviews*priorGrade) / (weights + priorReviews) / maxGrade
+
+	orders := float64(stats.NumOrders) + priorOrders
+	disputeRate := float64(stats.NumDisputes) / orders
+	// A draw is half a loss
+	lossRate := (float64(stats.NumDisputesLost) + float64(stats.NumDisputesDrawn)/2) / orders
+	r.DisputeScore = clamp(1 - 2*disputeRate - 3*lossRate)
+
+	r.DeclineScore = clamp(1 - 2*float64(stats.NumDeclined)/orders)
+
+	r.DeliveryScore = 1
+	if stats.NumDelivered > 0 {
+		r.DeliveryScore = clamp(1 - (stats.AvgDeliveryHours-fastDeliveryHours)/(slowDeliveryHours-fastDeliveryHours))
+	}
+
+	r.AgeScore = clamp(float64(r.AccountAgeDays) / matureAgeDays)
+
+	r.Score = 100 * (reviewWeight*r.ReviewScore +
+		disputeWeight*r.DisputeScore +
+		declineWeight*r.DeclineScore +
+		deliveryWeight*r.DeliveryScore +
+		ageWeight*r.AgeScore)
+
+	return r
+}
+
+// Larger orders weigh more but only logarithmically, so a single big order can't buy a reputation
+func reviewWeightOf(g model.GradedOrder, now time.Time) float64 {
+	value := 1 + math.Log1p(float64(g.XMRValue)/referenceValue)
+	age := now.Sub(g.CreatedAt)
+	if age < 0 {
+		age = 0
+	}
+	recency := math.Pow(0.5, float64(age)/float64(HalfLife))
+	return value * recency
+}
+
+func clamp(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+func RefreshVendor(ec mydb.ExecContext, vendorID uuid.UUID) (*model.Reputation, error) {
+	graded, err := model.M.Reputation.GetGradedOrders(ec, vendorID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := model.M.Reputation.GetVendorStats(ec, vendorID)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Compute(vendorID, graded, *stats, time.Now())
+	if err := model.M.Reputation.Upsert(ec, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Recomputes the reputation of every vendor
+func Refresh(db *sql.DB) error {
+	ids, err := model.M.Reputation.GetAllVendorIDs(db)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := RefreshVendor(db, id); err != nil {
+			log.Error.Printf("Failed to refresh reputation of vendor %s: %s\n", id, err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package reputation
+
+import (
+	"LuomuTori/internal/model"
+	"github.com/google/uuid"
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func matureStats() model.VendorStats {
+	return model.VendorStats{
+		AccountCreatedAt: now.Add(-2 * 365 * 24 * time.Hour),
+		NumOrders:        20,
+		NumDelivered:     20,
+		AvgDeliveryHours: 12,
+	}
+}
+
+func TestComputeBounds(t *testing.T) {
+	good := make([]model.GradedOrder, 0)
+	for i := 0; i < 50; i++ {
+		good = append(good, model.GradedOrder{Grade: 5, XMRValue: 1_000_000_000_000, CreatedAt: now})
+	}
+	r := Compute(uuid.New(), good, matureStats(), now)
+	if r.Score <= 95 || r.Score > 100 {
+		t.Fatalf("Perfect vendor should score close to 100, got %f\n", r.Score)
+	}
+	if math.Abs(r.WeightedGrade-5) > 1e-9 {
+		t.Fatalf("Weighted grade of fives should be 5, got %f\n", r.WeightedGrade)
+	}
+
+	bad := model.VendorStats{AccountCreatedAt: now, NumOrders: 10, NumDeclined: 10, NumDisputes: 10, NumDisputesLost: 10, NumDelivered: 1, AvgDeliveryHours: 1000}
+	r = Compute(uuid.New(), []model.GradedOrder{{Grade: 0, CreatedAt: now}}, bad, now)
+	if r.Score < 0 || r.Score > 20 {
+		t.Fatalf("Terrible vendor should score close to 0, got %f\n", r.Score)
+	}
+	if r.DisputeScore != 0 || r.DeclineScore != 0 || r.DeliveryScore != 0 || r.AgeScore != 0 {
+		t.Fatalf("Components should be clamped to 0, got %+v\n", r)
+	}
+}
+
+func TestComputeNewVendor(t *testing.T) {
+	r := Compute(uuid.New(), nil, model.VendorStats{AccountCreatedAt: now}, now)
+	if r.WeightedGrade != 0 || r.ReviewScore != priorGrade/maxGrade {
+		t.Fatalf("Vendor without reviews should get the prior review score, got %+v\n", r)
+	}
+
+	// A single bad order shouldn't sink a new vendor completely
+	stats := model.VendorStats{AccountCreatedAt: now, NumOrders: 1, NumDisputes: 1, NumDisputesLost: 1}
+	r = Compute(uuid.New(), []model.GradedOrder{{Grade: 0, CreatedAt: now}}, stats, now)
+	if r.DisputeScore == 0 || r.ReviewScore == 0 {
+		t.Fatalf("One order should be softened by the prior, got %+v\n", r)
+	}
+}
+
+func TestReviewWeighting(t *testing.T) {
+	old := model.GradedOrder{Grade: 1, XMRValue: referenceValue, CreatedAt: now.Add(-2 * HalfLife)}
+	recent := model.GradedOrder{Grade: 5, XMRValue: referenceValue, CreatedAt: now}
+	r := Compute(uuid.New(), []model.GradedOrder{old, recent}, matureStats(), now)
+	// Weights are 1 and 4
+	if r.WeightedGrade < 4.19 || r.WeightedGrade > 4.21 {
+		t.Fatalf("Recent review should weigh four times a review two half-lives old, got %f\n", r.WeightedGrade)
+	}
+
+	small := model.GradedOrder{Grade: 1, XMRValue: 0, CreatedAt: now}
+	large := model.GradedOrder{Grade: 5, XMRValue: 100 * referenceValue, CreatedAt: now}
+	r = Compute(uuid.New(), []model.GradedOrder{small, large}, matureStats(), now)
+	if r.WeightedGrade <= 3 {
+		t.Fatalf("Larger order should weigh more, got %f\n", r.WeightedGrade)
+	}
+
+	many := make([]model.GradedOrder, 0)
+	for i := 0; i < 10; i++ {
+		many = append(many, small)
+	}
+	r = Compute(uuid.New(), append(many, large), matureStats(), now)
+	if r.WeightedGrade >= 3 {
+		t.Fatalf("One large order shouldn't outweigh many small ones, got %f\n", r.WeightedGrade)
+	}
+}
+
+func TestDisputeOutcomes(t *testing.T) {
+	won := matureStats()
+	won.NumDisputes = 2
+	lost := won
+	lost.NumDisputesLost = 2
+	drawn := won
+	drawn.NumDisputesDrawn = 2
+
+	rWon := Compute(uuid.New(), nil, won, now)
+	rDrawn := Compute(uuid.New(), nil, drawn, now)
+	rLost := Compute(uuid.New(), nil, lost, now)
+	if !(rWon.DisputeScore > rDrawn.DisputeScore && rDrawn.DisputeScore > rLost.DisputeScore) {
+		t.Fatalf("Lost disputes should cost more than draws and draws more than wins, got %f %f %f\n",
+			rWon.DisputeScore, rDrawn.DisputeScore, rLost.DisputeScore)
+	}
+	if rWon.DisputeScore >= 1 {
+		t.Fatalf("Disputes should cost even when won, got %f\n", rWon.DisputeScore)
+	}
+}
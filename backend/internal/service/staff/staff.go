@@ -0,0 +1,117 @@
+package staff
+
+import (
+	mydb "LuomuTori/internal/db"
+	"LuomuTori/internal/model"
+	"LuomuTori/internal/service/auth"
+	"LuomuTori/internal/service/pgp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+var (
+	ErrUsernameTaken      = errors.New("Username unavailable")
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+	ErrInvalidSignature   = errors.New("Invalid signature")
+	ErrInvalidPGPKey      = errors.New("Invalid PGP public key")
+	ErrInvalidRole        = errors.New("Invalid staff role")
+	ErrNoRoles            = errors.New("Staff needs at least one role")
+)
+
+func Create(db *sql.DB, username, password, pgpKey string, roles []model.StaffRole) (*model.Staff, error) {
+	if !pgp.PublicKeyIsValid(pgpKey) {
+		return nil, ErrInvalidPGPKey
+	}
+
+	if len(roles) == 0 {
+		return nil, ErrNoRoles
+	}
+
+	for _, role := range roles {
+		if !model.ValidStaffRole(role) {
+			return nil, ErrInvalidRole
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	s, err := model.M.Staff.Create(tx, username, hash, pgpKey)
+	if err != nil {
+		if mydb.ErrCode(err) == mydb.ErrCodeUniqueViolation {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
+	}
+
+	for _, role := range roles {
+		if err := model.M.Staff.AddRole(tx, s.ID, role); err != nil {
+			return nil, err
+		}
+	}
+	s.Roles = roles
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// New random challenge for a login. Keep it in the session until the login form is posted.
+func NewChallenge() (string, error) {
+	token, err := auth.Generate2FAToken(32)
+	if err != nil {
+		return "", err
+	}
+	return ChallengeMessage(token), nil
+}
+
+// Text the staff member signs with their PGP key to login
+func ChallengeMessage(token string) string {
+	return fmt.Sprintf("LUOMUTORI ADMIN LOGIN %s", token)
+}
+
+// Checks the password and that signature is a cleartext signature of challenge made with the PGP key of the staff member.
+// Disabled staff can't login.
+func Authenticate(db *sql.DB, username, password, signature, challenge string) (*model.Staff, error) {
+	s, err := model.M.Staff.GetWithName(db, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if s.IsDisabled() {
+		return nil, ErrInvalidCredentials
+	}
+
+	hash, err := model.M.Staff.GetHashedPassword(db, s.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Signed text must be the challenge, a valid signature of some other text isn't enough
+	text, ok := pgp.VerifiedCleartext(s.PgpKey, signature)
+	if !ok || challenge == "" || strings.TrimSpace(text) != challenge {
+		return nil, ErrInvalidSignature
+	}
+
+	return s, nil
+}
@@ -0,0 +1,244 @@
+package upload
+
+import (
+	"LuomuTori/internal/config"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	ErrInvalidImage    = errors.New("Invalid image")
+	ErrUnsupportedType = fmt.Errorf("%w, it must be a JPEG, PNG or GIF", ErrInvalidImage)
+	ErrTooLarge        = fmt.Errorf("%w, it must be at most 10MB and %dx%d pixels", ErrInvalidImage, MaxDimension, MaxDimension)
+)
+
+const (
+	MaxBytes     = 10 << 20
+	MaxDimension = 4096
+	// Longest side of a thumbnail in pixels
+	ThumbnailSize = 400
+	jpegQuality   = 90
+)
+
+// Directories under config.UploadDir
+const (
+	ProductImages = "product-images"
+	VendorLogos   = "vendor-logos"
+	// Under the directory of the full images, with the same filenames
+	Thumbnails = "thumbnails"
+)
+
+// Checks and re-encodes an uploaded image into dir under config.UploadDir and returns its filename.
+// Re-encoding drops every metadata segment like EXIF and GPS. The file is named by the hash of
+// its content, so uploading the same image again reuses the file instead of overwriting another.
+func SaveImage(r io.Reader, dir string) (string, error) {
+	img, format, err := decode(r)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, ext, err := encode(img, format)
+	if err != nil {
+		return "", err
+	}
+
+	filename := hashName(encoded, ext)
+	if err := write(filepath.Join(config.UploadDir, dir), filename, encoded); err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
+
+// Saves a product image like SaveImage and a thumbnail of it for the product grid
+func SaveProductImage(r io.Reader) (string, error) {
+	img, format, err := decode(r)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, ext, err := encode(img, format)
+	if err != nil {
+		return "", err
+	}
+
+	thumbnail, _, err := encode(scale(img, ThumbnailSize), format)
+	if err != nil {
+		return "", err
+	}
+
+	filename := hashName(encoded, ext)
+	dir := filepath.Join(config.UploadDir, ProductImages)
+	if err := write(filepath.Join(dir, Thumbnails), filename, thumbnail); err != nil {
+		return "", err
+	}
+	if err := write(dir, filename, encoded); err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
+
+// Names given by hashName
+var hashNameRx = regexp.MustCompile(`^[0-9a-f]{64}\.(jpg|png)$`)
+
+// Path of the thumbnail of a product image relative to config.UploadDir. It's called on every render
+// and doesn't touch the disk: SaveProductImage writes the thumbnail before the image, so its hash name
+// records that the thumbnail exists. Images uploaded before thumbnails have other names and fall back
+// to the full image.
+func ThumbnailPath(filename string) string {
+	filename = filepath.Base(filename)
+	if !hashNameRx.MatchString(filename) {
+		return path.Join(ProductImages, filename)
+	}
+	return path.Join(ProductImages, Thumbnails, filename)
+}
+
+// Reads at most MaxBytes and checks the type and the dimensions from the header before decoding
+// the pixels, so a small file can't claim a huge image.
+func decode(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > MaxBytes {
+		return nil, "", ErrTooLarge
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, "", ErrUnsupportedType
+		}
+		return nil, "", ErrInvalidImage
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, "", ErrInvalidImage
+	}
+	if cfg.Width > MaxDimension || cfg.Height > MaxDimension {
+		return nil, "", ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrInvalidImage
+	}
+
+	return img, format, nil
+}
+
+// Photos stay JPEG, everything else becomes PNG to keep transparency. Only the first frame of a GIF is kept.
+func encode(img image.Image, format string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".jpg", nil
+	}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+func hashName(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + ext
+}
+
+// Writes the file through a temporary file so a half written image is never served.
+// An existing file has the same content because of its name and is left alone.
+func write(dir, filename string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(dir, filename)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Shrinks the image so its longest side is at most size pixels by averaging the source pixels
+// under each target pixel. Smaller images are returned as they are.
+func scale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, max(1, h*size/w)
+	if h > w {
+		tw, th = max(1, w*size/h), size
+	}
+
+	src := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := src.NRGBA64At(sx, sy)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
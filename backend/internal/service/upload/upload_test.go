@@ -0,0 +1,186 @@
+package upload
+
+import (
+	"LuomuTori/internal/config"
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// JPEG with an APP1 segment like the one cameras write EXIF and GPS data into
+func jpegWithExif(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	payload := append([]byte("Exif\x00\x00"), []byte("GPSLatitude 60.1699")...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+
+	// Right after the start of image marker
+	res := append([]byte{}, data[:2]...)
+	res = append(res, segment...)
+	return append(res, data[2:]...)
+}
+
+func useTempUploadDir(t *testing.T) {
+	old := config.UploadDir
+	config.UploadDir = t.TempDir()
+	t.Cleanup(func() { config.UploadDir = old })
+}
+
+var hashedFilename = regexp.MustCompile(`^[0-9a-f]{64}\.(png|jpg)$`)
+
+func TestSaveImageNamesByContent(t *testing.T) {
+	useTempUploadDir(t)
+	data := encodePNG(t, testImage(20, 10))
+
+	first, err := SaveImage(bytes.NewReader(data), VendorLogos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hashedFilename.MatchString(first) {
+		t.Fatalf("Filename should be a content hash, got %s\n", first)
+	}
+
+	second, err := SaveImage(bytes.NewReader(data), VendorLogos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatalf("Same image should get the same name, got %s and %s\n", first, second)
+	}
+
+	other, err := SaveImage(bytes.NewReader(encodePNG(t, testImage(10, 20))), VendorLogos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Fatalf("Different images should get different names\n")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(config.UploadDir, VendorLogos))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 files without temporary leftovers, got %d\n", len(entries))
+	}
+}
+
+func TestSaveImageStripsMetadata(t *testing.T) {
+	useTempUploadDir(t)
+
+	filename, err := SaveImage(bytes.NewReader(jpegWithExif(t, testImage(16, 16))), VendorLogos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(filename) != ".jpg" {
+		t.Fatalf("JPEG should stay JPEG, got %s\n", filename)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(config.UploadDir, VendorLogos, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(saved, []byte("Exif")) || bytes.Contains(saved, []byte("GPSLatitude")) {
+		t.Fatalf("Saved image should not contain metadata\n")
+	}
+}
+
+func TestSaveImageRejects(t *testing.T) {
+	useTempUploadDir(t)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"text", []byte("<?php echo 'hi'; ?>"), ErrUnsupportedType},
+		{"truncated", encodePNG(t, testImage(20, 20))[:40], ErrInvalidImage},
+		{"too wide", encodePNG(t, image.NewGray(image.Rect(0, 0, MaxDimension+1, 1))), ErrTooLarge},
+		{"too many bytes", make([]byte, MaxBytes+1), ErrTooLarge},
+	}
+
+	for _, test := range tests {
+		_, err := SaveImage(bytes.NewReader(test.data), VendorLogos)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: expected %v, got %v\n", test.name, test.err, err)
+		}
+		if !errors.Is(err, ErrInvalidImage) {
+			t.Fatalf("%s: every rejection should be an ErrInvalidImage, got %v\n", test.name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(config.UploadDir, VendorLogos)); err == nil {
+		entries, _ := os.ReadDir(filepath.Join(config.UploadDir, VendorLogos))
+		if len(entries) != 0 {
+			t.Fatalf("Rejected images should not be saved, found %d files\n", len(entries))
+		}
+	}
+}
+
+func TestSaveProductImageThumbnail(t *testing.T) {
+	useTempUploadDir(t)
+
+	filename, err := SaveProductImage(bytes.NewReader(encodePNG(t, testImage(1000, 500))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ThumbnailPath(filename); got != "product-images/thumbnails/"+filename {
+		t.Fatalf("Expected the thumbnail path, got %s\n", got)
+	}
+
+	f, err := os.Open(filepath.Join(config.UploadDir, ProductImages, Thumbnails, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != ThumbnailSize || cfg.Height != ThumbnailSize/2 {
+		t.Fatalf("Thumbnail should keep the aspect ratio at %dpx, got %dx%d\n", ThumbnailSize, cfg.Width, cfg.Height)
+	}
+}
+
+func TestThumbnailPathFallsBack(t *testing.T) {
+	useTempUploadDir(t)
+
+	if got := ThumbnailPath("old-upload.jpg"); got != "product-images/old-upload.jpg" {
+		t.Fatalf("Image without a thumbnail should fall back to itself, got %s\n", got)
+	}
+	if got := ThumbnailPath("../../etc/passwd"); got != "product-images/passwd" {
+		t.Fatalf("Path should stay inside the product images, got %s\n", got)
+	}
+}
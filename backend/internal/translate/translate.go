@@ -4,6 +4,7 @@ import (
 	"LuomuTori/internal/log"
 	"LuomuTori/internal/model"
 	"encoding/json"
+	"fmt"
 	"os"
 	"strings"
 )
@@ -40,6 +41,12 @@ func T(text any, lang string) string {
 		word = text.(string)
 	case model.OrderStatus:
 		word = string(text.(model.OrderStatus))
+	case model.LedgerKind:
+		word = string(text.(model.LedgerKind))
+	case model.ActorRole:
+		word = string(text.(model.ActorRole))
+	case model.WithdrawalStatus:
+		word = string(text.(model.WithdrawalStatus))
 	}
 
 	if lang == En {
@@ -69,3 +76,17 @@ func T(text any, lang string) string {
 		return translation
 	}
 }
+
+// Translates a format like "Stock of %s is running low" and fills it with the arguments
+func Tf(format string, lang string, args []string) string {
+	translated := T(format, lang)
+	if len(args) == 0 {
+		return translated
+	}
+
+	values := make([]any, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg)
+	}
+	return fmt.Sprintf(translated, values...)
+}
@@ -0,0 +1,4 @@
+DROP TABLE ledger_entries;
+DROP TABLE ledger_transactions;
+DROP FUNCTION ledger_append_only;
+DROP FUNCTION ledger_check_balanced;
@@ -0,0 +1,75 @@
+CREATE TABLE ledger_transactions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	kind TEXT NOT NULL,
+	reference_id UUID NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE ledger_entries (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	transaction_id UUID REFERENCES ledger_transactions(id) NOT NULL,
+	account TEXT NOT NULL,
+	account_id UUID NOT NULL,
+	amount BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK(amount <> 0)
+);
+
+CREATE INDEX ledger_entries_account_idx ON ledger_entries (account, account_id);
+
+-- Entries of a ledger transaction must sum up to zero.
+-- Checked at commit so that a transaction can be posted with several statements.
+CREATE FUNCTION ledger_check_balanced() RETURNS TRIGGER AS $$
+BEGIN
+	IF (SELECT SUM(amount) FROM ledger_entries WHERE transaction_id = NEW.transaction_id) <> 0 THEN
+		RAISE EXCEPTION 'ledger transaction % is not balanced', NEW.transaction_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+	AFTER INSERT ON ledger_entries
+	DEFERRABLE INITIALLY DEFERRED
+	FOR EACH ROW EXECUTE FUNCTION ledger_check_balanced();
+
+CREATE FUNCTION ledger_append_only() RETURNS TRIGGER AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_transactions_append_only
+	BEFORE UPDATE OR DELETE ON ledger_transactions
+	FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+CREATE TRIGGER ledger_entries_append_only
+	BEFORE UPDATE OR DELETE ON ledger_entries
+	FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+-- Opening balances for funds that existed before the ledger
+WITH opening AS (
+	INSERT INTO ledger_transactions (kind, reference_id)
+	VALUES ('opening', '00000000-0000-0000-0000-000000000000')
+	RETURNING id
+), balances AS (
+	SELECT 'user' AS account, wallets.user_id AS account_id, wallets.balance AS amount
+	FROM wallets
+	UNION ALL
+	SELECT 'escrow', invoices.order_id, invoices.xmr_price
+	FROM invoices
+	JOIN orders ON orders.id = invoices.order_id
+	WHERE orders.status IN ('paid', 'delivered', 'disputed', 'dispute countered')
+	UNION ALL
+	SELECT 'pledge', vendor_pledges.user_id, vendor_pledges.amount
+	FROM vendor_pledges
+)
+INSERT INTO ledger_entries (transaction_id, account, account_id, amount)
+SELECT opening.id, balances.account, balances.account_id, balances.amount
+FROM opening, balances
+WHERE balances.amount > 0
+UNION ALL
+SELECT opening.id, 'opening', '00000000-0000-0000-0000-000000000000', -SUM(balances.amount)::BIGINT
+FROM opening, balances
+WHERE balances.amount > 0
+GROUP BY opening.id;
@@ -0,0 +1,2 @@
+DROP TABLE escrows;
+DROP TYPE escrow_status;
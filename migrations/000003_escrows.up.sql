@@ -0,0 +1,36 @@
+CREATE TYPE escrow_status AS ENUM ('held', 'released', 'refunded', 'split');
+
+CREATE TABLE escrows (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	order_id UUID REFERENCES orders(id) NOT NULL,
+	amount BIGINT NOT NULL,
+	fee BIGINT NOT NULL,
+	status escrow_status NOT NULL DEFAULT 'held',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	settled_at TIMESTAMPTZ,
+	UNIQUE(order_id),
+	CHECK(amount >= 0),
+	CHECK(fee >= 0),
+	CHECK((status = 'held') = (settled_at IS NULL))
+);
+
+-- Escrowed values used to be stored in invoices with the 5% cut already taken
+INSERT INTO escrows (order_id, amount, fee, status, created_at, settled_at)
+SELECT invoices.order_id, invoices.xmr_price, invoices.xmr_price / 19,
+	CASE
+		WHEN orders.status IN ('paid', 'delivered', 'disputed', 'dispute countered') THEN 'held'
+		WHEN orders.status = 'completed' THEN 'released'
+		WHEN dispute_decisions.outcome = 'vendor won' THEN 'released'
+		WHEN dispute_decisions.outcome = 'draw' THEN 'split'
+		ELSE 'refunded'
+	END::escrow_status,
+	invoices.created_at,
+	CASE
+		WHEN orders.status IN ('paid', 'delivered', 'disputed', 'dispute countered') THEN NULL
+		ELSE COALESCE(dispute_decisions.created_at, decline_reasons.created_at, NOW())
+	END
+FROM invoices
+JOIN orders ON orders.id = invoices.order_id
+LEFT JOIN disputes ON disputes.order_id = orders.id
+LEFT JOIN dispute_decisions ON dispute_decisions.dispute_id = disputes.id
+LEFT JOIN decline_reasons ON decline_reasons.order_id = orders.id;
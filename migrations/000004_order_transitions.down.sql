@@ -0,0 +1,3 @@
+DROP TRIGGER orders_check_transition ON orders;
+DROP FUNCTION orders_check_transition;
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
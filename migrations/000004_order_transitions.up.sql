@@ -0,0 +1,28 @@
+-- NOT VALID so that orders left in legacy statuses don't block the migration
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN (
+	'paid', 'declined', 'delivered', 'completed', 'disputed', 'dispute countered', 'dispute settled'
+)) NOT VALID;
+
+-- Mirrors the transition table in internal/model/order.go
+CREATE FUNCTION orders_check_transition() RETURNS TRIGGER AS $$
+BEGIN
+	IF (OLD.status, NEW.status) NOT IN (
+		('paid', 'delivered'),
+		('paid', 'declined'),
+		('delivered', 'completed'),
+		('delivered', 'disputed'),
+		('disputed', 'dispute countered'),
+		('disputed', 'dispute settled'),
+		('dispute countered', 'dispute settled')
+	) THEN
+		RAISE EXCEPTION 'illegal order status transition from % to %', OLD.status, NEW.status;
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_check_transition
+	BEFORE UPDATE OF status ON orders
+	FOR EACH ROW
+	WHEN (OLD.status IS DISTINCT FROM NEW.status)
+	EXECUTE FUNCTION orders_check_transition();
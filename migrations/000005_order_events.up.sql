@@ -0,0 +1,51 @@
+CREATE TABLE order_events (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	order_id UUID REFERENCES orders(id) NOT NULL,
+	status TEXT NOT NULL,
+	actor_role TEXT NOT NULL,
+	actor_id UUID REFERENCES users(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX order_events_order_id_idx ON order_events (order_id, created_at);
+
+-- Rebuild the history of existing orders from the tables that recorded each step
+INSERT INTO order_events (order_id, status, actor_role, actor_id, created_at)
+SELECT orders.id, 'paid', 'customer', orders.customer_id, orders.created_at
+FROM orders
+UNION ALL
+SELECT orders.id, 'delivered', 'vendor', products.vendor_id, delivery_infos.created_at
+FROM delivery_infos
+JOIN orders ON orders.id = delivery_infos.order_id
+JOIN prices ON prices.id = orders.price_id
+JOIN products ON products.id = prices.product_id
+UNION ALL
+SELECT orders.id, 'declined', 'vendor', products.vendor_id, decline_reasons.created_at
+FROM decline_reasons
+JOIN orders ON orders.id = decline_reasons.order_id
+JOIN prices ON prices.id = orders.price_id
+JOIN products ON products.id = prices.product_id
+UNION ALL
+-- Completion time wasn't recorded, so those events are dated to the migration
+SELECT orders.id, 'completed',
+	CASE WHEN reviews.id IS NULL THEN 'system' ELSE 'customer' END,
+	CASE WHEN reviews.id IS NULL THEN NULL ELSE orders.customer_id END,
+	NOW()
+FROM orders
+LEFT JOIN reviews ON reviews.order_id = orders.id
+WHERE orders.status = 'completed'
+UNION ALL
+SELECT disputes.order_id, 'disputed', 'customer', orders.customer_id, disputes.created_at
+FROM disputes
+JOIN orders ON orders.id = disputes.order_id
+UNION ALL
+SELECT disputes.order_id, 'dispute countered', 'vendor', products.vendor_id, counter_disputes.created_at
+FROM counter_disputes
+JOIN disputes ON disputes.id = counter_disputes.dispute_id
+JOIN orders ON orders.id = disputes.order_id
+JOIN prices ON prices.id = orders.price_id
+JOIN products ON products.id = prices.product_id
+UNION ALL
+SELECT disputes.order_id, 'dispute settled', 'admin', NULL, dispute_decisions.created_at
+FROM dispute_decisions
+JOIN disputes ON disputes.id = dispute_decisions.dispute_id;
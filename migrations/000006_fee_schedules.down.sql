@@ -0,0 +1,5 @@
+ALTER TABLE escrows DROP COLUMN commission_bps;
+ALTER TABLE escrows DROP COLUMN fee_schedule_id;
+DROP TABLE vendor_commissions;
+DROP TABLE fee_tiers;
+DROP TABLE fee_schedules;
@@ -0,0 +1,46 @@
+-- Fee schedules are versioned and never edited. A change publishes a new version
+-- and orders keep pointing at the version they were created with.
+CREATE TABLE fee_schedules (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	version INT GENERATED ALWAYS AS IDENTITY UNIQUE,
+	commission_bps INT NOT NULL,
+	withdrawal_fee INT NOT NULL,
+	withdrawal_min INT NOT NULL,
+	pledge_amount BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK(commission_bps BETWEEN 0 AND 10000),
+	CHECK(withdrawal_fee >= 0),
+	CHECK(withdrawal_min > withdrawal_fee),
+	CHECK(pledge_amount >= 0)
+);
+
+-- Commission for vendors with at least min_sales completed orders
+CREATE TABLE fee_tiers (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	fee_schedule_id UUID REFERENCES fee_schedules(id) NOT NULL,
+	min_sales INT NOT NULL,
+	commission_bps INT NOT NULL,
+	UNIQUE(fee_schedule_id, min_sales),
+	CHECK(min_sales > 0),
+	CHECK(commission_bps BETWEEN 0 AND 10000)
+);
+
+-- Overrides the schedule and tiers for a single vendor
+CREATE TABLE vendor_commissions (
+	vendor_id UUID PRIMARY KEY REFERENCES users(id),
+	commission_bps INT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK(commission_bps BETWEEN 0 AND 10000)
+);
+
+-- Fees that were hard-coded until now: 5% commission, 1€ withdrawal fee, 10€ minimum and 1XMR pledge
+INSERT INTO fee_schedules (commission_bps, withdrawal_fee, withdrawal_min, pledge_amount)
+VALUES (500, 1, 10, 1000000000000);
+
+ALTER TABLE escrows ADD COLUMN fee_schedule_id UUID REFERENCES fee_schedules(id);
+ALTER TABLE escrows ADD COLUMN commission_bps INT;
+
+UPDATE escrows SET fee_schedule_id = (SELECT id FROM fee_schedules), commission_bps = 500;
+
+ALTER TABLE escrows ALTER COLUMN fee_schedule_id SET NOT NULL;
+ALTER TABLE escrows ALTER COLUMN commission_bps SET NOT NULL;
@@ -0,0 +1,3 @@
+-- Prices and delivery methods are in the currency of their product. Existing listings were priced in euros.
+ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'EUR';
+ALTER TABLE products ADD CONSTRAINT products_currency_check CHECK (currency IN ('EUR', 'USD', 'GBP', 'SEK'));
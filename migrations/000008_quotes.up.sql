@@ -0,0 +1,20 @@
+-- Price quote shown to the customer before ordering. The order debits exactly xmr_amount.
+CREATE TABLE quotes (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	customer_id UUID REFERENCES users(id) NOT NULL,
+	price_id UUID REFERENCES prices(id) NOT NULL,
+	delivery_method_id UUID REFERENCES delivery_methods(id) NOT NULL,
+	currency TEXT NOT NULL,
+	item_total INT NOT NULL,
+	delivery_total INT NOT NULL,
+	xmr_amount BIGINT NOT NULL,
+	fee BIGINT NOT NULL,
+	fee_schedule_id UUID REFERENCES fee_schedules(id) NOT NULL,
+	commission_bps INT NOT NULL,
+	order_id UUID REFERENCES orders(id),
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE(order_id),
+	CHECK(xmr_amount > 0),
+	CHECK(fee >= 0 AND fee <= xmr_amount)
+);
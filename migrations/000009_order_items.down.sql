@@ -0,0 +1,21 @@
+-- Multi-item orders and quotes keep only their first item
+ALTER TABLE quotes ADD COLUMN price_id UUID REFERENCES prices(id);
+
+UPDATE quotes SET price_id = (
+	SELECT price_id FROM quote_items WHERE quote_items.quote_id = quotes.id ORDER BY id LIMIT 1
+);
+
+ALTER TABLE quotes ALTER COLUMN price_id SET NOT NULL;
+ALTER TABLE quotes DROP COLUMN vendor_id;
+DROP TABLE quote_items;
+
+ALTER TABLE orders ADD COLUMN price_id UUID REFERENCES prices(id);
+
+UPDATE orders SET price_id = (
+	SELECT price_id FROM order_items WHERE order_items.order_id = orders.id ORDER BY id LIMIT 1
+);
+
+ALTER TABLE orders ALTER COLUMN price_id SET NOT NULL;
+DROP INDEX orders_vendor_id_idx;
+ALTER TABLE orders DROP COLUMN vendor_id;
+DROP TABLE order_items;
@@ -0,0 +1,54 @@
+-- Orders hold several line items of one vendor and are shipped with a single delivery method.
+ALTER TABLE orders ADD COLUMN vendor_id UUID REFERENCES users(id);
+
+UPDATE orders SET vendor_id = products.vendor_id
+FROM prices
+JOIN products ON products.id = prices.product_id
+WHERE prices.id = orders.price_id;
+
+ALTER TABLE orders ALTER COLUMN vendor_id SET NOT NULL;
+
+CREATE INDEX orders_vendor_id_idx ON orders (vendor_id);
+
+CREATE TABLE order_items (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	order_id UUID REFERENCES orders(id) NOT NULL,
+	price_id UUID REFERENCES prices(id) NOT NULL,
+	count INT NOT NULL,
+	unit_price INT NOT NULL,
+	UNIQUE(order_id, price_id),
+	CHECK(count > 0)
+);
+
+INSERT INTO order_items (order_id, price_id, count, unit_price)
+SELECT orders.id, prices.id, 1, prices.price
+FROM orders
+JOIN prices ON prices.id = orders.price_id;
+
+ALTER TABLE orders DROP COLUMN price_id;
+
+-- Quotes are made for the items of one vendor in the cart
+ALTER TABLE quotes ADD COLUMN vendor_id UUID REFERENCES users(id);
+
+UPDATE quotes SET vendor_id = products.vendor_id
+FROM prices
+JOIN products ON products.id = prices.product_id
+WHERE prices.id = quotes.price_id;
+
+ALTER TABLE quotes ALTER COLUMN vendor_id SET NOT NULL;
+
+CREATE TABLE quote_items (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	quote_id UUID REFERENCES quotes(id) NOT NULL,
+	price_id UUID REFERENCES prices(id) NOT NULL,
+	count INT NOT NULL,
+	unit_price INT NOT NULL,
+	UNIQUE(quote_id, price_id),
+	CHECK(count > 0)
+);
+
+INSERT INTO quote_items (quote_id, price_id, count, unit_price)
+SELECT quotes.id, quotes.price_id, 1, quotes.item_total
+FROM quotes;
+
+ALTER TABLE quotes DROP COLUMN price_id;
@@ -0,0 +1,4 @@
+DROP TABLE notifications;
+ALTER TABLE products DROP CONSTRAINT products_stock_check;
+ALTER TABLE products DROP COLUMN low_stock;
+ALTER TABLE products DROP COLUMN stock;
@@ -0,0 +1,14 @@
+-- Stock of a product in grams. Products without stock are never sold out.
+ALTER TABLE products ADD COLUMN stock INT;
+ALTER TABLE products ADD COLUMN low_stock INT NOT NULL DEFAULT 0;
+ALTER TABLE products ADD CONSTRAINT products_stock_check CHECK(stock >= 0 AND low_stock >= 0);
+
+CREATE TABLE notifications (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) NOT NULL,
+	message TEXT NOT NULL,
+	read_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at);
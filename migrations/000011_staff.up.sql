@@ -0,0 +1,17 @@
+-- Staff of the admin console, separate from the users of the store.
+-- Login requires both the password and a signature made with the PGP key.
+CREATE TABLE staff (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	username TEXT UNIQUE NOT NULL,
+	password_hash BYTEA NOT NULL,
+	pgp_key TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	disabled_at TIMESTAMPTZ
+);
+
+CREATE TABLE staff_roles (
+	staff_id UUID REFERENCES staff(id) NOT NULL,
+	role TEXT NOT NULL,
+	PRIMARY KEY(staff_id, role),
+	CHECK(role IN ('moderator', 'arbiter', 'finance', 'superadmin'))
+);
@@ -0,0 +1,28 @@
+-- Every mutation made in the admin console. Each row contains the hash of the previous row,
+-- so rows that are edited or removed break the chain even if the trigger below is bypassed.
+CREATE TABLE audit_events (
+	id BIGSERIAL PRIMARY KEY,
+	staff_id UUID REFERENCES staff(id) NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	before_state TEXT NOT NULL,
+	after_state TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	prev_hash BYTEA NOT NULL,
+	hash BYTEA UNIQUE NOT NULL
+);
+
+CREATE FUNCTION audit_append_only() RETURNS TRIGGER AS $$
+BEGIN
+	RAISE EXCEPTION 'audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+	BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+	BEFORE TRUNCATE ON audit_events
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_append_only();
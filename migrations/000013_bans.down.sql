@@ -0,0 +1,10 @@
+DROP TABLE user_sessions;
+
+DELETE FROM bans WHERE scope <> 'login';
+ALTER TABLE bans DROP CONSTRAINT bans_user_id_scope_key;
+ALTER TABLE bans DROP CONSTRAINT bans_scope_check;
+ALTER TABLE bans DROP COLUMN freeze_funds;
+ALTER TABLE bans DROP COLUMN expires_at;
+ALTER TABLE bans DROP COLUMN reason;
+ALTER TABLE bans DROP COLUMN scope;
+ALTER TABLE bans ADD CONSTRAINT bans_user_id_key UNIQUE(user_id);
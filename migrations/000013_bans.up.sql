@@ -0,0 +1,20 @@
+-- A user can have one ban per scope. A login ban also prevents selling and buying.
+-- Bans without expires_at are permanent.
+ALTER TABLE bans DROP CONSTRAINT bans_user_id_key;
+ALTER TABLE bans ADD COLUMN scope TEXT NOT NULL DEFAULT 'login';
+ALTER TABLE bans ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE bans ADD COLUMN expires_at TIMESTAMPTZ;
+ALTER TABLE bans ADD COLUMN freeze_funds BOOLEAN NOT NULL DEFAULT FALSE;
+-- Earlier bans kept the user out completely, a frozen login ban still does
+UPDATE bans SET freeze_funds = TRUE;
+ALTER TABLE bans ADD CONSTRAINT bans_scope_check CHECK(scope IN ('login', 'selling', 'buying'));
+ALTER TABLE bans ADD CONSTRAINT bans_user_id_scope_key UNIQUE(user_id, scope);
+
+-- Sessions of the store by user, so they can be revoked
+CREATE TABLE user_sessions (
+	token TEXT PRIMARY KEY,
+	user_id UUID REFERENCES users(id) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX user_sessions_user_id_idx ON user_sessions (user_id);
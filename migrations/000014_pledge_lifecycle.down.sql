@@ -0,0 +1,7 @@
+DROP TABLE pledge_forfeits;
+
+ALTER TABLE vendor_pledges DROP CONSTRAINT vendor_pledges_amount_check;
+ALTER TABLE vendor_pledges DROP CONSTRAINT vendor_pledges_status_check;
+ALTER TABLE vendor_pledges DROP COLUMN retired_at;
+ALTER TABLE vendor_pledges DROP COLUMN retire_requested_at;
+ALTER TABLE vendor_pledges DROP COLUMN status;
@@ -0,0 +1,20 @@
+-- Retiring vendors get their pledge back after a cooldown when they have no open orders.
+-- amount is what is currently pledged, it grows with top-ups and shrinks with forfeits.
+ALTER TABLE vendor_pledges ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE vendor_pledges ADD COLUMN retire_requested_at TIMESTAMPTZ;
+ALTER TABLE vendor_pledges ADD COLUMN retired_at TIMESTAMPTZ;
+ALTER TABLE vendor_pledges ADD CONSTRAINT vendor_pledges_status_check CHECK(status IN ('active', 'retiring', 'retired'));
+ALTER TABLE vendor_pledges ADD CONSTRAINT vendor_pledges_amount_check CHECK(amount >= 0);
+
+-- Parts of pledges taken by admins. Funds without a recipient go to the fees account.
+CREATE TABLE pledge_forfeits (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	pledge_id UUID REFERENCES vendor_pledges(id) NOT NULL,
+	amount BIGINT NOT NULL,
+	recipient_id UUID REFERENCES users(id),
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK(amount > 0)
+);
+
+CREATE INDEX pledge_forfeits_pledge_id_idx ON pledge_forfeits (pledge_id);
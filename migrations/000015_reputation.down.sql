@@ -0,0 +1,3 @@
+DROP TABLE vendor_reputations;
+
+ALTER TABLE reviews DROP COLUMN created_at;
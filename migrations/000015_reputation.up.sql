@@ -0,0 +1,24 @@
+-- Reviews are weighted by recency, old reviews get the time of their order
+ALTER TABLE reviews ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+UPDATE reviews SET created_at = orders.created_at FROM orders WHERE orders.id = reviews.order_id;
+
+-- Precomputed by the reputation job. Component scores are in [0, 1], score in [0, 100].
+CREATE TABLE vendor_reputations (
+	vendor_id UUID PRIMARY KEY REFERENCES users(id),
+	score DOUBLE PRECISION NOT NULL,
+	review_score DOUBLE PRECISION NOT NULL,
+	dispute_score DOUBLE PRECISION NOT NULL,
+	decline_score DOUBLE PRECISION NOT NULL,
+	delivery_score DOUBLE PRECISION NOT NULL,
+	age_score DOUBLE PRECISION NOT NULL,
+	weighted_grade DOUBLE PRECISION NOT NULL,
+	num_reviews INT NOT NULL,
+	num_orders INT NOT NULL,
+	num_disputes INT NOT NULL,
+	num_disputes_lost INT NOT NULL,
+	num_declined INT NOT NULL,
+	avg_delivery_hours DOUBLE PRECISION NOT NULL,
+	account_age_days INT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK(score >= 0 AND score <= 100)
+);
@@ -0,0 +1,7 @@
+DROP INDEX prices_product_id_idx;
+DROP INDEX products_search_english_idx;
+DROP INDEX products_search_finnish_idx;
+
+ALTER TABLE products DROP COLUMN search_english;
+ALTER TABLE products DROP COLUMN search_finnish;
+ALTER TABLE products DROP COLUMN created_at;
@@ -0,0 +1,13 @@
+ALTER TABLE products ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Full-text search in the language of the user, titles weigh more than descriptions
+ALTER TABLE products ADD COLUMN search_finnish tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('finnish', title), 'A') || setweight(to_tsvector('finnish', description), 'B')
+) STORED;
+ALTER TABLE products ADD COLUMN search_english tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', description), 'B')
+) STORED;
+
+CREATE INDEX products_search_finnish_idx ON products USING GIN (search_finnish);
+CREATE INDEX products_search_english_idx ON products USING GIN (search_english);
+CREATE INDEX prices_product_id_idx ON prices (product_id);
@@ -0,0 +1,5 @@
+DROP TABLE product_tags;
+
+ALTER TABLE products DROP COLUMN category_id;
+
+DROP TABLE categories;
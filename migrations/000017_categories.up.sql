@@ -0,0 +1,24 @@
+-- Category tree managed by staff, a category without a parent is a root
+CREATE TABLE categories (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name TEXT NOT NULL,
+	parent_id UUID REFERENCES categories(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK(LENGTH(name) BETWEEN 1 AND 64),
+	CHECK(parent_id <> id)
+);
+
+CREATE UNIQUE INDEX categories_parent_name_idx ON categories (COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'), LOWER(name));
+
+ALTER TABLE products ADD COLUMN category_id UUID REFERENCES categories(id);
+CREATE INDEX products_category_id_idx ON products (category_id);
+
+-- Free-form tags set by vendors, normalized to lower case
+CREATE TABLE product_tags (
+	product_id UUID REFERENCES products(id) NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY(product_id, tag),
+	CHECK(LENGTH(tag) BETWEEN 1 AND 32 AND tag = LOWER(tag))
+);
+
+CREATE INDEX product_tags_tag_idx ON product_tags (tag);
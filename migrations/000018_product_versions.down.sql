@@ -0,0 +1,13 @@
+DROP INDEX delivery_methods_version_id_idx;
+ALTER TABLE delivery_methods DROP COLUMN version_id;
+
+DROP INDEX prices_version_id_idx;
+
+-- Fails if several versions of a listing have a pricing of the same quantity
+ALTER TABLE prices DROP CONSTRAINT prices_quantity_version_id_key;
+ALTER TABLE prices DROP COLUMN version_id;
+ALTER TABLE prices ADD CONSTRAINT prices_quantity_product_id_key UNIQUE(quantity, product_id);
+
+ALTER TABLE products DROP COLUMN version_id;
+
+DROP TABLE product_versions;
@@ -0,0 +1,45 @@
+-- Editing a listing creates a new version. Pricings and delivery methods belong to a version
+-- and are never changed, so orders keep pointing at what they were bought under.
+CREATE TABLE product_versions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	product_id UUID REFERENCES products(id) NOT NULL,
+	version INT NOT NULL,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL,
+	image_filename TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE(product_id, version),
+	CHECK(version > 0)
+);
+
+INSERT INTO product_versions (product_id, version, title, description, image_filename, created_at)
+SELECT id, 1, title, description, image_filename, created_at FROM products;
+
+-- Current version of the listing, its columns in products are kept in sync for searching.
+-- Only null inside the transaction that creates the product and its first version.
+ALTER TABLE products ADD COLUMN version_id UUID REFERENCES product_versions(id);
+
+UPDATE products SET version_id = product_versions.id
+FROM product_versions
+WHERE product_versions.product_id = products.id;
+
+ALTER TABLE prices ADD COLUMN version_id UUID REFERENCES product_versions(id);
+
+UPDATE prices SET version_id = products.version_id
+FROM products
+WHERE products.id = prices.product_id;
+
+ALTER TABLE prices ALTER COLUMN version_id SET NOT NULL;
+ALTER TABLE prices DROP CONSTRAINT prices_quantity_product_id_key;
+ALTER TABLE prices ADD CONSTRAINT prices_quantity_version_id_key UNIQUE(quantity, version_id);
+CREATE INDEX prices_version_id_idx ON prices (version_id);
+
+ALTER TABLE delivery_methods ADD COLUMN version_id UUID REFERENCES product_versions(id);
+
+UPDATE delivery_methods SET version_id = products.version_id
+FROM products
+WHERE products.id = delivery_methods.product_id;
+
+ALTER TABLE delivery_methods ALTER COLUMN version_id SET NOT NULL;
+
+CREATE INDEX delivery_methods_version_id_idx ON delivery_methods (version_id);
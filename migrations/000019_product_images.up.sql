@@ -0,0 +1,13 @@
+-- Images of each version of a listing in display order. The first one is also kept in
+-- image_filename of the version and the product and used as the thumbnail.
+CREATE TABLE product_images (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	version_id UUID REFERENCES product_versions(id) NOT NULL,
+	filename TEXT NOT NULL,
+	position INT NOT NULL,
+	UNIQUE(version_id, position),
+	CHECK(position >= 0)
+);
+
+INSERT INTO product_images (version_id, filename, position)
+SELECT id, image_filename, 0 FROM product_versions;
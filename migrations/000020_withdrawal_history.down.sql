@@ -0,0 +1,21 @@
+CREATE TABLE transactions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO transactions (hash, created_at)
+SELECT tx_hash, updated_at FROM withdrawals WHERE status = 'sent';
+
+-- Only unsent withdrawals were kept before
+DELETE FROM withdrawals WHERE status NOT IN ('pending', 'processing');
+
+DROP INDEX withdrawals_status_idx;
+DROP INDEX withdrawals_user_id_idx;
+
+ALTER TABLE withdrawals
+	DROP COLUMN updated_at,
+	DROP COLUMN confirmations,
+	DROP COLUMN tx_hash,
+	DROP COLUMN idempotency_key,
+	DROP COLUMN user_id;
@@ -0,0 +1,25 @@
+-- Withdrawals are kept as the history of their user instead of being deleted once sent.
+-- Each one is transferred on its own with a key that stays the same when the call is retried.
+ALTER TABLE withdrawals
+	ADD COLUMN user_id UUID REFERENCES users(id),
+	ADD COLUMN idempotency_key UUID NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	ADD COLUMN tx_hash TEXT,
+	ADD COLUMN confirmations BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- The user is the one whose account the ledger debited for the withdrawal
+UPDATE withdrawals SET user_id = ledger_entries.account_id
+FROM ledger_transactions
+JOIN ledger_entries ON ledger_entries.transaction_id = ledger_transactions.id
+WHERE ledger_transactions.kind = 'withdrawal'
+	AND ledger_transactions.reference_id = withdrawals.id
+	AND ledger_entries.account = 'user';
+
+ALTER TABLE withdrawals ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX withdrawals_user_id_idx ON withdrawals (user_id, created_at);
+CREATE INDEX withdrawals_status_idx ON withdrawals (status);
+
+-- Hashes of batched transfers, replaced by withdrawals.tx_hash.
+-- Let the withdrawals job confirm the listed transfers before migrating, failed ones are not retried anymore.
+DROP TABLE transactions;
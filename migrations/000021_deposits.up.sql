@@ -0,0 +1,17 @@
+-- Incoming transfers to the deposit addresses of wallets, one row per transaction.
+-- Filled by the moneropay callback and by polling, credited to the user once when unlocked.
+CREATE TABLE deposits (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	wallet_id UUID REFERENCES wallets(id) NOT NULL,
+	address TEXT NOT NULL CHECK (LENGTH(address) = 95),
+	tx_hash TEXT NOT NULL,
+	amount BIGINT NOT NULL,
+	confirmations BIGINT NOT NULL DEFAULT 0,
+	credited_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE(wallet_id, tx_hash),
+	CHECK(amount > 0)
+);
+
+CREATE INDEX deposits_wallet_id_idx ON deposits (wallet_id, created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE quote_items DROP COLUMN position;
+ALTER TABLE order_items DROP COLUMN position;
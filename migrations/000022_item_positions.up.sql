@@ -0,0 +1,3 @@
+-- Lines are listed in the order they were added, random ids don't keep it
+ALTER TABLE order_items ADD COLUMN position BIGINT GENERATED ALWAYS AS IDENTITY;
+ALTER TABLE quote_items ADD COLUMN position BIGINT GENERATED ALWAYS AS IDENTITY;
@@ -0,0 +1,2 @@
+-- Messages are translation keys formatted with the arguments when shown
+ALTER TABLE notifications ADD COLUMN args TEXT[] NOT NULL DEFAULT '{}';
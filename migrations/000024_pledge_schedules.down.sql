@@ -0,0 +1 @@
+ALTER TABLE vendor_pledges DROP COLUMN fee_schedule_id;
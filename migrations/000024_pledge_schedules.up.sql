@@ -0,0 +1,10 @@
+-- Levels of a pledge follow the fee schedule it was made under, a new schedule doesn't demote vendors.
+-- Pledges made before fee schedules existed fall back to the first one.
+ALTER TABLE vendor_pledges ADD COLUMN fee_schedule_id UUID REFERENCES fee_schedules(id);
+
+UPDATE vendor_pledges SET fee_schedule_id = COALESCE(
+	(SELECT id FROM fee_schedules WHERE created_at <= vendor_pledges.created_at ORDER BY version DESC LIMIT 1),
+	(SELECT id FROM fee_schedules ORDER BY version LIMIT 1)
+);
+
+ALTER TABLE vendor_pledges ALTER COLUMN fee_schedule_id SET NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE wallets DROP COLUMN invoice_id;
@@ -0,0 +1,3 @@
+-- Invoice of the current deposit address, deposit callbacks of any other invoice are rejected.
+-- Existing wallets get a new id, so callbacks of their invoices wait for polling instead.
+ALTER TABLE wallets ADD COLUMN invoice_id UUID NOT NULL DEFAULT gen_random_uuid();